@@ -1,27 +1,55 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
+	"github.com/cyruzin/puppet_master/domain"
+	apiKeyRepository "github.com/cyruzin/puppet_master/modules/apikey/repository/postgres"
+	apiKeyUseCase "github.com/cyruzin/puppet_master/modules/apikey/usecase"
+	authHttpDelivery "github.com/cyruzin/puppet_master/modules/auth/delivery/http/handler"
+	authDirectoryRepository "github.com/cyruzin/puppet_master/modules/auth/repository/ldap"
 	authRepository "github.com/cyruzin/puppet_master/modules/auth/repository/postgres"
 	authCacheRepository "github.com/cyruzin/puppet_master/modules/auth/repository/redis"
 	authUseCase "github.com/cyruzin/puppet_master/modules/auth/usecase"
+	clientRepository "github.com/cyruzin/puppet_master/modules/client/repository/postgres"
+	clientUseCase "github.com/cyruzin/puppet_master/modules/client/usecase"
+	federationRepository "github.com/cyruzin/puppet_master/modules/federation/repository/postgres"
+	keyRepository "github.com/cyruzin/puppet_master/modules/key/repository/postgres"
+	keyUseCase "github.com/cyruzin/puppet_master/modules/key/usecase"
+	mfaRepository "github.com/cyruzin/puppet_master/modules/mfa/repository/postgres"
+	mfaUseCase "github.com/cyruzin/puppet_master/modules/mfa/usecase"
+	passkeyRepository "github.com/cyruzin/puppet_master/modules/passkey/repository/postgres"
+	passkeyUseCase "github.com/cyruzin/puppet_master/modules/passkey/usecase"
 
 	// permissionHttpDelivery "github.com/cyruzin/puppet_master/modules/permission/delivery/http/handler"
 	permissionRepository "github.com/cyruzin/puppet_master/modules/permission/repository/postgres"
 	permissionUseCase "github.com/cyruzin/puppet_master/modules/permission/usecase"
 	roleRepository "github.com/cyruzin/puppet_master/modules/role/repository/postgres"
 	roleUseCase "github.com/cyruzin/puppet_master/modules/role/usecase"
+	scimHttpDelivery "github.com/cyruzin/puppet_master/modules/scim/delivery/http/handler"
+	scimUseCase "github.com/cyruzin/puppet_master/modules/scim/usecase"
+	serviceAccountRepository "github.com/cyruzin/puppet_master/modules/serviceaccount/repository/postgres"
+	serviceAccountUseCase "github.com/cyruzin/puppet_master/modules/serviceaccount/usecase"
 	gql "github.com/cyruzin/puppet_master/modules/shared/delivery/graphql"
 	"github.com/cyruzin/puppet_master/modules/shared/delivery/graphql/middleware"
+	"github.com/cyruzin/puppet_master/modules/shared/mailer"
 	userRepository "github.com/cyruzin/puppet_master/modules/user/repository/postgres"
 	userUseCase "github.com/cyruzin/puppet_master/modules/user/usecase"
+	"github.com/cyruzin/puppet_master/pkg/breach"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
 	"github.com/cyruzin/puppet_master/pkg/util"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/cyruzin/puppet_master/pkg/webauthn"
 	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 	"github.com/go-redis/redis/v8"
@@ -42,6 +70,11 @@ func init() {
 		panic(err)
 	}
 
+	// Secrets are better kept out of the config file.
+	if err := viper.BindEnv(`jwt.key_encryption_key`, "JWT_KEY_ENCRYPTION_KEY"); err != nil {
+		panic(err)
+	}
+
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 
 	if viper.GetBool(`debug`) {
@@ -57,6 +90,20 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Breach filter: go run main.go build-breach-filter <hashes.txt> <filter.bloom>
+	if len(os.Args) > 1 && os.Args[1] == "build-breach-filter" {
+		if len(os.Args) != 4 {
+			log.Fatal().Msg("usage: build-breach-filter <hashes.txt> <filter.bloom>")
+		}
+
+		if err := buildBreachFilter(os.Args[2], os.Args[3]); err != nil {
+			log.Fatal().Err(err).Stack().Msg("could not build the breach filter")
+		}
+
+		log.Info().Str("path", os.Args[3]).Msg("the breach filter was built")
+		return
+	}
+
 	dataSourceName := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s sslmode=disable",
 		viper.GetString(`database.host`),
@@ -88,16 +135,129 @@ func main() {
 	userRepository := userRepository.NewPostgreUserRepository(postgreDB, permissionRepository, roleRepository)
 	userUseCase := userUseCase.NewUserUsecase(permissionRepository, roleRepository, userRepository)
 
+	mfaRepository := mfaRepository.NewPostgreMFARepository(postgreDB)
+	mfaUseCase := mfaUseCase.NewMFAUsecase(
+		mfaRepository,
+		userRepository,
+		authCacheRepository,
+		authUseCase.NewLoginLimiter(authCacheRepository),
+	)
+
+	webAuthn, err := webauthn.New(webauthn.Config{
+		RPID:             viper.GetString(`webauthn.rp_id`),
+		RPName:           viper.GetString(`webauthn.rp_name`),
+		Origins:          viper.GetStringSlice(`webauthn.origins`),
+		Timeout:          viper.GetDuration(`webauthn.timeout`),
+		UserVerification: viper.GetString(`webauthn.user_verification`),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Stack().Msg("invalid webauthn config")
+	}
+
 	authRepository := authRepository.NewPostgreAuthRepository(postgreDB)
+
+	passkeyRepository := passkeyRepository.NewPostgrePasskeyRepository(postgreDB)
+	passkeyUseCase := passkeyUseCase.NewPasskeyUsecase(
+		authRepository,
+		authCacheRepository,
+		passkeyRepository,
+		userRepository,
+		webAuthn,
+	)
+
+	err = crypto.Configure(crypto.Params{
+		Algorithm:   viper.GetString(`password.algorithm`),
+		BcryptCost:  viper.GetInt(`password.bcrypt.cost`),
+		Memory:      viper.GetUint32(`password.argon2.memory`),
+		Iterations:  viper.GetUint32(`password.argon2.iterations`),
+		Parallelism: uint8(viper.GetUint(`password.argon2.parallelism`)),
+		SaltLength:  viper.GetUint32(`password.argon2.salt_length`),
+		KeyLength:   viper.GetUint32(`password.argon2.key_length`),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Stack().Msg("invalid password hashing config")
+	}
+
+	validation.SetPasswordPolicy(newPasswordPolicy())
+
+	signingKeys := keyring.New(nil)
+
+	keyRepository := keyRepository.NewPostgreKeyRepository(postgreDB)
+	keyUseCase := keyUseCase.NewKeyUsecase(keyRepository, signingKeys)
+
+	// Manual rotation, which also generates the first key when none is
+	// stored: go run main.go rotate-keys
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		key, err := keyUseCase.Rotate(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Stack().Msg("could not rotate the signing key")
+		}
+
+		log.Info().Str("kid", key.ID).Time("activates_at", key.ActivatesAt).Msg("the new signing key is published")
+		return
+	}
+
+	if err := keyUseCase.Load(ctx); err != nil {
+		log.Fatal().Err(err).Stack().Msg("could not load the signing keys")
+	}
+
+	go keyRotation(ctx, keyUseCase)
+
+	clientRepository := clientRepository.NewPostgreClientRepository(postgreDB)
+
+	apiKeyRepository := apiKeyRepository.NewPostgreAPIKeyRepository(postgreDB)
+	apiKeyUseCase := apiKeyUseCase.NewAPIKeyUsecase(apiKeyRepository, permissionRepository, roleRepository)
+
+	serviceAccountRepository := serviceAccountRepository.NewPostgreServiceAccountRepository(postgreDB)
+
+	federationRepository := federationRepository.NewPostgreFederatedIdentityRepository(postgreDB)
+
 	authUseCase := authUseCase.NewAuthUsecase(
 		authRepository,
 		authCacheRepository,
 		permissionRepository,
 		roleRepository,
 		userRepository,
+		clientRepository,
+		apiKeyRepository,
+		serviceAccountRepository,
+		federationRepository,
+		newDirectory(),
+		signingKeys,
+		newMailer(),
+		mfaUseCase,
+		passkeyUseCase,
+		federationProviders(),
+		samlProviders(),
 	)
 
-	root := gql.NewRoot(authUseCase, permissionUseCase, roleUseCase, userUseCase)
+	clientUseCase := clientUseCase.NewClientUsecase(authUseCase, clientRepository, roleRepository)
+
+	serviceAccountUseCase := serviceAccountUseCase.NewServiceAccountUsecase(
+		authUseCase,
+		serviceAccountRepository,
+		roleRepository,
+		userRepository,
+	)
+
+	scimUseCase := scimUseCase.NewSCIMUsecase(
+		authUseCase,
+		authRepository,
+		roleRepository,
+		userRepository,
+	)
+
+	root := gql.NewRoot(
+		authUseCase,
+		permissionUseCase,
+		roleUseCase,
+		userUseCase,
+		mfaUseCase,
+		passkeyUseCase,
+		clientUseCase,
+		apiKeyUseCase,
+		serviceAccountUseCase,
+	)
 
 	var schema, _ = graphql.NewSchema(graphql.SchemaConfig{
 		Query:    root.Query,
@@ -110,6 +270,8 @@ func main() {
 		GraphiQL: true,
 	})
 
+	mw := middleware.NewMiddleware(authUseCase)
+
 	router := chi.NewRouter()
 
 	cors := cors.New(cors.Options{
@@ -132,11 +294,19 @@ func main() {
 		MaxAge:           300,
 	})
 
+	// Behind a reverse proxy the client IP is taken from the
+	// X-Forwarded-For or X-Real-IP headers, which clients could spoof
+	// otherwise.
+	if viper.GetBool(`server.behind_proxy`) {
+		router.Use(chiMiddleware.RealIP)
+	}
+
 	router.Use(
 		cors.Handler,
 		render.SetContentType(render.ContentTypeJSON),
 		middleware.LoggerMiddleware,
-		middleware.TokenMiddleware,
+		middleware.ClientMiddleware,
+		mw.TokenMiddleware,
 	)
 
 	// Graphql
@@ -144,6 +314,8 @@ func main() {
 
 	// Rest
 	// permissionHttpDelivery.NewArticleHandler(router, permissionUseCase)
+	authHttpDelivery.NewAuthHandler(router, authUseCase, signingKeys)
+	scimHttpDelivery.NewSCIMHandler(router, authUseCase, scimUseCase)
 
 	srv := &http.Server{
 		Addr:              ":" + viper.GetString(`server.port`),
@@ -225,3 +397,193 @@ func redisConnection(ctx context.Context) *redis.Client {
 
 	return client
 }
+
+// Mailer picks the mail driver from the config. The log driver
+// writes mails to mailer.file, or to the log when it is empty.
+func newMailer() domain.Mailer {
+	switch driver := viper.GetString(`mailer.driver`); driver {
+	case "smtp":
+		return mailer.NewSMTPMailer(
+			viper.GetString(`mailer.smtp.host`),
+			viper.GetString(`mailer.smtp.port`),
+			viper.GetString(`mailer.smtp.username`),
+			viper.GetString(`mailer.smtp.password`),
+			viper.GetString(`mailer.from`),
+		)
+	case "log", "":
+		return mailer.NewLogMailer(viper.GetString(`mailer.file`))
+	default:
+		log.Fatal().Str("driver", driver).Msg("unknown mailer driver")
+		return nil
+	}
+}
+
+// federationProviders reads the external identity providers users can
+// sign in with.
+func federationProviders() []*domain.FederationProvider {
+	providers := []*domain.FederationProvider{}
+
+	if err := viper.UnmarshalKey(`federation.providers`, &providers); err != nil {
+		log.Fatal().Err(err).Stack().Msg("invalid identity provider configuration")
+	}
+
+	return providers
+}
+
+// samlProviders reads the external SAML identity providers users can
+// sign in with.
+func samlProviders() []*domain.SAMLProvider {
+	providers := []*domain.SAMLProvider{}
+
+	if err := viper.UnmarshalKey(`federation.saml_providers`, &providers); err != nil {
+		log.Fatal().Err(err).Stack().Msg("invalid SAML identity provider configuration")
+	}
+
+	return providers
+}
+
+// newDirectory creates the LDAP directory users can sign in with, if
+// it is enabled.
+func newDirectory() domain.DirectoryRepository {
+	if !viper.GetBool(`ldap.enabled`) {
+		return nil
+	}
+
+	config := &domain.LDAPConfig{}
+
+	if err := viper.UnmarshalKey(`ldap`, config); err != nil {
+		log.Fatal().Err(err).Stack().Msg("invalid LDAP configuration")
+	}
+
+	if config.URL == "" || config.BaseDN == "" {
+		log.Fatal().Msg("the LDAP directory needs an url and a base_dn")
+	}
+
+	return authDirectoryRepository.NewLDAPDirectoryRepository(config)
+}
+
+func newPasswordPolicy() validation.PasswordPolicy {
+	policy := validation.PasswordPolicy{
+		MinLength:     viper.GetInt(`password.policy.min_length`),
+		RequireLower:  viper.GetBool(`password.policy.require_lower`),
+		RequireUpper:  viper.GetBool(`password.policy.require_upper`),
+		RequireDigit:  viper.GetBool(`password.policy.require_digit`),
+		RequireSymbol: viper.GetBool(`password.policy.require_symbol`),
+		CheckUserInfo: viper.GetBool(`password.policy.check_user_info`),
+		History:       viper.GetInt(`password.policy.history`),
+	}
+
+	if policy.MinLength <= 0 {
+		policy.MinLength = validation.CurrentPasswordPolicy().MinLength
+	}
+
+	if path := viper.GetString(`password.policy.deny_list`); path != "" {
+		denyList, err := validation.LoadDenyList(path)
+		if err != nil {
+			log.Fatal().Err(err).Stack().Msg("could not load the password deny-list")
+		}
+
+		policy.DenyList = denyList
+	}
+
+	if path := viper.GetString(`password.breach.corpus`); path != "" {
+		corpus, err := breach.Open(path)
+		if err != nil {
+			log.Fatal().Err(err).Stack().Msg("could not load the breach corpus")
+		}
+
+		policy.Breached = corpus
+
+		switch mode := viper.GetString(`password.breach.mode`); mode {
+		case "warn":
+			policy.WarnBreached = true
+		case "reject", "":
+		default:
+			log.Fatal().Str("mode", mode).Msg("unknown breach check mode")
+		}
+	}
+
+	return policy
+}
+
+// buildBreachFilter builds a bloom filter from a file of HASH:COUNT
+// lines, so the corpus can be kept in memory.
+func buildBreachFilter(in, out string) error {
+	file, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	var lines uint64
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	falsePositiveRate := viper.GetFloat64(`password.breach.false_positive_rate`)
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+
+	filter, err := breach.BuildBloomFilter(file, lines, falsePositiveRate)
+	if err != nil {
+		return err
+	}
+
+	output, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(output)
+
+	if _, err := filter.WriteTo(writer); err != nil {
+		output.Close()
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+// Key rotation keeps the keyring in sync with the stored keys and
+// rotates the active key when the rotation policy says so.
+func keyRotation(ctx context.Context, keyUseCase domain.KeyUsecase) {
+	interval := viper.GetDuration(`jwt.rotation.check_interval`)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := keyUseCase.RotateIfDue(ctx); err != nil {
+				log.Error().Err(err).Stack().Msg("scheduled key rotation failed")
+			}
+
+			if err := keyUseCase.Load(ctx); err != nil {
+				log.Error().Err(err).Stack().Msg("could not reload the signing keys")
+			}
+		}
+	}
+}
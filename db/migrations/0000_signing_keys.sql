@@ -0,0 +1,10 @@
+-- Signing keys used to be read from the config only. The table gets its
+-- activation in the next migration.
+CREATE TABLE IF NOT EXISTS signing_keys (
+  id VARCHAR(64) NOT NULL PRIMARY KEY,
+  algorithm VARCHAR(10) NOT NULL,
+  private_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  retired_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+);
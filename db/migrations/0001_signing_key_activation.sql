@@ -0,0 +1,8 @@
+-- New signing keys are published before they sign. Existing keys are
+-- already active, and their private keys are sealed on the next load.
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS activates_at TIMESTAMPTZ;
+
+UPDATE signing_keys SET activates_at = created_at WHERE activates_at IS NULL;
+
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET DEFAULT NOW();
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;
@@ -0,0 +1,3 @@
+-- Argon2id hashes in the PHC format are longer than the 80 characters
+-- bcrypt needed.
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(255);
@@ -0,0 +1,3 @@
+-- Existing users start unverified, like new ones. They are refused only
+-- once email_verification.required is set.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
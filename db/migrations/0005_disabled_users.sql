@@ -0,0 +1,2 @@
+-- Users deactivated through SCIM.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- TOTP secrets of the users who enrolled in MFA.
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id BIGINT NOT NULL PRIMARY KEY REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  secret VARCHAR(64) NOT NULL,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  confirmed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
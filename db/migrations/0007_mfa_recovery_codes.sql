@@ -0,0 +1,10 @@
+-- Single use MFA recovery codes, hashed.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  code VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes (user_id);
@@ -0,0 +1,13 @@
+-- OAuth2 clients and OpenID Connect relying parties.
+CREATE TABLE IF NOT EXISTS clients (
+  id SERIAL NOT NULL PRIMARY KEY,
+  client_id VARCHAR(64) NOT NULL UNIQUE,
+  name VARCHAR(80) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '',
+  redirect_uris TEXT NOT NULL DEFAULT '',
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  role_id BIGINT NOT NULL REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
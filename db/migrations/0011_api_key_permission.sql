@@ -0,0 +1,6 @@
+-- Permissions each API key is limited to.
+CREATE TABLE IF NOT EXISTS api_key_permission (
+  api_key_id BIGINT NOT NULL REFERENCES api_keys (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  permission_id BIGINT NOT NULL REFERENCES permissions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  PRIMARY KEY (api_key_id, permission_id)
+);
@@ -0,0 +1,10 @@
+-- Non-human principals owned by a user.
+CREATE TABLE IF NOT EXISTS service_accounts (
+  id SERIAL NOT NULL PRIMARY KEY,
+  name VARCHAR(80) NOT NULL,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  owner_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  role_id BIGINT NOT NULL REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- Client credentials of the service accounts.
+CREATE TABLE IF NOT EXISTS service_account_credentials (
+  id SERIAL NOT NULL PRIMARY KEY,
+  service_account_id BIGINT NOT NULL REFERENCES service_accounts (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  client_id VARCHAR(64) NOT NULL UNIQUE,
+  secret VARCHAR(255) NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS service_account_credentials_service_account_id_idx ON service_account_credentials (service_account_id);
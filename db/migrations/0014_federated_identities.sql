@@ -0,0 +1,13 @@
+-- Identity provider and LDAP accounts linked to users.
+CREATE TABLE IF NOT EXISTS federated_identities (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  provider VARCHAR(80) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  last_login_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS federated_identities_user_id_idx ON federated_identities (user_id);
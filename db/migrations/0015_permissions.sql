@@ -0,0 +1,20 @@
+-- Permissions of the features added since the first release. They are
+-- matched by name, an existing database may already use their IDs.
+INSERT INTO permissions ("name", "description") VALUES
+('revoke token',	'Can revoke tokens of other users'),
+('unlock user',	'Can lift the failed login lockout of a user'),
+('view session',	'Can list the sessions of any user'),
+('revoke session',	'Can sign out the sessions of any user'),
+('view client',	'Can view OAuth2 clients'),
+('create client',	'Can create OAuth2 clients'),
+('edit client',	'Can edit OAuth2 clients and regenerate their secrets'),
+('delete client',	'Can delete OAuth2 clients'),
+('view api key',	'Can list the API keys of any user'),
+('revoke api key',	'Can revoke the API keys of any user'),
+('view service account',	'Can view service accounts and their credentials'),
+('create service account',	'Can create service accounts'),
+('edit service account',	'Can edit service accounts and manage their credentials'),
+('delete service account',	'Can delete service accounts'),
+('provision users',	'Can manage users and groups through the SCIM API'),
+('impersonate user',	'Can act as another user to see what they see')
+ON CONFLICT ("name") DO NOTHING;
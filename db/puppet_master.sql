@@ -18,11 +18,130 @@ CREATE TABLE IF NOT EXISTS users (
   id SERIAL NOT NULL PRIMARY KEY,
   name VARCHAR(80) NOT NULL,
   email VARCHAR(80) NOT NULL UNIQUE,
-  password VARCHAR(80) NOT NULL,
+  password VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  email_verified_at TIMESTAMPTZ,
+  disabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+  id VARCHAR(64) NOT NULL PRIMARY KEY,
+  algorithm VARCHAR(10) NOT NULL,
+  private_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  activates_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  retired_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id BIGINT NOT NULL PRIMARY KEY REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  secret VARCHAR(64) NOT NULL,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  confirmed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  code VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  name VARCHAR(80) NOT NULL,
+  credential_id BYTEA NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  aaguid BYTEA,
+  last_used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS passkeys_user_id_idx ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS password_history (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  password VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS clients (
+  id SERIAL NOT NULL PRIMARY KEY,
+  client_id VARCHAR(64) NOT NULL UNIQUE,
+  name VARCHAR(80) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '',
+  redirect_uris TEXT NOT NULL DEFAULT '',
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  role_id BIGINT NOT NULL REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE,
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS api_keys (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  name VARCHAR(80) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  key_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS api_key_permission (
+  api_key_id BIGINT NOT NULL REFERENCES api_keys (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  permission_id BIGINT NOT NULL REFERENCES permissions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  PRIMARY KEY (api_key_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+  id SERIAL NOT NULL PRIMARY KEY,
+  name VARCHAR(80) NOT NULL,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  owner_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  role_id BIGINT NOT NULL REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS service_account_credentials (
+  id SERIAL NOT NULL PRIMARY KEY,
+  service_account_id BIGINT NOT NULL REFERENCES service_accounts (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  client_id VARCHAR(64) NOT NULL UNIQUE,
+  secret VARCHAR(255) NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS service_account_credentials_service_account_id_idx ON service_account_credentials (service_account_id);
+
+CREATE TABLE IF NOT EXISTS federated_identities (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  provider VARCHAR(80) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  last_login_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS federated_identities_user_id_idx ON federated_identities (user_id);
+
 CREATE TABLE IF NOT EXISTS permission_role (
   permission_id SMALLINT NOT NULL REFERENCES permissions (id) ON UPDATE CASCADE ON DELETE CASCADE,
   role_id SMALLINT NOT NULL REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE
@@ -54,13 +173,29 @@ INSERT INTO permissions ("id", "name", "description", "created_at", "updated_at"
 (18,	'get permissions by role name',	'Can get all permissions by role name',	'2021-04-05 16:16:11.306257+00',	'2021-04-05 16:16:11.306257+00'),
 (19,	'assign role by user id',	'Can assign role to a user',	'2021-04-05 16:56:57.919265+00',	'2021-04-05 16:56:57.919265+00'),
 (20,	'sync role by user id',	'Can sync user role',	'2021-04-05 16:57:24.087477+00',	'2021-04-05 16:57:24.087477+00'),
-(21,	'get role by user id',	'Can get user role',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00');
+(21,	'get role by user id',	'Can get user role',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(22,	'revoke token',	'Can revoke tokens of other users',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(23,	'unlock user',	'Can lift the failed login lockout of a user',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(24,	'view session',	'Can list the sessions of any user',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(25,	'revoke session',	'Can sign out the sessions of any user',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(26,	'view client',	'Can view OAuth2 clients',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(27,	'create client',	'Can create OAuth2 clients',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(28,	'edit client',	'Can edit OAuth2 clients and regenerate their secrets',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(29,	'delete client',	'Can delete OAuth2 clients',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(30,	'view api key',	'Can list the API keys of any user',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(31,	'revoke api key',	'Can revoke the API keys of any user',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(32,	'view service account',	'Can view service accounts and their credentials',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(33,	'create service account',	'Can create service accounts',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(34,	'edit service account',	'Can edit service accounts and manage their credentials',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(35,	'delete service account',	'Can delete service accounts',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(36,	'provision users',	'Can manage users and groups through the SCIM API',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00'),
+(37,	'impersonate user',	'Can act as another user to see what they see',	'2021-04-05 16:58:03.285812+00',	'2021-04-05 16:58:03.285812+00');
 
 INSERT INTO roles ("id", "name", "description", "created_at", "updated_at") VALUES
 (1,	'Admin',	'Admin of the system',	'2021-04-05 13:37:48.531415+00',	'2021-04-05 13:37:48.531415+00');
 
-INSERT INTO users ("id", "name", "email", "password", "created_at", "updated_at") VALUES
-(1,	'The Admin',	'admin@admin.com',	'$2a$06$DDKssq9NZAFGSGaLx8mjB.6Cl0NdnkQNSla49s8I6u1g8g7nmNK42',	'2021-04-05 13:38:57.594285+00',	'2021-04-05 13:38:57.594285+00');
+INSERT INTO users ("id", "name", "email", "password", "created_at", "updated_at", "email_verified_at") VALUES
+(1,	'The Admin',	'admin@admin.com',	'$2a$06$DDKssq9NZAFGSGaLx8mjB.6Cl0NdnkQNSla49s8I6u1g8g7nmNK42',	'2021-04-05 13:38:57.594285+00',	'2021-04-05 13:38:57.594285+00',	'2021-04-05 13:38:57.594285+00');
 
 INSERT INTO "role_user" ("role_id", "user_id") VALUES (1,	1);
 
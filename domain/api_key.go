@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey represent the personal API key's model. A key acts for its
+// owner with at most the given Permissions, only its hash is stored and
+// Prefix lets the owner recognize it.
+type APIKey struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" validate:"required,lte=80"`
+	Prefix      string     `json:"prefix"`
+	Hash        string     `json:"-" db:"key_hash"`
+	Permissions []string   `json:"permissions" db:"-" validate:"required,min=1"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// APIKeySecret holds an API key with its plain value, which is only
+// shown when it is created.
+type APIKeySecret struct {
+	APIKey *APIKey `json:"api_key"`
+	Key    string  `json:"key"`
+}
+
+// APIKeyUsecase represent the API key's usecases.
+type APIKeyUsecase interface {
+	Fetch(ctx context.Context, userID int64) ([]*APIKey, error)
+	Store(ctx context.Context, apiKey *APIKey) (*APIKeySecret, error)
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+// APIKeyRepository represent the API key's repository contract.
+type APIKeyRepository interface {
+	Fetch(ctx context.Context, userID int64) ([]*APIKey, error)
+	GetByID(ctx context.Context, id int64) (*APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	Store(ctx context.Context, apiKey *APIKey) (*APIKey, error)
+	Delete(ctx context.Context, id int64) error
+	Touch(ctx context.Context, id int64, usedAt time.Time) error
+}
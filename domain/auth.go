@@ -7,7 +7,19 @@ import (
 
 type contextKey int
 
-const ContextKeyID contextKey = iota
+const (
+	// ContextKeyID holds the "user" claim of the current access token.
+	ContextKeyID contextKey = iota
+	// ContextKeyClaims holds the *TokenClaims of the current access token.
+	ContextKeyClaims
+	// ContextKeyClientIP holds the IP address of the client.
+	ContextKeyClientIP
+	// ContextKeyUserAgent holds the User-Agent of the client.
+	ContextKeyUserAgent
+	// ContextKeyActor holds the "act" claim of an impersonation token,
+	// the admin acting as the user of ContextKeyID.
+	ContextKeyActor
+)
 
 // Auth represent the auth's model.
 type Auth struct {
@@ -19,10 +31,78 @@ type Auth struct {
 	Token    string `json:"token,omitempty"`
 }
 
-// AuthToken represent the token and refresh_token payload.
+// AuthToken represent the token and refresh_token payload. When the user
+// has multi-factor authentication enabled, only MFARequired and MFAToken
+// are set and the tokens are issued by VerifyMFA.
 type AuthToken struct {
 	Token        string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+// TokenClaims represent the verified claims of an access token. Tokens
+// of OAuth2 clients have a ClientID and no SessionID, the ones of service
+// accounts a ServiceAccountID. Requests made with an API key have an
+// APIKeyID and the APIKeyPermissions it is limited to. Impersonation
+// tokens name the admin acting as the user in Actor. The tokens of a
+// session handed over to a relying party name it in AuthorizedParty.
+type TokenClaims struct {
+	ID                string                 `json:"jti"`
+	SessionID         string                 `json:"sid,omitempty"`
+	ClientID          string                 `json:"client_id,omitempty"`
+	AuthorizedParty   string                 `json:"azp,omitempty"`
+	ServiceAccountID  int64                  `json:"svc,omitempty"`
+	Scopes            []string               `json:"scope,omitempty"`
+	APIKeyID          int64                  `json:"api_key_id,omitempty"`
+	APIKeyPermissions []string               `json:"api_key_permissions,omitempty"`
+	ExpiresAt         time.Time              `json:"exp"`
+	User              map[string]interface{} `json:"user"`
+	Actor             map[string]interface{} `json:"act,omitempty"`
+}
+
+// SelfServiceClaims returns the claims of the current request when they
+// may manage the credentials and sessions of their user. Only the tokens
+// of a login of the user may. API keys and the tokens of relying parties
+// only act with a part of the permissions of their user, an admin
+// impersonating the user could keep access to the account once the
+// impersonation is over, and clients and service accounts have no user.
+func SelfServiceClaims(ctx context.Context) (*TokenClaims, error) {
+	claims, ok := ctx.Value(ContextKeyClaims).(*TokenClaims)
+	if !ok ||
+		claims.APIKeyID != 0 ||
+		claims.Actor != nil ||
+		claims.AuthorizedParty != "" ||
+		claims.ClientID != "" ||
+		claims.ServiceAccountID != 0 {
+		return nil, ErrUnauthorized
+	}
+
+	return claims, nil
+}
+
+// TokenFamily represent the refresh token family's cache model.
+// Every refresh token issued from the same login shares a family and
+// only the latest one (Current) is allowed to be exchanged. A family
+// is the session of a device, see Session. Families started by an
+// OAuth2 authorization belong to the client and keep the granted scopes.
+type TokenFamily struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Current   string    `json:"current"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoginLimiter represent the lockout of failed logins, for the other
+// usecases checking secrets of a user.
+type LoginLimiter interface {
+	Check(ctx context.Context, email string) error
+	RecordFailure(ctx context.Context, email string) error
 }
 
 // AuthUsecase represent the auth's usecases.
@@ -30,14 +110,51 @@ type AuthUsecase interface {
 	Authenticate(ctx context.Context, email, password string) (*AuthToken, error)
 	Authorize(ctx context.Context, permission string, role []string) bool
 	GenerateToken(claimKey string, claimValue interface{}, expiration time.Time) (string, error)
-	RefreshToken(ctx context.Context, userID int64) (*AuthToken, error)
-	// ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) (bool, error)
-	// ResetPassword(ctx context.Context, email string) (bool, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*AuthToken, error)
+	ParseToken(ctx context.Context, token string) (*TokenClaims, error)
+	Logout(ctx context.Context) error
+	RevokeToken(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, oldPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string) (*AuthToken, error)
+	AuthenticateWithPasskey(ctx context.Context, credential string) (*AuthToken, error)
+	UnlockUser(ctx context.Context, userID int64) error
+	SendEmailVerification(ctx context.Context, userID int64) error
+	RequestEmailVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestMagicLink(ctx context.Context, email string) error
+	ConsumeMagicLink(ctx context.Context, token string) (*AuthToken, error)
+	FetchSessions(ctx context.Context, userID int64) ([]*Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeSessions(ctx context.Context, userID int64) error
+	RevokeUserAccess(ctx context.Context, userID int64) error
+	ClientCredentials(ctx context.Context, clientID, clientSecret, scope string) (*OAuthToken, error)
+	RevokeClientTokens(ctx context.Context, clientID string) error
+	ValidateAuthorizationRequest(ctx context.Context, req *AuthorizationRequest) (*Client, error)
+	IssueAuthorizationCode(ctx context.Context, req *AuthorizationRequest, token *AuthToken) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (*OAuthToken, error)
+	RefreshOAuthToken(ctx context.Context, clientID, clientSecret, refreshToken string) (*OAuthToken, error)
+	UserInfo(ctx context.Context) (map[string]interface{}, error)
+	OpenIDConfiguration() *OpenIDConfiguration
+	IntrospectToken(ctx context.Context, clientID, clientSecret, token string) (*Introspection, error)
+	RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error
+	ParseAPIKey(ctx context.Context, key string) (*TokenClaims, error)
+	RevokeServiceAccountTokens(ctx context.Context, serviceAccountID int64) error
+	FederatedLoginURL(ctx context.Context, provider string) (string, string, error)
+	FederatedCallback(ctx context.Context, provider, state, code string) (string, error)
+	ConsumeFederatedLogin(ctx context.Context, token string) (*AuthToken, error)
+	SAMLMetadata(ctx context.Context, provider string) ([]byte, error)
+	SAMLLoginURL(ctx context.Context, provider string) (string, string, error)
+	SAMLCallback(ctx context.Context, provider, relayState, response string) (string, error)
+	Impersonate(ctx context.Context, userID int64) (*AuthToken, error)
 }
 
 // AuthRepository represent the auth's repository contract.
 type AuthRepository interface {
 	Authenticate(ctx context.Context, email string) (*User, error)
-	// ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) (bool, error)
-	// ResetPassword(ctx context.Context, email string) (bool, error)
+	ChangePassword(ctx context.Context, userID int64, password string, history int) error
+	RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) error
+	PasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error)
+	VerifyEmail(ctx context.Context, userID int64, email string) error
 }
@@ -9,4 +9,11 @@ import (
 type CacheRepository interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string, destination interface{}) error
+	Delete(ctx context.Context, keys ...string) error
+	GetDelete(ctx context.Context, key string, destination interface{}) error
+	Increment(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	CompareAndSwap(ctx context.Context, key, field, old string, value interface{}, expiration time.Duration) (bool, error)
+	AddToSet(ctx context.Context, key, member string, expiration time.Duration) error
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	RemoveFromSet(ctx context.Context, key string, members ...string) error
 }
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Client represent the OAuth2 client's model. Machine clients get
+// tokens with the client_credentials grant and act with the permissions
+// of their role. Relying parties sign their users in with the
+// authorization_code grant and must register their RedirectURIs. Public
+// clients, like browser apps, have no secret. Scopes and RedirectURIs
+// are space separated lists.
+type Client struct {
+	ID           int64     `json:"id"`
+	ClientID     string    `json:"client_id" db:"client_id"`
+	Name         string    `json:"name" validate:"required"`
+	Secret       string    `json:"-"`
+	Scopes       string    `json:"scopes"`
+	RedirectURIs string    `json:"redirect_uris" db:"redirect_uris"`
+	Public       bool      `json:"public"`
+	RoleID       int64     `json:"role_id" db:"role_id" validate:"required"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ClientSecret holds a client with its plain secret, which is only
+// shown when it is created or regenerated. Public clients have none.
+type ClientSecret struct {
+	Client       *Client `json:"client"`
+	ClientSecret string  `json:"client_secret"`
+}
+
+// ClientUsecase represent the client's usecases.
+type ClientUsecase interface {
+	Fetch(ctx context.Context) ([]*Client, error)
+	GetByID(ctx context.Context, id int64) (*Client, error)
+	Store(ctx context.Context, client *Client) (*ClientSecret, error)
+	Update(ctx context.Context, client *Client) (*Client, error)
+	Delete(ctx context.Context, id int64) error
+	RegenerateSecret(ctx context.Context, id int64) (*ClientSecret, error)
+}
+
+// ClientRepository represent the client's repository contract.
+type ClientRepository interface {
+	Fetch(ctx context.Context) ([]*Client, error)
+	GetByID(ctx context.Context, id int64) (*Client, error)
+	GetByClientID(ctx context.Context, clientID string) (*Client, error)
+	Store(ctx context.Context, client *Client) (*Client, error)
+	Update(ctx context.Context, client *Client) (*Client, error)
+	UpdateSecret(ctx context.Context, id int64, secret string) error
+	Delete(ctx context.Context, id int64) error
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DirectoryUser represent a user found in an LDAP directory. A user
+// unknown to the directory has no DN.
+type DirectoryUser struct {
+	DN     string   `json:"dn"`
+	Name   string   `json:"name"`
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+// LDAPConfig represent the configuration of the LDAP or Active Directory
+// server users can sign in with.
+type LDAPConfig struct {
+	URL                string `mapstructure:"url"`
+	StartTLS           bool   `mapstructure:"start_tls"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	// BindDN and BindPassword are the service account that searches the
+	// users, an anonymous bind is used when BindDN is empty.
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+	BaseDN       string `mapstructure:"base_dn"`
+	// UserFilter finds the user signing in, {username} is replaced by
+	// what they typed in the email field.
+	UserFilter     string `mapstructure:"user_filter"`
+	NameAttribute  string `mapstructure:"name_attribute"`
+	EmailAttribute string `mapstructure:"email_attribute"`
+	// GroupAttribute is the attribute of the user listing their groups,
+	// like memberOf.
+	GroupAttribute string `mapstructure:"group_attribute"`
+	// GroupFilter searches the groups of the user under GroupBaseDN when
+	// the directory has no GroupAttribute, {dn} and {username} are
+	// replaced by the ones of the user.
+	GroupBaseDN string        `mapstructure:"group_base_dn"`
+	GroupFilter string        `mapstructure:"group_filter"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
+// DirectoryRepository represent the directory's repository contract.
+type DirectoryRepository interface {
+	Authenticate(ctx context.Context, username, password string) (*DirectoryUser, error)
+}
@@ -53,6 +53,103 @@ var (
 	ErrCacheMarshalling = errors.New("failed to marshal the cache")
 	// ErrCacheUnmarshalling will throw if failed to unmarshal the cache key
 	ErrCacheUnmarshalling = errors.New("failed to unmarshal the cache key")
+	// ErrDeleteCache will throw if failed to delete cache data
+	ErrDeleteCache = errors.New("failed to delete cache data")
+
+	// ErrInvalidRefreshToken will throw if the refresh token is invalid, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrInvalidToken will throw if the token is malformed, expired or has a bad signature
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenRevoked will throw if the token or its session has been revoked
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrWrongPassword will throw if the given current password does not match
+	ErrWrongPassword = errors.New("the current password is incorrect")
+	// ErrSamePassword will throw if the new password is equal to the current one
+	ErrSamePassword = errors.New("the new password must be different from the current one")
+	// ErrInvalidResetToken will throw if the password reset token is invalid, expired or already used
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	// ErrInvalidVerificationToken will throw if the email verification token is invalid, expired or outdated
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	// ErrInvalidMagicLink will throw if the magic link token is invalid, expired or already used
+	ErrInvalidMagicLink = errors.New("invalid or expired login link")
+	// ErrEmailNotVerified will throw if an unverified user tries to log in while verification is required
+	ErrEmailNotVerified = errors.New("the email address is not verified")
+	// ErrUserDisabled will throw if the account of the user is disabled
+	ErrUserDisabled = errors.New("the account is disabled")
+	// ErrTooManyAttempts will throw if a login is attempted too soon after failed ones
+	ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+	// ErrAccountLocked will throw if logins are temporarily locked after too many failed attempts
+	ErrAccountLocked = errors.New("too many failed login attempts, the login is temporarily locked")
+	// ErrRefreshTokenReused will throw if an already used refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+	// ErrMFANotEnrolled will throw if the user has no pending or enabled TOTP enrollment
+	ErrMFANotEnrolled = errors.New("multi-factor authentication is not enrolled")
+	// ErrMFAAlreadyEnabled will throw if the user tries to enroll again while TOTP is enabled
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	// ErrInvalidMFACode will throw if the TOTP or recovery code does not match
+	ErrInvalidMFACode = errors.New("invalid multi-factor authentication code")
+	// ErrInvalidMFAToken will throw if the MFA challenge token is invalid, expired or used too many times
+	ErrInvalidMFAToken = errors.New("invalid or expired multi-factor authentication token")
+
+	// ErrInvalidPasskey will throw if a passkey ceremony fails or the credential is unknown
+	ErrInvalidPasskey = errors.New("invalid passkey")
+	// ErrPasskeyExists will throw if the credential is already registered
+	ErrPasskeyExists = errors.New("passkey already registered")
+
+	// ErrInvalidRedirectURI will throw if a redirect URI of a client is not an absolute URL
+	ErrInvalidRedirectURI = errors.New("redirect URIs must be absolute URLs without a fragment")
+	// ErrPublicClient will throw if a secret is requested for a public client
+	ErrPublicClient = errors.New("public clients have no secret")
+
+	// ErrInvalidAPIKey will throw if the API key is unknown, revoked or expired
+	ErrInvalidAPIKey = errors.New("invalid or expired API key")
+	// ErrAPIKeyPermission will throw if an API key is given a permission its owner does not have
+	ErrAPIKeyPermission = errors.New("an API key can only be given permissions its owner has")
+	// ErrAPIKeyExpiration will throw if the expiration of an API key is not in the future
+	ErrAPIKeyExpiration = errors.New("the expiration of an API key must be in the future")
+
+	// ErrFederationProvider will throw if the identity provider is not configured
+	ErrFederationProvider = errors.New("unknown identity provider")
+	// ErrInvalidFederationState will throw if the callback of a federated login was not started here or expired
+	ErrInvalidFederationState = errors.New("invalid or expired login, please try again")
+	// ErrInvalidFederatedLogin will throw if the identity provider refused the login or its token is invalid
+	ErrInvalidFederatedLogin = errors.New("invalid or expired federated login")
+	// ErrFederationEmailNotVerified will throw if a new provider account has no verified email to link or create a user
+	ErrFederationEmailNotVerified = errors.New("the identity provider did not return a verified email address")
+	// ErrFederationLinkAdmin will throw if a new provider account would be linked to a user with the Admin role
+	ErrFederationLinkAdmin = errors.New("users with the Admin role cannot be linked to an identity provider account")
+	// ErrDirectoryInvalidCredentials will throw if the directory refuses the password of one of its users
+	ErrDirectoryInvalidCredentials = errors.New("the directory refused the credentials")
+	// ErrDirectoryUserEmail will throw if the directory entry of a user has no email
+	ErrDirectoryUserEmail = errors.New("the directory entry of the user has no email address")
+
+	// ErrSCIMInvalidFilter will throw if the filter of a SCIM request cannot be parsed
+	ErrSCIMInvalidFilter = errors.New("invalid SCIM filter")
+	// ErrSCIMInvalidPath will throw if the path of a SCIM PATCH operation cannot be parsed
+	ErrSCIMInvalidPath = errors.New("invalid SCIM attribute path")
+	// ErrSCIMNoTarget will throw if the path of a SCIM PATCH operation matches no value
+	ErrSCIMNoTarget = errors.New("the SCIM attribute path matches no value")
+	// ErrSCIMInvalidValue will throw if a SCIM resource or PATCH operation has an invalid value
+	ErrSCIMInvalidValue = errors.New("invalid SCIM value")
+	// ErrSCIMUniqueness will throw if the email of a SCIM user or the name of a group is taken
+	ErrSCIMUniqueness = errors.New("the userName or displayName is already taken")
+	// ErrSCIMAdmin will throw if SCIM tries to change the Admin role or one of its users
+	ErrSCIMAdmin = errors.New("the Admin role and its users cannot be changed through SCIM")
+	// ErrImpersonateAdmin will throw if the user to impersonate has the Admin role
+	ErrImpersonateAdmin = errors.New("users with the Admin role cannot be impersonated")
+	// ErrImpersonatePermissions will throw if the user to impersonate has a permission the admin does not have
+	ErrImpersonatePermissions = errors.New("users with permissions you do not have cannot be impersonated")
+
+	// ErrRotateKey will throw if failed to rotate the signing key
+	ErrRotateKey = errors.New("failed to rotate the signing key")
+	// ErrKeyEncryptionKey will throw if the key encryption key is missing or is not 32 bytes encoded in base64
+	ErrKeyEncryptionKey = errors.New("jwt.key_encryption_key must be 32 bytes encoded in base64")
+	// ErrSigningKeyRequired will throw if no signing key is stored nor configured for an asymmetric algorithm
+	ErrSigningKeyRequired = errors.New("no signing key: set jwt.private_key or generate one with rotate-keys")
+
+	// ErrSendMail will throw if failed to send an email
+	ErrSendMail = errors.New("failed to send email")
 
 	// ErrUserID will throw if the ID is invalid
 	ErrUserID = errors.New("invalid user id")
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// FederatedIdentity represent the link between a user and their account
+// at an external identity provider, identified by the provider name and
+// the subject the provider gave them.
+type FederatedIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at" db:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// FederationProvider represent the configuration of an external OpenID
+// Connect identity provider users can sign in with.
+type FederationProvider struct {
+	// Name identifies the provider in the login and callback URLs.
+	Name         string   `mapstructure:"name"`
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+	// GroupsClaim is the ID token claim holding the groups of the user.
+	GroupsClaim string `mapstructure:"groups_claim"`
+	// RoleMapping gives the role of the users of a group, the first
+	// mapping that matches wins.
+	RoleMapping []FederationRoleMapping `mapstructure:"role_mapping"`
+	// DefaultRole is given to the users created on their first login
+	// when no mapping matches.
+	DefaultRole string `mapstructure:"default_role"`
+}
+
+// SAMLProvider represent the configuration of an external SAML 2.0
+// identity provider users can sign in with.
+type SAMLProvider struct {
+	// Name identifies the provider in the metadata, login and assertion
+	// consumer service URLs.
+	Name string `mapstructure:"name"`
+	// EntityID, SSOURL and Certificate come from the metadata of the
+	// identity provider. Certificate holds the PEM encoded certificates
+	// it signs with.
+	EntityID    string `mapstructure:"entity_id"`
+	SSOURL      string `mapstructure:"sso_url"`
+	Certificate string `mapstructure:"certificate"`
+	// EmailAttribute and NameAttribute are the attributes of the
+	// assertion holding the email and name of the user, the subject is
+	// used as email when EmailAttribute is empty.
+	EmailAttribute string `mapstructure:"email_attribute"`
+	NameAttribute  string `mapstructure:"name_attribute"`
+	// TrustedEmailDomains are the domains whose emails the provider is
+	// trusted to assert. SAML has no verified flag, accounts with other
+	// emails cannot be linked or created.
+	TrustedEmailDomains []string `mapstructure:"trusted_email_domains"`
+	// GroupsAttribute is the attribute of the assertion holding the
+	// groups of the user.
+	GroupsAttribute string                  `mapstructure:"groups_attribute"`
+	RoleMapping     []FederationRoleMapping `mapstructure:"role_mapping"`
+	DefaultRole     string                  `mapstructure:"default_role"`
+}
+
+// FederationRoleMapping maps a group of an identity provider to a role.
+type FederationRoleMapping struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// FederatedIdentityRepository represent the federated identity's repository contract.
+type FederatedIdentityRepository interface {
+	GetBySubject(ctx context.Context, provider, subject string) (*FederatedIdentity, error)
+	GetByUserID(ctx context.Context, provider string, userID int64) (*FederatedIdentity, error)
+	Store(ctx context.Context, identity *FederatedIdentity) (*FederatedIdentity, error)
+	Touch(ctx context.Context, id int64, email string, loginAt time.Time) error
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// SigningKey represent the JWT signing key's model.
+//
+// The active key is the newest one past its ActivatesAt. A new key is
+// published before ActivatesAt, so verifiers know it before it signs.
+// Retired keys are only used to verify the tokens they signed and are
+// deleted once ExpiresAt is reached. The PrivateKey is sealed with the
+// key encryption key.
+type SigningKey struct {
+	ID          string     `json:"id"`
+	Algorithm   string     `json:"algorithm"`
+	PrivateKey  string     `json:"-" db:"private_key"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at" db:"activates_at"`
+	RetiredAt   *time.Time `json:"retired_at" db:"retired_at"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// KeyUsecase represent the signing key's usecases.
+type KeyUsecase interface {
+	Load(ctx context.Context) error
+	Rotate(ctx context.Context) (*SigningKey, error)
+	RotateIfDue(ctx context.Context) (bool, error)
+}
+
+// KeyRepository represent the signing key's repository contract.
+type KeyRepository interface {
+	Fetch(ctx context.Context) ([]*SigningKey, error)
+	Store(ctx context.Context, key *SigningKey) error
+	Rotate(ctx context.Context, key *SigningKey, expiresAt time.Time) error
+	UpdatePrivateKey(ctx context.Context, id, privateKey string) error
+	DeleteExpired(ctx context.Context) error
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "context"
+
+// Mail represent an outgoing email.
+type Mail struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer represent the mail delivery contract.
+type Mailer interface {
+	Send(ctx context.Context, mail *Mail) error
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// MFA represent the TOTP enrollment of a user. It is only enforced
+// once ConfirmedAt is set.
+type MFA struct {
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Secret       string     `json:"-"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	ConfirmedAt  *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// MFAEnrollment represent the secret of a pending TOTP enrollment and
+// its otpauth:// provisioning URI.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFAChallenge represent the cache model of a login waiting for the
+// second factor.
+type MFAChallenge struct {
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MFAUsecase represent the mfa's usecases.
+type MFAUsecase interface {
+	Enroll(ctx context.Context) (*MFAEnrollment, error)
+	Confirm(ctx context.Context, code string) ([]string, error)
+	Disable(ctx context.Context, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error)
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	Verify(ctx context.Context, userID int64, code string) error
+}
+
+// MFARepository represent the mfa's repository contract.
+type MFARepository interface {
+	GetByUserID(ctx context.Context, userID int64) (*MFA, error)
+	Store(ctx context.Context, mfa *MFA) error
+	Confirm(ctx context.Context, userID int64, recoveryCodes []string) error
+	Delete(ctx context.Context, userID int64) error
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, recoveryCode string) (bool, error)
+}
@@ -0,0 +1,127 @@
+package domain
+
+import "time"
+
+// OAuthToken represent the token response of the OAuth2 token endpoint
+// (RFC 6749 section 5.1). IDToken is only set when the openid scope was
+// granted.
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthScope represent a scope clients can be granted and the
+// permissions it allows, from the oauth.scopes config.
+type OAuthScope struct {
+	Name        string   `mapstructure:"name"`
+	Permissions []string `mapstructure:"permissions"`
+}
+
+// Introspection represent the token introspection response (RFC 7662
+// section 2.2). Inactive tokens only have Active set. Role and
+// Permissions are the ones Authorize checks the token against, Actor
+// the "act" claim of an impersonation token.
+type Introspection struct {
+	Active      bool                   `json:"active"`
+	Scope       string                 `json:"scope,omitempty"`
+	ClientID    string                 `json:"client_id,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	TokenType   string                 `json:"token_type,omitempty"`
+	ExpiresAt   int64                  `json:"exp,omitempty"`
+	Subject     string                 `json:"sub,omitempty"`
+	JwtID       string                 `json:"jti,omitempty"`
+	SessionID   string                 `json:"sid,omitempty"`
+	Role        string                 `json:"role,omitempty"`
+	Permissions []string               `json:"permissions,omitempty"`
+	Actor       map[string]interface{} `json:"act,omitempty"`
+}
+
+// AuthorizationRequest represent an OAuth2 authorization request (RFC
+// 6749 section 4.1.1) with its PKCE (RFC 7636) and OpenID Connect
+// parameters.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationCode represent the authorization code's cache model. It
+// holds the session of the login until the client exchanges it for
+// tokens of its own.
+type AuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"code_challenge"`
+	UserID        int64     `json:"user_id"`
+	SessionID     string    `json:"session_id"`
+	AuthTime      time.Time `json:"auth_time"`
+}
+
+// OpenIDConfiguration represent the OpenID Connect discovery document
+// (OpenID Connect Discovery 1.0 section 3).
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// OAuthError represent an OAuth2 error response (RFC 6749 section 5.2).
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+var (
+	// ErrOAuthInvalidRequest will throw if the token request is malformed
+	ErrOAuthInvalidRequest = &OAuthError{"invalid_request", "the request is missing a parameter or is malformed"}
+	// ErrOAuthInvalidClient will throw if the client authentication failed
+	ErrOAuthInvalidClient = &OAuthError{"invalid_client", "client authentication failed"}
+	// ErrOAuthInvalidGrant will throw if the grant is invalid, expired or revoked
+	ErrOAuthInvalidGrant = &OAuthError{"invalid_grant", "the grant is invalid, expired or revoked"}
+	// ErrOAuthUnauthorizedClient will throw if the client may not use the grant type
+	ErrOAuthUnauthorizedClient = &OAuthError{"unauthorized_client", "the client is not allowed to use this grant type"}
+	// ErrOAuthUnsupportedGrantType will throw if the grant type is not supported
+	ErrOAuthUnsupportedGrantType = &OAuthError{"unsupported_grant_type", "the grant type is not supported"}
+	// ErrOAuthInvalidScope will throw if a requested scope is not allowed for the client
+	ErrOAuthInvalidScope = &OAuthError{"invalid_scope", "the requested scope is invalid or not allowed"}
+	// ErrOAuthInvalidRedirectURI will throw if the redirect_uri is not registered for the client.
+	// The user must not be redirected to it.
+	ErrOAuthInvalidRedirectURI = &OAuthError{"invalid_request", "the redirect_uri is not registered for the client"}
+	// ErrOAuthUnsupportedResponseType will throw if the response type is not supported
+	ErrOAuthUnsupportedResponseType = &OAuthError{"unsupported_response_type", "the response type is not supported"}
+	// ErrOAuthPKCERequired will throw if the authorization request has no S256 code challenge
+	ErrOAuthPKCERequired = &OAuthError{"invalid_request", "a S256 code_challenge is required"}
+	// ErrOAuthAccessDenied will throw if the user denied the authorization request
+	ErrOAuthAccessDenied = &OAuthError{"access_denied", "the user denied the request"}
+	// ErrOAuthInvalidToken will throw if the access token is missing, invalid or does not belong to a user
+	ErrOAuthInvalidToken = &OAuthError{"invalid_token", "the access token is invalid"}
+	// ErrOAuthInsufficientScope will throw if the access token was not granted the required scope
+	ErrOAuthInsufficientScope = &OAuthError{"insufficient_scope", "the access token was not granted the required scope"}
+	// ErrOAuthIntrospectionDenied will throw if the client does not have the introspect scope
+	ErrOAuthIntrospectionDenied = &OAuthError{"unauthorized_client", "the client is not allowed to introspect tokens"}
+)
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Passkey represent a WebAuthn credential registered by a user.
+type Passkey struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID []byte     `json:"-" db:"credential_id"`
+	PublicKey    []byte     `json:"-" db:"public_key"`
+	SignCount    int64      `json:"-" db:"sign_count"`
+	AAGUID       []byte     `json:"-" db:"aaguid"`
+	LastUsedAt   *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PasskeyChallenge represent the cache model of a pending WebAuthn
+// ceremony. UserID is zero for a passwordless login, where the user is
+// only known once the credential is presented.
+type PasskeyChallenge struct {
+	UserID       int64 `json:"user_id"`
+	Registration bool  `json:"registration"`
+}
+
+// PasskeyUsecase represent the passkey's usecases.
+type PasskeyUsecase interface {
+	Fetch(ctx context.Context) ([]*Passkey, error)
+	BeginRegistration(ctx context.Context) (string, error)
+	FinishRegistration(ctx context.Context, name, credential string) (*Passkey, error)
+	BeginLogin(ctx context.Context, email string) (string, error)
+	FinishLogin(ctx context.Context, credential string) (userID int64, userVerified bool, err error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// PasskeyRepository represent the passkey's repository contract.
+type PasskeyRepository interface {
+	Fetch(ctx context.Context, userID int64) ([]*Passkey, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error)
+	Store(ctx context.Context, passkey *Passkey) (*Passkey, error)
+	UpdateSignCount(ctx context.Context, id, signCount int64) error
+	Delete(ctx context.Context, id, userID int64) error
+}
@@ -39,4 +39,6 @@ type RoleRepository interface {
 	AssignRoleToUser(ctx context.Context, role int, userID int64) error
 	RemoveRoleToUser(ctx context.Context, role int, userID int64) error
 	SyncRoleToUser(ctx context.Context, role int, userID int64) error
+	GetUsersByRoleID(ctx context.Context, roleID int64) ([]*User, error)
+	GetRolesByUserIDs(ctx context.Context, userIDs []int64) (map[int64]*Role, error)
 }
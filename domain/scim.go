@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// SCIMUser represent a user of the SCIM provisioning API (RFC 7643
+// section 4.1). The userName is the email of the user and the groups are
+// read only, membership is managed through the groups.
+type SCIMUser struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id,omitempty"`
+	UserName    string        `json:"userName"`
+	Name        *SCIMName     `json:"name,omitempty"`
+	DisplayName string        `json:"displayName,omitempty"`
+	Emails      []*SCIMEmail  `json:"emails,omitempty"`
+	Active      *bool         `json:"active,omitempty"`
+	Password    string        `json:"password,omitempty"`
+	Groups      []*SCIMMember `json:"groups,omitempty"`
+	Meta        *SCIMMeta     `json:"meta,omitempty"`
+}
+
+// SCIMName represent the name of a SCIM user.
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMEmail represent an email of a SCIM user.
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMGroup represent a group of the SCIM provisioning API (RFC 7643
+// section 4.2). A group is a role and its members are the users with
+// the role, so a user is a member of one group at most.
+type SCIMGroup struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id,omitempty"`
+	DisplayName string        `json:"displayName"`
+	Members     []*SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta     `json:"meta,omitempty"`
+}
+
+// SCIMMember represent a member of a SCIM group, or a group of a user.
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMMeta represent the metadata of a SCIM resource.
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMQuery represent the filter and the page of a SCIM list request. A
+// nil Count returns the default page size.
+type SCIMQuery struct {
+	Filter     string
+	StartIndex int
+	Count      *int
+}
+
+// SCIMListResponse represent a page of SCIM resources.
+type SCIMListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// SCIMPatch represent a SCIM PATCH request.
+type SCIMPatch struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []*SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation represent an operation of a SCIM PATCH request.
+type SCIMPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// SCIMUsecase represent the SCIM provisioning usecases.
+type SCIMUsecase interface {
+	FetchUsers(ctx context.Context, query *SCIMQuery) (*SCIMListResponse, error)
+	GetUser(ctx context.Context, id int64) (*SCIMUser, error)
+	StoreUser(ctx context.Context, user *SCIMUser) (*SCIMUser, error)
+	ReplaceUser(ctx context.Context, id int64, user *SCIMUser) (*SCIMUser, error)
+	PatchUser(ctx context.Context, id int64, patch *SCIMPatch) (*SCIMUser, error)
+	DeleteUser(ctx context.Context, id int64) error
+
+	FetchGroups(ctx context.Context, query *SCIMQuery) (*SCIMListResponse, error)
+	GetGroup(ctx context.Context, id int64) (*SCIMGroup, error)
+	StoreGroup(ctx context.Context, group *SCIMGroup) (*SCIMGroup, error)
+	ReplaceGroup(ctx context.Context, id int64, group *SCIMGroup) (*SCIMGroup, error)
+	PatchGroup(ctx context.Context, id int64, patch *SCIMPatch) (*SCIMGroup, error)
+	DeleteGroup(ctx context.Context, id int64) error
+}
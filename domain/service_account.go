@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceAccountClientPrefix starts the client ID of every service
+// account credential, which tells them apart from OAuth2 clients.
+const ServiceAccountClientPrefix = "sa_"
+
+// ServiceAccount represent the service account's model. A service
+// account is a principal that is not a person: it has no email nor
+// password, it acts with the permissions of its role and it signs in
+// with the client credentials of its ServiceAccountCredentials.
+type ServiceAccount struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name" validate:"required,lte=80"`
+	Description string    `json:"description" validate:"lte=255"`
+	OwnerID     int64     `json:"owner_id" db:"owner_id"`
+	RoleID      int64     `json:"role_id" db:"role_id" validate:"required"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ServiceAccountCredential represent a client ID and secret pair of a
+// service account, exchanged for tokens with the client_credentials
+// grant. Only the hash of the secret is stored.
+type ServiceAccountCredential struct {
+	ID               int64      `json:"id"`
+	ServiceAccountID int64      `json:"service_account_id" db:"service_account_id"`
+	ClientID         string     `json:"client_id" db:"client_id"`
+	Secret           string     `json:"-"`
+	LastUsedAt       *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ServiceAccountSecret holds a credential with its plain secret, which is
+// only shown when it is created.
+type ServiceAccountSecret struct {
+	Credential   *ServiceAccountCredential `json:"credential"`
+	ClientSecret string                    `json:"client_secret"`
+}
+
+// ServiceAccountUsecase represent the service account's usecases.
+type ServiceAccountUsecase interface {
+	Fetch(ctx context.Context) ([]*ServiceAccount, error)
+	GetByID(ctx context.Context, id int64) (*ServiceAccount, error)
+	Store(ctx context.Context, serviceAccount *ServiceAccount) (*ServiceAccount, error)
+	Update(ctx context.Context, serviceAccount *ServiceAccount) (*ServiceAccount, error)
+	Delete(ctx context.Context, id int64) error
+
+	FetchCredentials(ctx context.Context, id int64) ([]*ServiceAccountCredential, error)
+	CreateCredential(ctx context.Context, id int64) (*ServiceAccountSecret, error)
+	DeleteCredential(ctx context.Context, id, credentialID int64) error
+}
+
+// ServiceAccountRepository represent the service account's repository contract.
+type ServiceAccountRepository interface {
+	Fetch(ctx context.Context) ([]*ServiceAccount, error)
+	GetByID(ctx context.Context, id int64) (*ServiceAccount, error)
+	Store(ctx context.Context, serviceAccount *ServiceAccount) (*ServiceAccount, error)
+	Update(ctx context.Context, serviceAccount *ServiceAccount) (*ServiceAccount, error)
+	Delete(ctx context.Context, id int64) error
+
+	FetchCredentials(ctx context.Context, serviceAccountID int64) ([]*ServiceAccountCredential, error)
+	GetCredentialByClientID(ctx context.Context, clientID string) (*ServiceAccountCredential, error)
+	StoreCredential(ctx context.Context, credential *ServiceAccountCredential) (*ServiceAccountCredential, error)
+	DeleteCredential(ctx context.Context, serviceAccountID, id int64) error
+	TouchCredential(ctx context.Context, id int64, usedAt time.Time) error
+}
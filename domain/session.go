@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Session represent a signed in device. Its ID is the ID of the refresh
+// token family and the "sid" claim of its access tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set on the session of the request.
+	Current bool `json:"current"`
+}
+
+// SessionActivity represent the session's last activity cache model. It
+// is kept apart from the TokenFamily so recording it never races with
+// the refresh token rotation.
+type SessionActivity struct {
+	SeenAt time.Time `json:"seen_at"`
+	IP     string    `json:"ip"`
+}
@@ -13,6 +13,12 @@ type User struct {
 	Password  string    `json:"-"`
 	UpdatedAt time.Time `json:"updated_at" db:"created_at"`
 	CreatedAt time.Time `json:"created_at" db:"updated_at"`
+	// EmailVerifiedAt is nil until the user follows the verification
+	// link, and again after the email is changed.
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	// DisabledAt is set while the account is disabled, a disabled user
+	// cannot sign in.
+	DisabledAt *time.Time `json:"disabled_at" db:"disabled_at"`
 }
 
 // UserCache represent the user's cache model.
@@ -34,8 +40,10 @@ type UserUsecase interface {
 // UserRepository represent the user's repository contract.
 type UserRepository interface {
 	Fetch(ctx context.Context) ([]*User, error)
+	FetchPage(ctx context.Context, email string, offset, limit int) ([]*User, int, error)
 	GetByID(ctx context.Context, id int64) (*User, error)
 	Store(ctx context.Context, user *User) (*User, error)
 	Update(ctx context.Context, user *User) (*User, error)
 	Delete(ctx context.Context, id int64) error
+	SetDisabledAt(ctx context.Context, id int64, disabledAt *time.Time) error
 }
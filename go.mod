@@ -3,10 +3,16 @@ module github.com/cyruzin/puppet_master
 go 1.16
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/beevik/etree v1.1.0
 	github.com/cockroachdb/apd v1.1.0 // indirect
+	github.com/fxamacker/cbor/v2 v2.3.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
 	github.com/go-chi/chi/v5 v5.0.2
 	github.com/go-chi/cors v1.2.0
 	github.com/go-chi/render v1.0.1
+	github.com/go-ldap/ldap/v3 v3.3.0
 	github.com/go-playground/validator/v10 v10.4.1
 	github.com/go-redis/redis/v8 v8.8.0
 	github.com/gofrs/uuid v4.0.0+incompatible // indirect
@@ -18,6 +24,7 @@ require (
 	github.com/lestrrat-go/jwx v1.1.5
 	github.com/mitchellh/mapstructure v1.4.1 // indirect
 	github.com/rs/zerolog v1.20.0
+	github.com/russellhaering/goxmldsig v1.4.0
 	github.com/shopspring/decimal v1.2.0 // indirect
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/objx v0.3.0 // indirect
@@ -25,7 +32,6 @@ require (
 	golang.org/x/crypto v0.0.0-20210317152858-513c2a44f670
 	golang.org/x/sys v0.0.0-20210319071255-635bc2c9138d // indirect
 	golang.org/x/text v0.3.5 // indirect
-	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
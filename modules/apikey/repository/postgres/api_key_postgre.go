@@ -0,0 +1,200 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreAPIKeyRepository will create an object that represent
+// the apikey.Repository interface.
+func NewPostgreAPIKeyRepository(Conn *sqlx.DB) domain.APIKeyRepository {
+	return &postgreRepository{Conn}
+}
+
+const apiKeyColumns = `
+	id,
+	user_id,
+	name,
+	prefix,
+	key_hash,
+	expires_at,
+	last_used_at,
+	created_at
+`
+
+func (p *postgreRepository) Fetch(ctx context.Context, userID int64) ([]*domain.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY id"
+
+	apiKeys := []*domain.APIKey{}
+
+	err := p.Conn.SelectContext(ctx, &apiKeys, query, userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	for _, apiKey := range apiKeys {
+		if err := p.permissions(ctx, apiKey); err != nil {
+			return nil, domain.ErrFetchError
+		}
+	}
+
+	return apiKeys, nil
+}
+
+func (p *postgreRepository) GetByID(ctx context.Context, id int64) (*domain.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1"
+
+	return p.get(ctx, query, id)
+}
+
+func (p *postgreRepository) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = $1"
+
+	return p.get(ctx, query, hash)
+}
+
+func (p *postgreRepository) get(ctx context.Context, query string, arg interface{}) (*domain.APIKey, error) {
+	var apiKey domain.APIKey
+
+	err := p.Conn.GetContext(ctx, &apiKey, query, arg)
+	if err == sql.ErrNoRows {
+		return &apiKey, nil
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	if err := p.permissions(ctx, &apiKey); err != nil {
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &apiKey, nil
+}
+
+// permissions loads the names of the permissions of the given key.
+func (p *postgreRepository) permissions(ctx context.Context, apiKey *domain.APIKey) error {
+	query := `
+		SELECT p.name
+		FROM permissions p
+		JOIN api_key_permission akp ON akp.permission_id = p.id
+		WHERE akp.api_key_id = $1
+		ORDER BY p.name
+	`
+
+	apiKey.Permissions = []string{}
+
+	err := p.Conn.SelectContext(ctx, &apiKey.Permissions, query, apiKey.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Store(ctx context.Context, apiKey *domain.APIKey) (*domain.APIKey, error) {
+	tx, err := p.Conn.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO api_keys (
+			user_id,
+			name,
+			prefix,
+			key_hash,
+			expires_at,
+			created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err = tx.GetContext(
+		ctx,
+		&apiKey.ID,
+		query,
+		apiKey.UserID,
+		apiKey.Name,
+		apiKey.Prefix,
+		apiKey.Hash,
+		apiKey.ExpiresAt,
+		apiKey.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	query = `
+		INSERT INTO api_key_permission (api_key_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = $2
+	`
+
+	for _, permission := range apiKey.Permissions {
+		if _, err = tx.ExecContext(ctx, query, apiKey.ID, permission); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, domain.ErrStoreError
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	return apiKey, nil
+}
+
+func (p *postgreRepository) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM api_keys WHERE id = $1"
+
+	result, err := p.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Touch(ctx context.Context, id int64, usedAt time.Time) error {
+	query := "UPDATE api_keys SET last_used_at = $1 WHERE id = $2"
+
+	if _, err := p.Conn.ExecContext(ctx, query, usedAt, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+// keyPrefix starts every API key, so leaked keys are easy to spot by
+// people and secret scanners.
+const keyPrefix = "pm_"
+
+// displayedKeyLength is how much of a key is kept in clear to let its
+// owner recognize it.
+const displayedKeyLength = len(keyPrefix) + 8
+
+type apiKeyUseCase struct {
+	apiKeyRepo     domain.APIKeyRepository
+	permissionRepo domain.PermissionRepository
+	roleRepo       domain.RoleRepository
+}
+
+// NewAPIKeyUsecase will create new an apiKeyUsecase object representation
+// of domain.APIKeyUsecase interface.
+func NewAPIKeyUsecase(
+	apiKey domain.APIKeyRepository,
+	permission domain.PermissionRepository,
+	role domain.RoleRepository,
+) domain.APIKeyUsecase {
+	return &apiKeyUseCase{
+		apiKeyRepo:     apiKey,
+		permissionRepo: permission,
+		roleRepo:       role,
+	}
+}
+
+func (a *apiKeyUseCase) Fetch(ctx context.Context, userID int64) ([]*domain.APIKey, error) {
+	apiKeys, err := a.apiKeyRepo.Fetch(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// Store creates an API key for its owner. The key can only be given
+// permissions the owner has, and it is returned this one time.
+func (a *apiKeyUseCase) Store(ctx context.Context, apiKey *domain.APIKey) (*domain.APIKeySecret, error) {
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(time.Now()) {
+		return nil, domain.ErrAPIKeyExpiration
+	}
+
+	permissions, err := a.grantablePermissions(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := []string{}
+
+	for _, permission := range apiKey.Permissions {
+		if !permissions[permission] {
+			return nil, domain.ErrAPIKeyPermission
+		}
+
+		if !contains(requested, permission) {
+			requested = append(requested, permission)
+		}
+	}
+
+	if len(requested) == 0 {
+		return nil, domain.ErrAPIKeyPermission
+	}
+
+	random, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	key := keyPrefix + random
+
+	apiKey.Permissions = requested
+	apiKey.Prefix = key[:displayedKeyLength]
+	apiKey.Hash = crypto.HashToken(key)
+	apiKey.CreatedAt = time.Now()
+
+	newAPIKey, err := a.apiKeyRepo.Store(ctx, apiKey)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	log.Info().
+		Str("event", "api_key_created").
+		Int64("user_id", apiKey.UserID).
+		Int64("api_key_id", newAPIKey.ID).
+		Strs("permissions", requested).
+		Msg("API key created")
+
+	return &domain.APIKeySecret{APIKey: newAPIKey, Key: key}, nil
+}
+
+// Delete revokes an API key of the given user.
+func (a *apiKeyUseCase) Delete(ctx context.Context, userID, id int64) error {
+	apiKey, err := a.apiKeyRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if apiKey.ID == 0 || apiKey.UserID != userID {
+		return domain.ErrNotFound
+	}
+
+	if err := a.apiKeyRepo.Delete(ctx, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "api_key_revoked").
+		Int64("user_id", userID).
+		Int64("api_key_id", id).
+		Msg("API key revoked")
+
+	return nil
+}
+
+// grantablePermissions returns the permissions the given user may put
+// on a key. Admins are allowed everything without holding permissions,
+// so they may grant any of them.
+func (a *apiKeyUseCase) grantablePermissions(ctx context.Context, userID int64) (map[string]bool, error) {
+	role, err := a.roleRepo.GetRoleByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	var permissions []*domain.Permission
+
+	if role.Name == "Admin" {
+		permissions, err = a.permissionRepo.Fetch(ctx)
+	} else {
+		permissions, err = a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	grantable := map[string]bool{}
+
+	for _, permission := range permissions {
+		grantable[permission.Name] = true
+	}
+
+	return grantable, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/enc"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// AuthHandler represent the http handler for auth.
+type AuthHandler struct {
+	AuthUseCase domain.AuthUsecase
+	Keyring     *keyring.Keyring
+}
+
+// NewAuthHandler will initialize the auth resources endpoint.
+func NewAuthHandler(c *chi.Mux, auth domain.AuthUsecase, k *keyring.Keyring) {
+	handler := &AuthHandler{
+		AuthUseCase: auth,
+		Keyring:     k,
+	}
+
+	c.Get("/.well-known/jwks.json", handler.JWKS)
+	c.Get("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+	c.Get("/authorize", handler.Authorize)
+	c.Post("/authorize", handler.Authorize)
+	c.Post("/oauth/token", handler.Token)
+	c.Post("/oauth/introspect", handler.Introspect)
+	c.Post("/oauth/revoke", handler.Revoke)
+	c.Get("/userinfo", handler.UserInfo)
+	c.Post("/userinfo", handler.UserInfo)
+	c.Get("/federation/{provider}/login", handler.FederatedLogin)
+	c.Get("/federation/{provider}/callback", handler.FederatedCallback)
+	c.Get("/saml/{provider}/metadata", handler.SAMLMetadata)
+	c.Get("/saml/{provider}/login", handler.SAMLLogin)
+	c.Post("/saml/{provider}/acs", handler.SAMLAssertionConsumer)
+}
+
+// JWKS serves the public keys used to verify the issued tokens.
+func (a *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := a.Keyring.PublicKeys()
+	if err != nil {
+		enc.EncodeError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	enc.EncodeJSON(w, http.StatusOK, set)
+}
+
+// Token is the OAuth2 token endpoint (RFC 6749 section 3.2) for the
+// client_credentials, authorization_code and refresh_token grants.
+// Clients authenticate with HTTP Basic or with the client_id and
+// client_secret form parameters, public clients only send client_id.
+func (a *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		encodeOAuthError(w, r, domain.ErrOAuthInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	var token *domain.OAuthToken
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		token, err = a.AuthUseCase.ClientCredentials(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("scope"),
+		)
+	case "authorization_code":
+		token, err = a.AuthUseCase.ExchangeAuthorizationCode(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case "refresh_token":
+		token, err = a.AuthUseCase.RefreshOAuthToken(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("refresh_token"),
+		)
+	case "":
+		err = domain.ErrOAuthInvalidRequest
+	default:
+		err = domain.ErrOAuthUnsupportedGrantType
+	}
+
+	if err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	enc.EncodeJSON(w, http.StatusOK, token)
+}
+
+// Introspect is the token introspection endpoint (RFC 7662 section 2).
+// The token_type_hint parameter is not needed, both kinds of token are
+// looked up.
+func (a *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		encodeOAuthError(w, r, domain.ErrOAuthInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	introspection, err := a.AuthUseCase.IntrospectToken(
+		r.Context(),
+		clientID,
+		clientSecret,
+		r.PostForm.Get("token"),
+	)
+	if err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	enc.EncodeJSON(w, http.StatusOK, introspection)
+}
+
+// Revoke is the token revocation endpoint (RFC 7009 section 2). It
+// answers 200 for unknown tokens as well.
+func (a *AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		encodeOAuthError(w, r, domain.ErrOAuthInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	if err := a.AuthUseCase.RevokeOAuthToken(
+		r.Context(),
+		clientID,
+		clientSecret,
+		r.PostForm.Get("token"),
+	); err != nil {
+		encodeOAuthError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientCredentials reads the client credentials of a request. Using
+// both authentication methods at once is not allowed.
+func clientCredentials(r *http.Request) (string, string, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), nil
+	}
+
+	if r.PostForm.Get("client_secret") != "" {
+		return "", "", domain.ErrOAuthInvalidRequest
+	}
+
+	// The credentials are form encoded before being put in the header.
+	clientID, err := url.QueryUnescape(clientID)
+	if err != nil {
+		return "", "", domain.ErrOAuthInvalidClient
+	}
+
+	clientSecret, err = url.QueryUnescape(clientSecret)
+	if err != nil {
+		return "", "", domain.ErrOAuthInvalidClient
+	}
+
+	return clientID, clientSecret, nil
+}
+
+// encodeOAuthError writes an OAuth2 error response (RFC 6749 section
+// 5.2). Errors that are not OAuth2 errors become a server_error.
+func encodeOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	oauthErr, ok := err.(*domain.OAuthError)
+	if !ok {
+		log.Error().Err(err).Stack().Str("end-point", r.RequestURI).Msg(err.Error())
+
+		enc.EncodeJSON(w, http.StatusInternalServerError, &domain.OAuthError{Code: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+
+	if oauthErr == domain.ErrOAuthInvalidClient {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	enc.EncodeJSON(w, status, oauthErr)
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// federationStateCookie binds a federated login to the browser that
+// started it, so a callback URL cannot be used to sign someone else in.
+const federationStateCookie = "pm_federation_state"
+
+// FederatedLogin sends the user to the sign in page of an external
+// identity provider.
+func (a *AuthHandler) FederatedLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authURL, state, err := a.AuthUseCase.FederatedLoginURL(r.Context(), provider)
+	if err != nil {
+		renderFederationError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookie,
+		Value:    state,
+		Path:     "/federation/" + provider + "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// FederatedCallback is where the identity provider sends the user back
+// to. The user is signed in and sent to the federation.redirect_url of
+// the frontend with a single use token.
+func (a *AuthHandler) FederatedCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(federationStateCookie)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookie,
+		Path:     "/federation/" + provider + "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if query.Get("error") != "" {
+		log.Warn().
+			Str("event", "federated_login_failed").
+			Str("provider", provider).
+			Str("error", query.Get("error")).
+			Msg(query.Get("error_description"))
+
+		renderFederationError(w, r, domain.ErrInvalidFederatedLogin)
+		return
+	}
+
+	state := query.Get("state")
+
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		renderFederationError(w, r, domain.ErrInvalidFederationState)
+		return
+	}
+
+	link, err := a.AuthUseCase.FederatedCallback(r.Context(), provider, state, query.Get("code"))
+	if err != nil {
+		renderFederationError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
+// renderFederationError shows why a federated login failed on the login
+// page. Unexpected errors are not shown.
+func renderFederationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case domain.ErrFederationProvider:
+		renderLogin(w, http.StatusNotFound, &loginPage{Error: err.Error()})
+	case domain.ErrInvalidFederationState,
+		domain.ErrInvalidFederatedLogin,
+		domain.ErrFederationEmailNotVerified:
+		renderLogin(w, http.StatusUnauthorized, &loginPage{Error: err.Error()})
+	default:
+		log.Error().Err(err).Stack().Str("end-point", r.RequestURI).Msg(err.Error())
+		renderLogin(w, http.StatusInternalServerError, &loginPage{Error: "the login failed, please try again"})
+	}
+}
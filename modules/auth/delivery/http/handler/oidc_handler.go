@@ -0,0 +1,271 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/enc"
+	"github.com/rs/zerolog/log"
+)
+
+// loginPage represent the data of the login page of the authorization
+// endpoint. MFAToken is set once the password was accepted and a second
+// factor is required.
+type loginPage struct {
+	Client   string
+	Request  *domain.AuthorizationRequest
+	Email    string
+	MFAToken string
+	Error    string
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .25rem 0 1rem; padding: .5rem; }
+button { padding: .5rem; margin-bottom: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+{{if .Client}}<h1>Sign in to {{.Client}}</h1>{{else}}<h1>Sign in</h1>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Request}}
+<form method="post" action="/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+{{if .MFAToken}}
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label for="code">Authentication code</label>
+<input id="code" name="code" autocomplete="one-time-code" required autofocus>
+{{else}}
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+{{end}}
+<button type="submit">Continue</button>
+<button type="submit" name="cancel" value="1" formnovalidate>Cancel</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// Authorize is the OAuth2 authorization endpoint (RFC 6749 section
+// 3.1) of the authorization code flow with PKCE. It shows a login page,
+// signs the user in with Authenticate, and VerifyMFA when a second
+// factor is enabled, and sends the authorization code back to the
+// client.
+func (a *AuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderLogin(w, http.StatusBadRequest, &loginPage{Error: domain.ErrOAuthInvalidRequest.Error()})
+		return
+	}
+
+	req := authorizationRequest(r.Form)
+
+	client, err := a.AuthUseCase.ValidateAuthorizationRequest(r.Context(), req)
+	if err != nil {
+		if client == nil {
+			// Without a trusted redirect_uri the error can only be
+			// shown to the user.
+			renderLogin(w, http.StatusBadRequest, &loginPage{Error: err.Error()})
+			return
+		}
+
+		redirectAuthorization(w, r, req, url.Values{}, err)
+		return
+	}
+
+	page := &loginPage{Client: client.Name, Request: req}
+
+	if r.Method == http.MethodGet {
+		renderLogin(w, http.StatusOK, page)
+		return
+	}
+
+	if r.PostForm.Get("cancel") != "" {
+		redirectAuthorization(w, r, req, url.Values{}, domain.ErrOAuthAccessDenied)
+		return
+	}
+
+	var token *domain.AuthToken
+
+	if mfaToken := r.PostForm.Get("mfa_token"); mfaToken != "" {
+		token, err = a.AuthUseCase.VerifyMFA(r.Context(), mfaToken, r.PostForm.Get("code"))
+		if err == domain.ErrInvalidMFACode {
+			page.MFAToken = mfaToken
+		}
+	} else {
+		page.Email = r.PostForm.Get("email")
+		token, err = a.AuthUseCase.Authenticate(r.Context(), page.Email, r.PostForm.Get("password"))
+	}
+
+	if err != nil {
+		page.Error = loginError(err)
+		renderLogin(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	if token.MFARequired {
+		page.MFAToken = token.MFAToken
+		renderLogin(w, http.StatusOK, page)
+		return
+	}
+
+	code, err := a.AuthUseCase.IssueAuthorizationCode(r.Context(), req, token)
+	if err != nil {
+		redirectAuthorization(w, r, req, url.Values{}, err)
+		return
+	}
+
+	redirectAuthorization(w, r, req, url.Values{"code": {code}}, nil)
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint (OpenID Connect Core
+// section 5.3).
+func (a *AuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, err := a.AuthUseCase.UserInfo(r.Context())
+	if err != nil {
+		encodeBearerError(w, r, err)
+		return
+	}
+
+	enc.EncodeJSON(w, http.StatusOK, claims)
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (a *AuthHandler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	enc.EncodeJSON(w, http.StatusOK, a.AuthUseCase.OpenIDConfiguration())
+}
+
+func authorizationRequest(form url.Values) *domain.AuthorizationRequest {
+	return &domain.AuthorizationRequest{
+		ResponseType:        form.Get("response_type"),
+		ClientID:            form.Get("client_id"),
+		RedirectURI:         form.Get("redirect_uri"),
+		Scope:               form.Get("scope"),
+		State:               form.Get("state"),
+		Nonce:               form.Get("nonce"),
+		CodeChallenge:       form.Get("code_challenge"),
+		CodeChallengeMethod: form.Get("code_challenge_method"),
+	}
+}
+
+// redirectAuthorization sends the authorization response, or its error
+// (RFC 6749 section 4.1.2.1), back to the redirect_uri of the client.
+func redirectAuthorization(
+	w http.ResponseWriter,
+	r *http.Request,
+	req *domain.AuthorizationRequest,
+	params url.Values,
+	err error,
+) {
+	if err != nil {
+		oauthErr, ok := err.(*domain.OAuthError)
+		if !ok {
+			log.Error().Err(err).Stack().Str("end-point", r.RequestURI).Msg(err.Error())
+			oauthErr = &domain.OAuthError{Code: "server_error"}
+		}
+
+		params.Set("error", oauthErr.Code)
+
+		if oauthErr.Description != "" {
+			params.Set("error_description", oauthErr.Description)
+		}
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	redirectURI, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		renderLogin(w, http.StatusBadRequest, &loginPage{Error: domain.ErrOAuthInvalidRedirectURI.Error()})
+		return
+	}
+
+	query := redirectURI.Query()
+
+	for key, values := range params {
+		query[key] = values
+	}
+
+	redirectURI.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// renderLogin writes the login page. It must not be framed, the user
+// types credentials in it.
+func renderLogin(w http.ResponseWriter, status int, page *loginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := loginTemplate.Execute(w, page); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
+}
+
+// loginError returns the message shown on the login page. Unexpected
+// errors are not shown.
+func loginError(err error) string {
+	switch err {
+	case domain.ErrTooManyAttempts,
+		domain.ErrAccountLocked,
+		domain.ErrEmailNotVerified,
+		domain.ErrInvalidMFACode,
+		domain.ErrInvalidMFAToken:
+		return err.Error()
+	default:
+		return "invalid email or password"
+	}
+}
+
+// encodeBearerError writes an error of a request authenticated with a
+// Bearer token (RFC 6750 section 3).
+func encodeBearerError(w http.ResponseWriter, r *http.Request, err error) {
+	oauthErr, ok := err.(*domain.OAuthError)
+	if !ok {
+		log.Error().Err(err).Stack().Str("end-point", r.RequestURI).Msg(err.Error())
+
+		enc.EncodeJSON(w, http.StatusInternalServerError, &domain.OAuthError{Code: "server_error"})
+		return
+	}
+
+	status := http.StatusUnauthorized
+
+	if oauthErr == domain.ErrOAuthInsufficientScope {
+		status = http.StatusForbidden
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+
+	enc.EncodeJSON(w, status, oauthErr)
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/enc"
+	"github.com/go-chi/chi/v5"
+)
+
+// samlStateCookie binds a SAML login to the browser that started it, so
+// a response cannot be posted to sign someone else in.
+const samlStateCookie = "pm_saml_state"
+
+// SAMLMetadata serves the service provider metadata to register with
+// a SAML identity provider.
+func (a *AuthHandler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := a.AuthUseCase.SAMLMetadata(r.Context(), chi.URLParam(r, "provider"))
+	if err == domain.ErrFederationProvider {
+		enc.EncodeError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		enc.EncodeError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// SAMLLogin sends the user to the sign in page of a SAML identity
+// provider with an authentication request.
+func (a *AuthHandler) SAMLLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authURL, relayState, err := a.AuthUseCase.SAMLLoginURL(r.Context(), provider)
+	if err != nil {
+		renderFederationError(w, r, err)
+		return
+	}
+
+	// The identity provider posts the response from its own site, only a
+	// cookie with SameSite=None comes along. Browsers require it to be
+	// secure, so plain HTTP only works with an identity provider on the
+	// same site, like localhost.
+	secure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+	sameSite := http.SameSiteLaxMode
+
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     samlStateCookie,
+		Value:    relayState,
+		Path:     "/saml/" + provider + "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// SAMLAssertionConsumer is the assertion consumer service the identity
+// provider posts its response to. The user is signed in and sent to the
+// federation.redirect_url of the frontend with a single use token.
+func (a *AuthHandler) SAMLAssertionConsumer(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	cookie, err := r.Cookie(samlStateCookie)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     samlStateCookie,
+		Path:     "/saml/" + provider + "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if parseErr := r.ParseForm(); parseErr != nil {
+		renderFederationError(w, r, domain.ErrInvalidFederatedLogin)
+		return
+	}
+
+	relayState := r.PostForm.Get("RelayState")
+
+	if err != nil || relayState == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(relayState)) != 1 {
+		renderFederationError(w, r, domain.ErrInvalidFederationState)
+		return
+	}
+
+	link, err := a.AuthUseCase.SAMLCallback(r.Context(), provider, relayState, r.PostForm.Get("SAMLResponse"))
+	if err != nil {
+		renderFederationError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
@@ -0,0 +1,201 @@
+package ldp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/rs/zerolog/log"
+)
+
+type ldapRepository struct {
+	Config *domain.LDAPConfig
+}
+
+// NewLDAPDirectoryRepository will create an object that represent
+// the domain.DirectoryRepository interface.
+func NewLDAPDirectoryRepository(config *domain.LDAPConfig) domain.DirectoryRepository {
+	c := *config
+
+	if c.UserFilter == "" {
+		c.UserFilter = "(&(objectClass=person)(|(uid={username})(mail={username})))"
+	}
+
+	if c.NameAttribute == "" {
+		c.NameAttribute = "cn"
+	}
+
+	if c.EmailAttribute == "" {
+		c.EmailAttribute = "mail"
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+
+	return &ldapRepository{&c}
+}
+
+// Authenticate finds the user with the service account and binds as
+// them with their password. Each login uses its own connection, so
+// the binds of concurrent logins do not mix.
+func (l *ldapRepository) Authenticate(ctx context.Context, username, password string) (*domain.DirectoryUser, error) {
+	// An empty password would be an unauthenticated bind, which most
+	// servers accept for any DN.
+	if username == "" || password == "" {
+		return nil, domain.ErrDirectoryInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := l.serviceBind(conn); err != nil {
+		return nil, err
+	}
+
+	attributes := []string{l.Config.NameAttribute, l.Config.EmailAttribute}
+	if l.Config.GroupAttribute != "" {
+		attributes = append(attributes, l.Config.GroupAttribute)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.Config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(l.Config.Timeout.Seconds()),
+		false,
+		strings.ReplaceAll(l.Config.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	if len(result.Entries) == 0 {
+		return &domain.DirectoryUser{}, nil
+	}
+
+	// Binding as one of several users would let the login pick them.
+	if len(result.Entries) > 1 {
+		log.Error().Str("username", username).Msg("the LDAP user filter matches more than one entry")
+		return nil, domain.ErrDirectoryInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, domain.ErrDirectoryInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	user := &domain.DirectoryUser{
+		DN:    entry.DN,
+		Name:  entry.GetAttributeValue(l.Config.NameAttribute),
+		Email: entry.GetAttributeValue(l.Config.EmailAttribute),
+	}
+
+	if l.Config.GroupAttribute != "" {
+		user.Groups = entry.GetAttributeValues(l.Config.GroupAttribute)
+	}
+
+	if l.Config.GroupFilter != "" {
+		groups, err := l.searchGroups(conn, entry.DN, username)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Groups = append(user.Groups, groups...)
+	}
+
+	return user, nil
+}
+
+// searchGroups returns the DN of the groups the user is a member of.
+// The service account searches them, users may not be allowed to.
+func (l *ldapRepository) searchGroups(conn *ldap.Conn, dn, username string) ([]string, error) {
+	if err := l.serviceBind(conn); err != nil {
+		return nil, err
+	}
+
+	baseDN := l.Config.GroupBaseDN
+	if baseDN == "" {
+		baseDN = l.Config.BaseDN
+	}
+
+	filter := strings.NewReplacer(
+		"{dn}", ldap.EscapeFilter(dn),
+		"{username}", ldap.EscapeFilter(username),
+	).Replace(l.Config.GroupFilter)
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		int(l.Config.Timeout.Seconds()),
+		false,
+		filter,
+		[]string{"1.1"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+
+	return groups, nil
+}
+
+func (l *ldapRepository) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: l.Config.InsecureSkipVerify}
+
+	if u, err := url.Parse(l.Config.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(
+		l.Config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.Config.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(l.Config.Timeout)
+
+	if l.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (l *ldapRepository) serviceBind(conn *ldap.Conn) error {
+	if l.Config.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+
+	return conn.Bind(l.Config.BindDN, l.Config.BindPassword)
+}
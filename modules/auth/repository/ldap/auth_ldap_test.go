@@ -0,0 +1,414 @@
+package ldp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBindDN       = "cn=reader,dc=example,dc=org"
+	testBindPassword = "reader"
+	testUserDN       = "uid=jdoe,ou=people,dc=example,dc=org"
+	testAdminsDN     = "cn=admins,ou=groups,dc=example,dc=org"
+	testDevelopersDN = "cn=developers,ou=groups,dc=example,dc=org"
+)
+
+// mockEntry is an entry of the mock directory. Entries with a password
+// can bind.
+type mockEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// mockDirectory is a local LDAP server speaking just enough of the
+// protocol for the repository: simple binds, searches with and, or,
+// not, equality and presence filters, and unbinds.
+type mockDirectory struct {
+	listener net.Listener
+	entries  []*mockEntry
+
+	mu       sync.Mutex
+	searches int
+}
+
+func newMockDirectory(t *testing.T, entries ...*mockEntry) *mockDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	directory := &mockDirectory{listener: listener, entries: entries}
+
+	go directory.serve()
+
+	t.Cleanup(func() { listener.Close() })
+
+	return directory
+}
+
+func (d *mockDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *mockDirectory) searchCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.searches
+}
+
+func (d *mockDirectory) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go d.handle(conn)
+	}
+}
+
+func (d *mockDirectory) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case 0:
+			d.bind(conn, messageID, request)
+		case 2:
+			return
+		case 3:
+			d.search(conn, messageID, request)
+		default:
+			return
+		}
+	}
+}
+
+func (d *mockDirectory) bind(w io.Writer, messageID int64, request *ber.Packet) {
+	name := request.Children[1].Value.(string)
+	password := request.Children[2].Data.String()
+
+	code := int64(49)
+
+	if name == "" && password == "" {
+		code = 0
+	}
+
+	for _, entry := range d.entries {
+		if entry.password != "" && strings.EqualFold(entry.dn, name) && entry.password == password {
+			code = 0
+		}
+	}
+
+	w.Write(ldapResult(messageID, 1, code).Bytes())
+}
+
+func (d *mockDirectory) search(w io.Writer, messageID int64, request *ber.Packet) {
+	d.mu.Lock()
+	d.searches++
+	d.mu.Unlock()
+
+	baseDN := strings.ToLower(request.Children[0].Value.(string))
+	sizeLimit := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+
+	requested := []string{}
+	for _, attribute := range request.Children[7].Children {
+		requested = append(requested, attribute.Value.(string))
+	}
+
+	sent := int64(0)
+
+	for _, entry := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), baseDN) || !matchFilter(entry, filter) {
+			continue
+		}
+
+		if sizeLimit > 0 && sent == sizeLimit {
+			w.Write(ldapResult(messageID, 5, 4).Bytes())
+			return
+		}
+
+		w.Write(searchResultEntry(messageID, entry, requested).Bytes())
+		sent++
+	}
+
+	w.Write(ldapResult(messageID, 5, 0).Bytes())
+}
+
+func matchFilter(entry *mockEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0:
+		for _, child := range filter.Children {
+			if !matchFilter(entry, child) {
+				return false
+			}
+		}
+
+		return true
+	case 1:
+		for _, child := range filter.Children {
+			if matchFilter(entry, child) {
+				return true
+			}
+		}
+
+		return false
+	case 2:
+		return !matchFilter(entry, filter.Children[0])
+	case 3:
+		name := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+
+		for _, v := range entry.values(name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+
+		return false
+	case 7:
+		return len(entry.values(filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+func (e *mockEntry) values(name string) []string {
+	for attribute, values := range e.attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func envelope(messageID int64, response *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(response)
+
+	return packet
+}
+
+func ldapResult(messageID int64, tag ber.Tag, code int64) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+
+	return envelope(messageID, response)
+}
+
+func searchResultEntry(messageID int64, entry *mockEntry, requested []string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "Search Result Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+
+	for _, name := range requested {
+		values := entry.values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	response.AppendChild(attributes)
+
+	return envelope(messageID, response)
+}
+
+func testEntries() []*mockEntry {
+	return []*mockEntry{
+		{
+			dn:       testBindDN,
+			password: testBindPassword,
+			attributes: map[string][]string{
+				"objectClass": {"organizationalRole"},
+				"cn":          {"reader"},
+			},
+		},
+		{
+			dn:       testUserDN,
+			password: "p4ssw0rd",
+			attributes: map[string][]string{
+				"objectClass": {"person", "inetOrgPerson"},
+				"uid":         {"jdoe"},
+				"cn":          {"John Doe"},
+				"mail":        {"jdoe@example.org"},
+				"memberOf":    {testAdminsDN},
+			},
+		},
+		{
+			dn: testAdminsDN,
+			attributes: map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"member":      {testUserDN},
+			},
+		},
+		{
+			dn: testDevelopersDN,
+			attributes: map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"member":      {testUserDN},
+			},
+		},
+	}
+}
+
+func newTestRepository(directory *mockDirectory, config domain.LDAPConfig) domain.DirectoryRepository {
+	config.URL = directory.url()
+	config.BaseDN = "dc=example,dc=org"
+	config.Timeout = 2 * time.Second
+
+	if config.BindDN == "" {
+		config.BindDN = testBindDN
+		config.BindPassword = testBindPassword
+	}
+
+	return NewLDAPDirectoryRepository(&config)
+}
+
+func TestAuthenticate(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{GroupAttribute: "memberOf"})
+
+	for _, username := range []string{"jdoe", "jdoe@example.org"} {
+		user, err := repository.Authenticate(context.Background(), username, "p4ssw0rd")
+		require.NoError(t, err)
+
+		assert.Equal(t, testUserDN, user.DN)
+		assert.Equal(t, "John Doe", user.Name)
+		assert.Equal(t, "jdoe@example.org", user.Email)
+		assert.Equal(t, []string{testAdminsDN}, user.Groups)
+	}
+}
+
+func TestAuthenticateSearchesGroups(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{
+		GroupBaseDN: "ou=groups,dc=example,dc=org",
+		GroupFilter: "(&(objectClass=groupOfNames)(member={dn}))",
+	})
+
+	user, err := repository.Authenticate(context.Background(), "jdoe", "p4ssw0rd")
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{testAdminsDN, testDevelopersDN}, user.Groups)
+}
+
+func TestAuthenticateRejectsWrongPassword(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{})
+
+	_, err := repository.Authenticate(context.Background(), "jdoe", "wrong")
+	assert.Equal(t, domain.ErrDirectoryInvalidCredentials, err)
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{})
+
+	_, err := repository.Authenticate(context.Background(), "jdoe", "")
+	assert.Equal(t, domain.ErrDirectoryInvalidCredentials, err)
+	assert.Equal(t, 0, directory.searchCount())
+}
+
+func TestAuthenticateUnknownUser(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{})
+
+	user, err := repository.Authenticate(context.Background(), "admin@example.org", "p4ssw0rd")
+	require.NoError(t, err)
+
+	assert.Empty(t, user.DN)
+}
+
+func TestAuthenticateEscapesUsername(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{UserFilter: "(uid={username})"})
+
+	user, err := repository.Authenticate(context.Background(), "*", "p4ssw0rd")
+	require.NoError(t, err)
+	assert.Empty(t, user.DN)
+
+	user, err = repository.Authenticate(context.Background(), "x)(uid=jdoe", "p4ssw0rd")
+	require.NoError(t, err)
+	assert.Empty(t, user.DN)
+}
+
+func TestAuthenticateRejectsAmbiguousUser(t *testing.T) {
+	entries := append(testEntries(), &mockEntry{
+		dn:       "uid=jdoe2,ou=people,dc=example,dc=org",
+		password: "p4ssw0rd",
+		attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"jdoe2"},
+			"mail":        {"jdoe@example.org"},
+		},
+	})
+
+	directory := newMockDirectory(t, entries...)
+	repository := newTestRepository(directory, domain.LDAPConfig{})
+
+	_, err := repository.Authenticate(context.Background(), "jdoe@example.org", "p4ssw0rd")
+	assert.Equal(t, domain.ErrDirectoryInvalidCredentials, err)
+}
+
+func TestAuthenticateWrongServiceAccount(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{
+		BindDN:       testBindDN,
+		BindPassword: "wrong",
+	})
+
+	_, err := repository.Authenticate(context.Background(), "jdoe", "p4ssw0rd")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, domain.ErrDirectoryInvalidCredentials))
+}
+
+func TestAuthenticateUnavailable(t *testing.T) {
+	directory := newMockDirectory(t, testEntries()...)
+	repository := newTestRepository(directory, domain.LDAPConfig{})
+
+	directory.listener.Close()
+
+	_, err := repository.Authenticate(context.Background(), "jdoe", "p4ssw0rd")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, domain.ErrDirectoryInvalidCredentials))
+}
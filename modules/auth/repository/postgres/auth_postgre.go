@@ -3,8 +3,10 @@ package postgre
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -31,3 +33,137 @@ func (p *postgreRepository) Authenticate(ctx context.Context, email string) (*do
 
 	return &user, nil
 }
+
+// ChangePassword sets a new password and keeps it in the password history.
+// Only the last history passwords are kept, older ones are deleted in the
+// same transaction.
+func (p *postgreRepository) ChangePassword(ctx context.Context, userID int64, password string, history int) error {
+	tx, err := p.Conn.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+
+	query := `
+		UPDATE users
+		SET
+		password = $1,
+		updated_at = $2
+		WHERE id = $3
+	`
+
+	result, err := tx.ExecContext(ctx, query, password, now, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		err = domain.ErrNotFound
+		return err
+	}
+
+	query = "INSERT INTO password_history (user_id, password, created_at) VALUES ($1, $2, $3)"
+
+	if _, err = tx.ExecContext(ctx, query, userID, password, now); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if history < 0 {
+		history = 0
+	}
+
+	query = `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		)
+	`
+
+	if _, err = tx.ExecContext(ctx, query, userID, history); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+// RehashPassword replaces the hash of an unchanged password. It does
+// nothing if the password was changed in the meantime.
+func (p *postgreRepository) RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) error {
+	query := `
+		UPDATE users
+		SET
+		password = $1
+		WHERE id = $2 AND password = $3
+	`
+
+	if _, err := p.Conn.ExecContext(ctx, query, newHash, userID, oldHash); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+// PasswordHistory returns the hashes of the last passwords of a user,
+// newest first.
+func (p *postgreRepository) PasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	query := `
+		SELECT password FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	hashes := []string{}
+
+	err := p.Conn.SelectContext(ctx, &hashes, query, userID, limit)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return hashes, nil
+}
+
+// VerifyEmail marks the email of a user as verified, as long as it is
+// still the given one.
+func (p *postgreRepository) VerifyEmail(ctx context.Context, userID int64, email string) error {
+	query := `
+		UPDATE users
+		SET
+		email_verified_at = $1
+		WHERE id = $2 AND email = $3 AND email_verified_at IS NULL
+	`
+
+	if _, err := p.Conn.ExecContext(ctx, query, time.Now(), userID, email); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package postgre_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	postgreRepository "github.com/cyruzin/puppet_master/modules/auth/repository/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePasswordPrunesHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users")).
+		WithArgs("new hash", sqlmock.AnyArg(), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO password_history")).
+		WithArgs(int64(2), "new hash", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM password_history")).
+		WithArgs(int64(2), 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	repo := postgreRepository.NewPostgreAuthRepository(sqlx.NewDb(db, "sqlmock"))
+
+	require.NoError(t, repo.ChangePassword(context.Background(), 2, "new hash", 5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePasswordRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO password_history")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM password_history")).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	repo := postgreRepository.NewPostgreAuthRepository(sqlx.NewDb(db, "sqlmock"))
+
+	assert.Error(t, repo.ChangePassword(context.Background(), 2, "new hash", 5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
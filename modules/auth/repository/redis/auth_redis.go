@@ -10,6 +10,45 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// compareAndSwapScript replaces the JSON document stored at KEYS[1] with
+// ARGV[3] when its ARGV[1] field equals ARGV[2].
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return 0
+end
+
+if cjson.decode(current)[ARGV[1]] ~= ARGV[2] then
+	return 0
+end
+
+redis.call("SET", KEYS[1], ARGV[3], "PX", ARGV[4])
+
+return 1
+`)
+
+// getDeleteScript returns the value stored at KEYS[1] and deletes it, so
+// only one caller ever reads it.
+var getDeleteScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value then
+	redis.call("DEL", KEYS[1])
+end
+
+return value
+`)
+
+// incrementScript increments the counter stored at KEYS[1] and sets its
+// expiration to ARGV[1] milliseconds when it creates it.
+var incrementScript = redis.NewScript(`
+local value = redis.call("INCR", KEYS[1])
+if value == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+return value
+`)
+
 type cacheRepository struct {
 	Conn *redis.Client
 }
@@ -37,17 +76,52 @@ func (r *cacheRepository) Set(ctx context.Context, key string, value interface{}
 }
 
 func (r *cacheRepository) Get(ctx context.Context, key string, destination interface{}) error {
+	// A missing key is the usual outcome of some lookups, like the one of
+	// the revocation denylist made on every request, so it is not logged.
 	value, err := r.Conn.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return domain.ErrCacheKeyNil
+	}
+
 	if err != nil {
 		log.Error().Err(err).Stack().Msg(domain.ErrGetCache.Error())
 		return domain.ErrGetCache
 	}
 
+	if err := r.unmarshal([]byte(value), destination); err != nil {
+		log.Error().Err(err).Stack().Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *cacheRepository) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := r.Conn.Del(ctx, keys...).Err(); err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrDeleteCache.Error())
+		return domain.ErrDeleteCache
+	}
+
+	return nil
+}
+
+// GetDelete reads the value stored at key and deletes it in a single
+// step, for values that must be used only once.
+func (r *cacheRepository) GetDelete(ctx context.Context, key string, destination interface{}) error {
+	value, err := getDeleteScript.Run(ctx, r.Conn, []string{key}).Text()
 	if err == redis.Nil {
-		log.Error().Err(err).Stack().Msg(domain.ErrCacheKeyNil.Error())
 		return domain.ErrCacheKeyNil
 	}
 
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrGetCache.Error())
+		return domain.ErrGetCache
+	}
+
 	if err := r.unmarshal([]byte(value), destination); err != nil {
 		log.Error().Err(err).Stack().Msg(err.Error())
 		return err
@@ -56,6 +130,101 @@ func (r *cacheRepository) Get(ctx context.Context, key string, destination inter
 	return nil
 }
 
+// Increment increments the counter stored at key. The expiration is set
+// when the counter is created, so it counts within a fixed window. Both
+// happen in one script, so a counter is never left without expiration.
+func (r *cacheRepository) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	value, err := incrementScript.Run(ctx, r.Conn, []string{key}, expiration.Milliseconds()).Int64()
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrSetCache.Error())
+		return 0, domain.ErrSetCache
+	}
+
+	return value, nil
+}
+
+// CompareAndSwap stores value at key only when the given field of the
+// value stored there still equals old, in a single step. It reports
+// whether the value was swapped.
+func (r *cacheRepository) CompareAndSwap(
+	ctx context.Context,
+	key,
+	field,
+	old string,
+	value interface{},
+	expiration time.Duration,
+) (bool, error) {
+	marshalledValue, err := r.marshal(value)
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(err.Error())
+		return false, err
+	}
+
+	swapped, err := compareAndSwapScript.Run(
+		ctx,
+		r.Conn,
+		[]string{key},
+		field,
+		old,
+		marshalledValue,
+		expiration.Milliseconds(),
+	).Int()
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrSetCache.Error())
+		return false, domain.ErrSetCache
+	}
+
+	return swapped == 1, nil
+}
+
+// AddToSet adds a member to the set stored at key and sets the
+// expiration of the whole set, in a single transaction.
+func (r *cacheRepository) AddToSet(ctx context.Context, key, member string, expiration time.Duration) error {
+	_, err := r.Conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, member)
+		pipe.Expire(ctx, key, expiration)
+
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrSetCache.Error())
+		return domain.ErrSetCache
+	}
+
+	return nil
+}
+
+// SetMembers returns the members of the set stored at key, none when it
+// does not exist.
+func (r *cacheRepository) SetMembers(ctx context.Context, key string) ([]string, error) {
+	members, err := r.Conn.SMembers(ctx, key).Result()
+	if err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrGetCache.Error())
+		return nil, domain.ErrGetCache
+	}
+
+	return members, nil
+}
+
+func (r *cacheRepository) RemoveFromSet(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, len(members))
+
+	for i, member := range members {
+		values[i] = member
+	}
+
+	if err := r.Conn.SRem(ctx, key, values...).Err(); err != nil {
+		log.Error().Err(err).Stack().Msg(domain.ErrDeleteCache.Error())
+		return domain.ErrDeleteCache
+	}
+
+	return nil
+}
+
 func (r *cacheRepository) marshal(data interface{}) ([]byte, error) {
 	value, err := json.Marshal(data)
 	if err != nil {
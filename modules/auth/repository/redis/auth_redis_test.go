@@ -0,0 +1,118 @@
+package rds_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cyruzin/puppet_master/domain"
+	rds "github.com/cyruzin/puppet_master/modules/auth/repository/redis"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) (domain.CacheRepository, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	return rds.NewRedisCacheRepository(redis.NewClient(&redis.Options{Addr: server.Addr()})), server
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+
+	family := &domain.TokenFamily{ID: "family", Current: "first"}
+	require.NoError(t, cache.Set(ctx, "token_family:family", family, time.Hour))
+
+	family.Current = "second"
+
+	swapped, err := cache.CompareAndSwap(ctx, "token_family:family", "current", "first", family, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, swapped)
+	assert.Equal(t, time.Minute, server.TTL("token_family:family"))
+
+	// The first value is gone, so swapping from it again fails.
+	family.Current = "third"
+
+	swapped, err = cache.CompareAndSwap(ctx, "token_family:family", "current", "first", family, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, swapped)
+
+	stored := &domain.TokenFamily{}
+	require.NoError(t, cache.Get(ctx, "token_family:family", stored))
+	assert.Equal(t, "second", stored.Current)
+
+	swapped, err = cache.CompareAndSwap(ctx, "token_family:missing", "current", "first", family, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, swapped)
+}
+
+func TestGetMissingKey(t *testing.T) {
+	cache, _ := newTestCache(t)
+
+	revoked := false
+
+	assert.Equal(t, domain.ErrCacheKeyNil, cache.Get(context.Background(), "revoked_token:missing", &revoked))
+	assert.False(t, revoked)
+}
+
+func TestSets(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+
+	require.NoError(t, cache.AddToSet(ctx, "user_family_set:2", "first", time.Minute))
+	require.NoError(t, cache.AddToSet(ctx, "user_family_set:2", "second", time.Hour))
+	assert.Equal(t, time.Hour, server.TTL("user_family_set:2"))
+
+	members, err := cache.SetMembers(ctx, "user_family_set:2")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"first", "second"}, members)
+
+	require.NoError(t, cache.RemoveFromSet(ctx, "user_family_set:2", "first"))
+	require.NoError(t, cache.RemoveFromSet(ctx, "user_family_set:2"))
+
+	members, err = cache.SetMembers(ctx, "user_family_set:2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, members)
+
+	members, err = cache.SetMembers(ctx, "user_family_set:missing")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestGetDelete(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "magic_link:hash", int64(2), time.Minute))
+
+	var userID int64
+
+	require.NoError(t, cache.GetDelete(ctx, "magic_link:hash", &userID))
+	assert.Equal(t, int64(2), userID)
+	assert.False(t, server.Exists("magic_link:hash"))
+
+	assert.Equal(t, domain.ErrCacheKeyNil, cache.GetDelete(ctx, "magic_link:hash", &userID))
+}
+
+func TestIncrement(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+
+	value, err := cache.Increment(ctx, "login_failures:email:homer@simpsons.org", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	assert.Equal(t, time.Minute, server.TTL("login_failures:email:homer@simpsons.org"))
+
+	// The window is fixed, later increments keep the first expiration.
+	server.FastForward(30 * time.Second)
+
+	value, err = cache.Increment(ctx, "login_failures:email:homer@simpsons.org", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+	assert.Equal(t, 30*time.Second, server.TTL("login_failures:email:homer@simpsons.org"))
+}
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const apiKeyUserPrefix = "api_key_user:"
+
+// ParseAPIKey authenticates a request made with a personal API key. The
+// key is looked up on every request, so a revoked key stops working
+// right away, while the permissions of its owner are cached like the
+// ones of a session.
+func (a *authUseCase) ParseAPIKey(ctx context.Context, key string) (*domain.TokenClaims, error) {
+	if key == "" {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	apiKey, err := a.apiKeyRepo.GetByHash(ctx, crypto.HashToken(key))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if apiKey.ID == 0 || (apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(time.Now())) {
+		log.Warn().
+			Str("event", "api_key_rejected").
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrInvalidAPIKey.Error())
+
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	user, err := a.userRepo.GetByID(ctx, apiKey.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 || user.DisabledAt != nil {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	userCache := &domain.UserCache{}
+
+	err = a.cacheRepo.Get(ctx, apiKeyUserKey(apiKey.ID), userCache)
+	if err != nil && err != domain.ErrCacheKeyNil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err == domain.ErrCacheKeyNil {
+		role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
+
+		if err := a.cacheUser(ctx, apiKeyUserKey(apiKey.ID), user, role, expiration); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		userCache.Role = role.Name
+	}
+
+	// The last use is only recorded once a minute, a script may send
+	// many requests in a row.
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > time.Minute {
+		if err := a.apiKeyRepo.Touch(ctx, apiKey.ID, time.Now()); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+	}
+
+	claims := &domain.TokenClaims{
+		APIKeyID:          apiKey.ID,
+		APIKeyPermissions: apiKey.Permissions,
+		User: map[string]interface{}{
+			"user_id": float64(user.ID),
+			"name":    user.Name,
+			"email":   user.Email,
+			"role":    userCache.Role,
+		},
+	}
+
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = *apiKey.ExpiresAt
+	}
+
+	return claims, nil
+}
+
+func apiKeyUserKey(apiKeyID int64) string {
+	return apiKeyUserPrefix + strconv.FormatInt(apiKeyID, 10)
+}
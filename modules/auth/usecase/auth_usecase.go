@@ -3,22 +3,49 @@ package usecase
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cyruzin/puppet_master/domain"
 	"github.com/cyruzin/puppet_master/pkg/crypto"
-	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
+	"github.com/cyruzin/puppet_master/pkg/validation"
 	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+const (
+	tokenFamilyPrefix   = "token_family:"
+	revokedTokenPrefix  = "revoked_token:"
+	userFamiliesPrefix  = "user_family_set:"
+	passwordResetPrefix = "password_reset:"
+	mfaChallengePrefix  = "mfa_challenge:"
+	mfaAttemptsPrefix   = "mfa_attempts:"
+)
+
 type authUseCase struct {
-	authRepo       domain.AuthRepository
-	cacheRepo      domain.CacheRepository
-	permissionRepo domain.PermissionRepository
-	roleRepo       domain.RoleRepository
-	userRepo       domain.UserRepository
+	*loginLimiter
+
+	authRepo           domain.AuthRepository
+	cacheRepo          domain.CacheRepository
+	permissionRepo     domain.PermissionRepository
+	roleRepo           domain.RoleRepository
+	userRepo           domain.UserRepository
+	clientRepo         domain.ClientRepository
+	apiKeyRepo         domain.APIKeyRepository
+	serviceAccountRepo domain.ServiceAccountRepository
+	identityRepo       domain.FederatedIdentityRepository
+	directoryRepo      domain.DirectoryRepository
+	keys               *keyring.Keyring
+	mailer             domain.Mailer
+	mfaUseCase         domain.MFAUsecase
+	passkeyUseCase     domain.PasskeyUsecase
+	federation         map[string]*federationProvider
+	saml               map[string]*samlProvider
 }
 
 // NewAuthUsecase will create new an authUsecase object representation
@@ -29,97 +56,343 @@ func NewAuthUsecase(
 	permission domain.PermissionRepository,
 	role domain.RoleRepository,
 	user domain.UserRepository,
+	client domain.ClientRepository,
+	apiKey domain.APIKeyRepository,
+	serviceAccount domain.ServiceAccountRepository,
+	identity domain.FederatedIdentityRepository,
+	directory domain.DirectoryRepository,
+	keys *keyring.Keyring,
+	mailer domain.Mailer,
+	mfa domain.MFAUsecase,
+	passkey domain.PasskeyUsecase,
+	federation []*domain.FederationProvider,
+	samlProviders []*domain.SAMLProvider,
 ) domain.AuthUsecase {
+	federationProviders := newFederationProviders(federation)
+
 	return &authUseCase{
-		authRepo:       auth,
-		cacheRepo:      cache,
-		permissionRepo: permission,
-		roleRepo:       role,
-		userRepo:       user,
+		authRepo:           auth,
+		loginLimiter:       &loginLimiter{cacheRepo: cache},
+		cacheRepo:          cache,
+		permissionRepo:     permission,
+		roleRepo:           role,
+		userRepo:           user,
+		clientRepo:         client,
+		apiKeyRepo:         apiKey,
+		serviceAccountRepo: serviceAccount,
+		identityRepo:       identity,
+		directoryRepo:      directory,
+		keys:               keys,
+		mailer:             mailer,
+		mfaUseCase:         mfa,
+		passkeyUseCase:     passkey,
+		federation:         federationProviders,
+		saml:               newSAMLProviders(samlProviders, federationProviders),
 	}
 }
 
 func (a *authUseCase) Authenticate(ctx context.Context, email, password string) (*domain.AuthToken, error) {
-	user, err := a.authRepo.Authenticate(ctx, email)
+	subjects := loginSubjects(ctx, email)
+
+	if err := a.checkLogin(ctx, subjects); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	// Users of the LDAP directory sign in with its password only, local
+	// accounts are checked for the users it does not know or while it
+	// cannot be reached, unless they are linked to it.
+	user, err := a.directoryUser(ctx, email, password)
+	if err == domain.ErrDirectoryInvalidCredentials {
+		return nil, a.loginFailed(ctx, subjects)
+	}
+
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, err
 	}
 
-	if match := crypto.CheckPasswordHash(password, user.Password); !match {
-		return nil, errors.New("authentication failed")
+	if user == nil {
+		user, err = a.authRepo.Authenticate(ctx, email)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		linked, err := a.directoryLinked(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if linked {
+			log.Warn().
+				Str("event", "directory_login_refused").
+				Int64("user_id", user.ID).
+				Msg("the LDAP directory did not authenticate a user linked to it")
+
+			return nil, a.loginFailed(ctx, subjects)
+		}
+
+		if match := crypto.CheckPasswordHash(password, user.Password); !match {
+			return nil, a.loginFailed(ctx, subjects)
+		}
+
+		if crypto.NeedsRehash(user.Password) {
+			a.rehashPassword(ctx, user, password)
+		}
+	}
+
+	// A disabled account fails like a wrong password, so the password
+	// cannot be confirmed with it.
+	if user.DisabledAt != nil {
+		log.Warn().
+			Str("event", "login_refused").
+			Int64("user_id", user.ID).
+			Msg(domain.ErrUserDisabled.Error())
+
+		return nil, a.loginFailed(ctx, subjects)
 	}
 
-	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+	// Only the email is cleared: a valid login must not reset the
+	// counter of an IP address that is guessing other accounts.
+	if err := a.resetLoginFailures(ctx, subjects[0]); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if emailVerificationRequired(user) {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	mfaEnabled, err := a.mfaUseCase.IsEnabled(ctx, user.ID)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, err
 	}
 
-	auth := &domain.Auth{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
-		Role:   role.Name,
+	if mfaEnabled {
+		return a.mfaChallenge(ctx, user.ID)
 	}
 
-	expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
-	tokenExpiration := time.Now().Add(expiration)
+	return a.issueToken(ctx, user, nil)
+}
+
+// loginFailed counts a wrong password against the lockout.
+func (a *authUseCase) loginFailed(ctx context.Context, subjects []loginSubject) error {
+	if err := a.recordLoginFailure(ctx, subjects); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
 
-	token, err := a.GenerateToken("user", auth, tokenExpiration)
+	return errors.New("authentication failed")
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or cost
+// while the password is known. A failure does not fail the login, the
+// upgrade is simply tried again on the next one.
+func (a *authUseCase) rehashPassword(ctx context.Context, user *domain.User, password string) {
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return
+	}
+
+	if err := a.authRepo.RehashPassword(ctx, user.ID, user.Password, hashedPassword); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return
+	}
+
+	log.Info().Int64("user_id", user.ID).Msg("password hash upgraded")
+}
+
+// mfaChallenge stores a short lived challenge for a login that still
+// needs the second factor. Only the hash of the returned token is kept.
+func (a *authUseCase) mfaChallenge(ctx context.Context, userID int64) (*domain.AuthToken, error) {
+	token, err := crypto.RandomToken(32)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, err
 	}
 
-	auth.Token = token
+	expiration := viper.GetDuration(`mfa.challenge_expiration`)
+	if expiration <= 0 {
+		expiration = 5 * time.Minute
+	}
+
+	challenge := &domain.MFAChallenge{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(expiration),
+	}
+
+	key := mfaChallengePrefix + crypto.HashToken(token)
 
-	refreshToken, err := a.refreshToken(
-		"user",
-		user.ID,
-		time.Now().AddDate(0, 0, viper.GetInt(`jwt.refresh_token_expiration`)),
-	)
+	if err := a.saveToken(ctx, key, challenge, expiration); err != nil {
+		return nil, err
+	}
+
+	return &domain.AuthToken{MFARequired: true, MFAToken: token}, nil
+}
+
+func (a *authUseCase) VerifyMFA(ctx context.Context, mfaToken, code string) (*domain.AuthToken, error) {
+	hash := crypto.HashToken(mfaToken)
+	key := mfaChallengePrefix + hash
+
+	challenge := &domain.MFAChallenge{}
+
+	if err := a.cacheRepo.Get(ctx, key, challenge); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	user, err := a.userRepo.GetByID(ctx, challenge.UserID)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, err
 	}
 
-	payload := &domain.AuthToken{
-		Token:        token,
-		RefreshToken: refreshToken,
+	if user.ID == 0 {
+		return nil, domain.ErrInvalidMFAToken
 	}
 
-	userCache := &domain.UserCache{}
+	// Wrong codes count toward the login lockout, so a locked account
+	// cannot keep guessing codes with challenges it already holds.
+	subjects := loginSubjects(ctx, user.Email)
 
-	if role != nil {
-		userCache.ID = user.ID
-		userCache.Role = role.Name
+	if err := a.checkLogin(ctx, subjects); err != nil {
+		return nil, err
+	}
 
-		permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+	if err := a.mfaUseCase.Verify(ctx, challenge.UserID, code); err != nil {
+		if err != domain.ErrInvalidMFACode {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if err := a.recordLoginFailure(ctx, subjects); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+
+		// A challenge only allows a few guesses, after that the
+		// password has to be entered again. The counter is incremented
+		// atomically, so concurrent guesses cannot share an attempt.
+		maxAttempts := viper.GetInt64(`mfa.max_attempts`)
+		if maxAttempts <= 0 {
+			maxAttempts = 5
+		}
+
+		remaining := time.Until(challenge.ExpiresAt)
+
+		attempts, err := a.cacheRepo.Increment(ctx, mfaAttemptsPrefix+hash, remaining)
 		if err != nil {
 			log.Error().Stack().Err(err).Msg(err.Error())
 			return nil, err
 		}
 
-		for _, permission := range permissions {
-			userCache.Permissions = append(userCache.Permissions, permission.Name)
+		if attempts >= maxAttempts || remaining <= 0 {
+			if err := a.cacheRepo.Delete(ctx, key, mfaAttemptsPrefix+hash); err != nil {
+				log.Error().Stack().Err(err).Msg(err.Error())
+			}
+
+			log.Warn().Int64("user_id", challenge.UserID).Msg("mfa challenge discarded after too many attempts")
 		}
+
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	// Only one request completes the challenge, even when several send
+	// a valid code.
+	if err := a.cacheRepo.GetDelete(ctx, key, challenge); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidMFAToken
 	}
 
-	if err := a.saveToken(ctx, user.Email, userCache, expiration); err != nil {
+	if err := a.cacheRepo.Delete(ctx, mfaAttemptsPrefix+hash); err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, err
 	}
 
-	return payload, nil
+	if err := a.resetLoginFailures(ctx, emailSubject(user.Email)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
+
+	return a.issueToken(ctx, user, nil)
+}
+
+// AuthenticateWithPasskey logs in with a WebAuthn assertion. A passkey
+// that verified the user is two factors on its own. One that only proved
+// presence is a single factor, so users with MFA still get a challenge.
+func (a *authUseCase) AuthenticateWithPasskey(ctx context.Context, credential string) (*domain.AuthToken, error) {
+	userID, userVerified, err := a.passkeyUseCase.FinishLogin(ctx, credential)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	if emailVerificationRequired(user) {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	if !userVerified {
+		mfaEnabled, err := a.mfaUseCase.IsEnabled(ctx, user.ID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if mfaEnabled {
+			return a.mfaChallenge(ctx, user.ID)
+		}
+	}
+
+	return a.issueToken(ctx, user, nil)
 }
 
 func (a *authUseCase) Authorize(ctx context.Context, permission string, roles []string) bool {
-	user := ctx.Value(domain.ContextKeyID).(map[string]interface{})
+	claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok {
+		return false
+	}
+
+	key := sessionUserKey(claims.SessionID)
+
+	switch {
+	case claims.APIKeyID != 0:
+		// An API key is limited to its own permissions on top of the
+		// ones of its owner.
+		if !containsString(claims.APIKeyPermissions, permission) {
+			return false
+		}
+
+		key = apiKeyUserKey(claims.APIKeyID)
+	case claims.ServiceAccountID != 0:
+		key = serviceAccountUserKey(claims.ServiceAccountID)
+	case claims.ClientID != "":
+		key = clientUserKey(claims.ClientID)
+	case claims.Actor != nil:
+		key = impersonationUserKey(claims.ID)
+	case claims.SessionID == "":
+		return false
+	}
+
+	// A scoped token, or the token of a relying party, only gets the
+	// permissions of its scopes, whatever its role allows on top of them.
+	if (len(claims.Scopes) > 0 || claims.AuthorizedParty != "") &&
+		!containsString(scopePermissions(claims.Scopes), permission) {
+		return false
+	}
 
 	userCache := &domain.UserCache{}
 
-	if err := a.cacheRepo.Get(ctx, user["email"].(string), userCache); err != nil {
+	if err := a.cacheRepo.Get(ctx, key, userCache); err != nil {
 		log.Error().Stack().Msg(err.Error())
 		return false
 	}
@@ -148,129 +421,893 @@ func (a *authUseCase) GenerateToken(
 	claimValue interface{},
 	expiration time.Time,
 ) (string, error) {
-	if claimKey == "" || claimValue == nil {
-		return "", errors.New("token claim is empty")
-	}
-
-	t := jwt.New()
-	t.Set(jwt.IssuerKey, viper.GetString(`jwt.issuer`))
-	t.Set(jwt.SubjectKey, viper.GetString(`jwt.subject`))
-	t.Set(jwt.AudienceKey, viper.GetString(`jwt.audience`))
-	t.Set(jwt.ExpirationKey, expiration.Unix())
-	t.Set(claimKey, claimValue)
-
-	payload, err := jwt.Sign(t, jwa.HS256, []byte(viper.GetString(`jwt.secret`)))
+	t, err := a.newToken(claimKey, claimValue, expiration)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return "", err
 	}
 
-	return string(payload), nil
+	return a.signToken(t)
 }
 
-func (a *authUseCase) refreshToken(
+// newToken builds an unsigned access token with a unique jti.
+func (a *authUseCase) newToken(
 	claimKey string,
 	claimValue interface{},
 	expiration time.Time,
-) (string, error) {
+) (jwt.Token, error) {
 	if claimKey == "" || claimValue == nil {
-		return "", errors.New("refresh token claim is empty")
+		return nil, errors.New("token claim is empty")
+	}
+
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return nil, err
 	}
 
 	t := jwt.New()
+	t.Set(jwt.JwtIDKey, jti)
+	t.Set(jwt.IssuerKey, viper.GetString(`jwt.issuer`))
+	t.Set(jwt.SubjectKey, viper.GetString(`jwt.subject`))
+	t.Set(jwt.AudienceKey, viper.GetString(`jwt.audience`))
 	t.Set(jwt.ExpirationKey, expiration.Unix())
 	t.Set(claimKey, claimValue)
 
-	payload, err := jwt.Sign(t, jwa.HS256, []byte(viper.GetString(`jwt.secret`)))
+	return t, nil
+}
+
+func (a *authUseCase) signToken(t jwt.Token) (string, error) {
+	payload, err := a.keys.Sign(t)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return "", err
 	}
 
-	return string(payload), nil
+	return payload, nil
 }
 
-func (a *authUseCase) saveToken(
-	ctx context.Context,
-	key string,
-	value interface{},
-	expiration time.Duration,
-) error {
-	if err := a.cacheRepo.Set(ctx, key, value, expiration); err != nil {
-		log.Error().Stack().Err(err).Msg(err.Error())
-		return err
+func (a *authUseCase) ParseToken(ctx context.Context, token string) (*domain.TokenClaims, error) {
+	claims, family, err := a.parseAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if family != nil {
+		a.touchSession(ctx, family)
+	}
+
+	return claims, nil
 }
 
-func (a *authUseCase) RefreshToken(ctx context.Context, userID int64) (*domain.AuthToken, error) {
-	user, err := a.userRepo.GetByID(ctx, userID)
+// parseAccessToken verifies an access token and checks that it has not
+// been revoked. The session of the token is returned when it has one.
+func (a *authUseCase) parseAccessToken(
+	ctx context.Context,
+	token string,
+) (*domain.TokenClaims, *domain.TokenFamily, error) {
+	t, err := a.verifyToken(token)
 	if err != nil {
-		log.Error().Stack().Err(err).Msg(err.Error())
-		return nil, err
+		return nil, nil, err
 	}
 
-	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
-	if err != nil {
-		log.Error().Stack().Err(err).Msg(err.Error())
-		return nil, err
+	user, ok := t.PrivateClaims()["user"].(map[string]interface{})
+	if !ok {
+		log.Error().Stack().Msg("failed to retrieve private claims")
+		return nil, nil, domain.ErrInvalidToken
 	}
 
-	auth := &domain.Auth{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
-		Role:   role.Name,
+	claims := &domain.TokenClaims{
+		ID:        t.JwtID(),
+		ExpiresAt: t.Expiration(),
+		User:      user,
 	}
 
-	expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
-	tokenExpiration := time.Now().Add(expiration)
+	claims.SessionID, _ = t.PrivateClaims()["sid"].(string)
+	claims.ClientID, _ = t.PrivateClaims()["client_id"].(string)
+	claims.AuthorizedParty, _ = t.PrivateClaims()["azp"].(string)
 
-	token, err := a.GenerateToken("user", auth, tokenExpiration)
-	if err != nil {
-		log.Error().Stack().Err(err).Msg(err.Error())
-		return nil, err
+	if serviceAccountID, ok := t.PrivateClaims()["svc"].(float64); ok {
+		claims.ServiceAccountID = int64(serviceAccountID)
 	}
 
-	auth.Token = token
-
-	refreshToken, err := a.refreshToken(
-		"user",
-		user.ID,
-		time.Now().AddDate(0, 0, viper.GetInt(`jwt.refresh_token_expiration`)),
-	)
-	if err != nil {
-		log.Error().Stack().Err(err).Msg(err.Error())
-		return nil, err
+	if scope, ok := t.PrivateClaims()["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
 	}
 
-	payload := &domain.AuthToken{
-		Token:        token,
-		RefreshToken: refreshToken,
+	claims.Actor, _ = t.PrivateClaims()["act"].(map[string]interface{})
+
+	if claims.ID != "" {
+		revoked := false
+
+		err := a.cacheRepo.Get(ctx, revokedTokenPrefix+claims.ID, &revoked)
+		if err == nil && revoked {
+			return nil, nil, domain.ErrTokenRevoked
+		}
+
+		if err != nil && err != domain.ErrCacheKeyNil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, nil, err
+		}
 	}
 
-	userCache := &domain.UserCache{}
+	// The access token lives as long as the refresh token family that
+	// issued it, so logging out or a detected reuse kills both.
+	var family *domain.TokenFamily
 
-	if role != nil {
-		userCache.ID = user.ID
-		userCache.Role = role.Name
+	if claims.SessionID != "" {
+		family = &domain.TokenFamily{}
+
+		err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+claims.SessionID, family)
+		if err == domain.ErrCacheKeyNil {
+			return nil, nil, domain.ErrTokenRevoked
+		}
 
-		permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
 		if err != nil {
 			log.Error().Stack().Err(err).Msg(err.Error())
-			return nil, err
+			return nil, nil, err
 		}
+	}
 
-		for _, permission := range permissions {
-			userCache.Permissions = append(userCache.Permissions, permission.Name)
+	// The tokens of a client or a service account live as long as its
+	// cached role, which is dropped when it is changed or deleted, and an
+	// impersonation token as long as its own cached role.
+	principalKey := ""
+
+	switch {
+	case claims.ServiceAccountID != 0:
+		principalKey = serviceAccountUserKey(claims.ServiceAccountID)
+	case claims.ClientID != "":
+		principalKey = clientUserKey(claims.ClientID)
+	case claims.Actor != nil:
+		principalKey = impersonationUserKey(claims.ID)
+	}
+
+	if principalKey != "" {
+		err := a.cacheRepo.Get(ctx, principalKey, &domain.UserCache{})
+		if err == domain.ErrCacheKeyNil {
+			return nil, nil, domain.ErrTokenRevoked
+		}
+
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, nil, err
 		}
 	}
 
-	if err := a.saveToken(ctx, user.Email, userCache, expiration); err != nil {
+	return claims, family, nil
+}
+
+// verifyToken checks the signature and the registered claims of the given token.
+func (a *authUseCase) verifyToken(token string) (jwt.Token, error) {
+	t, err := a.keys.Verify(token)
+	if err != nil {
 		log.Error().Stack().Err(err).Msg(err.Error())
-		return nil, err
+		return nil, domain.ErrInvalidToken
 	}
 
-	return payload, nil
+	return t, nil
+}
+
+func (a *authUseCase) Logout(ctx context.Context) error {
+	claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return domain.ErrUnauthorized
+	}
+
+	if err := a.revokeAccessToken(ctx, claims); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	if err := a.cacheRepo.Delete(ctx, sessionKeys(claims.SessionID)...); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (a *authUseCase) RevokeToken(ctx context.Context, token string) error {
+	current, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return domain.ErrUnauthorized
+	}
+
+	t, err := a.verifyToken(token)
+	if err != nil {
+		return err
+	}
+
+	// Refresh tokens carry the user ID directly, access tokens carry the
+	// whole "user" claim.
+	var userID int64
+
+	switch user := t.PrivateClaims()["user"].(type) {
+	case float64:
+		userID = int64(user)
+	case map[string]interface{}:
+		id, _ := user["user_id"].(float64)
+		userID = int64(id)
+	default:
+		return domain.ErrInvalidToken
+	}
+
+	currentID, _ := current.User["user_id"].(float64)
+
+	if userID != int64(currentID) && !a.Authorize(ctx, "revoke token", nil) {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return domain.ErrUnauthorized
+	}
+
+	if familyID, ok := t.PrivateClaims()["family"].(string); ok {
+		if err := a.cacheRepo.Delete(ctx, sessionKeys(familyID)...); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		return nil
+	}
+
+	claims := &domain.TokenClaims{
+		ID:        t.JwtID(),
+		ExpiresAt: t.Expiration(),
+		User:      t.PrivateClaims()["user"].(map[string]interface{}),
+	}
+
+	if err := a.revokeAccessToken(ctx, claims); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (a *authUseCase) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	claims, err := domain.SelfServiceClaims(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	userID, _ := claims.User["user_id"].(float64)
+
+	user, err := a.userRepo.GetByID(ctx, int64(userID))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 {
+		return domain.ErrUnauthorized
+	}
+
+	// Wrong passwords count toward the login lockout, so a stolen access
+	// token cannot be used to guess the password.
+	subjects := loginSubjects(ctx, user.Email)
+
+	if err := a.checkLogin(ctx, subjects); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if match := crypto.CheckPasswordHash(oldPassword, user.Password); !match {
+		if err := a.recordLoginFailure(ctx, subjects); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+
+		return domain.ErrWrongPassword
+	}
+
+	if oldPassword == newPassword {
+		return domain.ErrSamePassword
+	}
+
+	if err := a.checkPasswordPolicy(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := a.authRepo.ChangePassword(ctx, user.ID, hashedPassword, validation.CurrentPasswordPolicy().History); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	// Every other device has to log in again with the new password.
+	if err := a.revokeFamilies(ctx, user.ID, claims.SessionID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (a *authUseCase) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := a.authRepo.Authenticate(ctx, email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	// Unknown emails get the same answer, so this cannot be used to
+	// find out which accounts exist.
+	if user.ID == 0 {
+		return nil
+	}
+
+	expiration := viper.GetDuration(`password_reset.expiration`)
+	if expiration <= 0 {
+		expiration = 30 * time.Minute
+	}
+
+	token, err := a.storeOneTimeToken(ctx, passwordResetPrefix, user.ID, expiration)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	mail := &domain.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+			user.Name,
+			expiration,
+			linkWithToken(viper.GetString(`password_reset.url`), token),
+		),
+	}
+
+	// Sent in the background so the response time does not tell whether
+	// the account exists either.
+	go func() {
+		if err := a.mailer.Send(context.Background(), mail); err != nil {
+			log.Error().Stack().Err(err).Int64("user_id", user.ID).Msg(err.Error())
+		}
+	}()
+
+	return nil
+}
+
+func (a *authUseCase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	userID, err := a.consumeOneTimeToken(ctx, passwordResetPrefix, token)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrInvalidResetToken
+	}
+
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 {
+		return domain.ErrInvalidResetToken
+	}
+
+	if err := a.checkPasswordPolicy(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := a.authRepo.ChangePassword(ctx, user.ID, hashedPassword, validation.CurrentPasswordPolicy().History); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := a.revokeFamilies(ctx, user.ID, ""); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// checkPasswordPolicy checks a new password against the password policy,
+// including the name and email of the user, and makes sure it is not one
+// of the user's last passwords.
+func (a *authUseCase) checkPasswordPolicy(ctx context.Context, user *domain.User, password string) error {
+	if err := validation.IsAValidPassword(ctx, password, user.Name, user.Email); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return err
+	}
+
+	history := validation.CurrentPasswordPolicy().History
+	if history <= 0 {
+		return nil
+	}
+
+	hashes, err := a.authRepo.PasswordHistory(ctx, user.ID, history)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	// The current hash is checked as well, for users created before
+	// the history was kept.
+	hashes = append(hashes, user.Password)
+
+	for _, hash := range hashes {
+		if crypto.CheckPasswordHash(password, hash) {
+			return validation.PasswordPolicyError(validation.Violation{
+				Rule:    "history",
+				Message: fmt.Sprintf("must not be one of your last %d passwords", history),
+			})
+		}
+	}
+
+	return nil
+}
+
+// storeOneTimeToken creates a random single use token for the given user.
+// Only its hash is stored, and issuing a new one invalidates the previous.
+func (a *authUseCase) storeOneTimeToken(
+	ctx context.Context,
+	prefix string,
+	userID int64,
+	expiration time.Duration,
+) (string, error) {
+	token, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	userKey := prefix + "user:" + strconv.FormatInt(userID, 10)
+
+	previous := ""
+
+	err = a.cacheRepo.Get(ctx, userKey, &previous)
+	if err != nil && err != domain.ErrCacheKeyNil {
+		return "", err
+	}
+
+	if previous != "" {
+		if err := a.cacheRepo.Delete(ctx, prefix+previous); err != nil {
+			return "", err
+		}
+	}
+
+	hash := crypto.HashToken(token)
+
+	if err := a.saveToken(ctx, prefix+hash, userID, expiration); err != nil {
+		return "", err
+	}
+
+	if err := a.saveToken(ctx, userKey, hash, expiration); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeOneTimeToken returns the user of the given token and deletes it.
+// The token is read and deleted in one step, so concurrent requests
+// cannot both use it.
+func (a *authUseCase) consumeOneTimeToken(ctx context.Context, prefix, token string) (int64, error) {
+	var userID int64
+
+	if err := a.cacheRepo.GetDelete(ctx, prefix+crypto.HashToken(token), &userID); err != nil {
+		return 0, err
+	}
+
+	userKey := prefix + "user:" + strconv.FormatInt(userID, 10)
+
+	if err := a.cacheRepo.Delete(ctx, userKey); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// linkWithToken appends the token to the given link as a query parameter.
+func linkWithToken(link, token string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link + "?token=" + url.QueryEscape(token)
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// revokeAccessToken denylists the given access token until it expires and
+// drops the cached permissions of its session or impersonation.
+func (a *authUseCase) revokeAccessToken(ctx context.Context, claims *domain.TokenClaims) error {
+	if claims.ID == "" {
+		return domain.ErrInvalidToken
+	}
+
+	if ttl := time.Until(claims.ExpiresAt); ttl > 0 {
+		if err := a.saveToken(ctx, revokedTokenPrefix+claims.ID, true, ttl); err != nil {
+			return err
+		}
+	}
+
+	if claims.SessionID != "" {
+		if err := a.cacheRepo.Delete(ctx, sessionUserKey(claims.SessionID)); err != nil {
+			return err
+		}
+	}
+
+	if claims.Actor != nil {
+		if err := a.cacheRepo.Delete(ctx, impersonationUserKey(claims.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *authUseCase) refreshToken(
+	claimKey string,
+	claimValue interface{},
+	family *domain.TokenFamily,
+	expiration time.Time,
+) (string, error) {
+	if claimKey == "" || claimValue == nil {
+		return "", errors.New("refresh token claim is empty")
+	}
+
+	if family == nil || family.ID == "" || family.Current == "" {
+		return "", errors.New("refresh token family is empty")
+	}
+
+	t := jwt.New()
+	t.Set(jwt.JwtIDKey, family.Current)
+	t.Set(jwt.ExpirationKey, expiration.Unix())
+	t.Set("family", family.ID)
+	t.Set(claimKey, claimValue)
+
+	return a.signToken(t)
+}
+
+func (a *authUseCase) saveToken(
+	ctx context.Context,
+	key string,
+	value interface{},
+	expiration time.Duration,
+) error {
+	if err := a.cacheRepo.Set(ctx, key, value, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (a *authUseCase) RefreshToken(ctx context.Context, refreshToken string) (*domain.AuthToken, error) {
+	return a.rotateRefreshToken(ctx, refreshToken, "")
+}
+
+// rotateRefreshToken exchanges a refresh token of a session of the given
+// client, or of a first-party session when clientID is empty.
+func (a *authUseCase) rotateRefreshToken(
+	ctx context.Context,
+	refreshToken,
+	clientID string,
+) (*domain.AuthToken, error) {
+	token, err := a.verifyToken(refreshToken)
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	familyID, ok := token.PrivateClaims()["family"].(string)
+	if !ok || familyID == "" || token.JwtID() == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidRefreshToken.Error())
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	family := &domain.TokenFamily{}
+
+	if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+familyID, family); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	if family.ClientID != clientID {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	if family.Current != token.JwtID() {
+		return nil, a.refreshTokenReused(ctx, family, token.JwtID())
+	}
+
+	user, err := a.userRepo.GetByID(ctx, family.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		log.Error().Stack().Msg(domain.ErrInvalidRefreshToken.Error())
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	return a.issueToken(ctx, user, family)
+}
+
+// refreshTokenReused revokes a family whose refresh token was exchanged
+// more than once. A refresh token is single use: if an already exchanged
+// token shows up again, either the legitimate client or an attacker holds
+// a stolen copy, so everyone has to log in again.
+func (a *authUseCase) refreshTokenReused(ctx context.Context, family *domain.TokenFamily, jti string) error {
+	log.Warn().
+		Int64("user_id", family.UserID).
+		Str("family", family.ID).
+		Str("jti", jti).
+		Msg(domain.ErrRefreshTokenReused.Error())
+
+	if err := a.cacheRepo.Delete(ctx, tokenFamilyPrefix+family.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return domain.ErrRefreshTokenReused
+}
+
+// issueToken generates a new token pair for the given user and caches
+// its role and permissions. When family is nil a new refresh token
+// family is started, otherwise the given family is rotated.
+func (a *authUseCase) issueToken(
+	ctx context.Context,
+	user *domain.User,
+	family *domain.TokenFamily,
+) (*domain.AuthToken, error) {
+	// Every login and refresh ends here, a disabled user gets no token.
+	if user.DisabledAt != nil {
+		log.Warn().
+			Str("event", "login_refused").
+			Int64("user_id", user.ID).
+			Msg(domain.ErrUserDisabled.Error())
+
+		return nil, domain.ErrUserDisabled
+	}
+
+	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	auth := &domain.Auth{
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Role:   role.Name,
+	}
+
+	if family == nil {
+		familyID, err := crypto.RandomToken(16)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		family = &domain.TokenFamily{
+			ID:        familyID,
+			UserID:    user.ID,
+			UserAgent: userAgent(ctx),
+			IP:        clientIP(ctx),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
+	tokenExpiration := time.Now().Add(expiration)
+
+	t, err := a.newToken("user", auth, tokenExpiration)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	t.Set("sid", family.ID)
+
+	// The tokens of a session handed over to a relying party are meant
+	// for it and only carry the scopes it was granted.
+	if family.ClientID != "" {
+		t.Set(jwt.AudienceKey, family.ClientID)
+		t.Set("azp", family.ClientID)
+		t.Set("scope", strings.Join(family.Scopes, " "))
+	}
+
+	token, err := a.signToken(t)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	auth.Token = token
+
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	previous := family.Current
+	family.Current = jti
+
+	refreshExpiration := time.Now().AddDate(0, 0, viper.GetInt(`jwt.refresh_token_expiration`))
+	family.ExpiresAt = refreshExpiration
+
+	refreshToken, err := a.refreshToken("user", user.ID, family, refreshExpiration)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if previous == "" {
+		if err := a.saveToken(
+			ctx,
+			tokenFamilyPrefix+family.ID,
+			family,
+			time.Until(refreshExpiration),
+		); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+	} else {
+		// The family is only rotated if the refresh token being exchanged
+		// is still its current one. Another exchange of the same token got
+		// there first otherwise, which is a reuse.
+		swapped, err := a.cacheRepo.CompareAndSwap(
+			ctx,
+			tokenFamilyPrefix+family.ID,
+			"current",
+			previous,
+			family,
+			time.Until(refreshExpiration),
+		)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if !swapped {
+			return nil, a.refreshTokenReused(ctx, family, previous)
+		}
+	}
+
+	if err := a.trackFamily(ctx, family, time.Until(refreshExpiration)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	a.touchSession(ctx, family)
+
+	payload := &domain.AuthToken{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	if err := a.cacheUser(ctx, sessionUserKey(family.ID), user, role, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// cacheUser stores the role and permissions of the given user under the
+// key of one of its sessions or API keys, which is what Authorize checks
+// against.
+func (a *authUseCase) cacheUser(
+	ctx context.Context,
+	key string,
+	user *domain.User,
+	role *domain.Role,
+	expiration time.Duration,
+) error {
+	userCache := &domain.UserCache{}
+
+	if role != nil {
+		userCache.ID = user.ID
+		userCache.Role = role.Name
+
+		permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		for _, permission := range permissions {
+			userCache.Permissions = append(userCache.Permissions, permission.Name)
+		}
+	}
+
+	return a.saveToken(ctx, key, userCache, expiration)
+}
+
+// trackFamily adds the given family to the index of its user, dropping
+// the families that already expired or were revoked. The index is a set,
+// so concurrent logins do not drop each other's family.
+func (a *authUseCase) trackFamily(
+	ctx context.Context,
+	family *domain.TokenFamily,
+	expiration time.Duration,
+) error {
+	key := userFamiliesKey(family.UserID)
+
+	if err := a.cacheRepo.AddToSet(ctx, key, family.ID, expiration); err != nil {
+		return err
+	}
+
+	familyIDs, err := a.userFamilies(ctx, family.UserID)
+	if err != nil {
+		return err
+	}
+
+	dead := []string{}
+
+	for _, familyID := range familyIDs {
+		if familyID == family.ID {
+			continue
+		}
+
+		err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+familyID, &domain.TokenFamily{})
+		if err == domain.ErrCacheKeyNil {
+			dead = append(dead, familyID)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.cacheRepo.RemoveFromSet(ctx, key, dead...)
+}
+
+func (a *authUseCase) userFamilies(ctx context.Context, userID int64) ([]string, error) {
+	return a.cacheRepo.SetMembers(ctx, userFamiliesKey(userID))
+}
+
+// revokeFamilies revokes every refresh token family of the given user,
+// and with them their access tokens, except the one named by keep.
+func (a *authUseCase) revokeFamilies(ctx context.Context, userID int64, keep string) error {
+	familyIDs, err := a.userFamilies(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{}
+	revoked := []string{}
+
+	for _, familyID := range familyIDs {
+		if familyID != keep {
+			keys = append(keys, sessionKeys(familyID)...)
+			revoked = append(revoked, familyID)
+		}
+	}
+
+	if err := a.cacheRepo.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	// Only the revoked families are removed, a login happening meanwhile
+	// stays in the index.
+	return a.cacheRepo.RemoveFromSet(ctx, userFamiliesKey(userID), revoked...)
+}
+
+func userFamiliesKey(userID int64) string {
+	return userFamiliesPrefix + strconv.FormatInt(userID, 10)
 }
@@ -1 +1,953 @@
 package usecase_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cyruzin/puppet_master/domain"
+	rds "github.com/cyruzin/puppet_master/modules/auth/repository/redis"
+	"github.com/cyruzin/puppet_master/modules/auth/usecase"
+	mfaUsecase "github.com/cyruzin/puppet_master/modules/mfa/usecase"
+	passkeyUsecase "github.com/cyruzin/puppet_master/modules/passkey/usecase"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPassword = "correct horse battery staple"
+	testMFACode  = "287082"
+
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	testServiceAccountSecret = "service account secret"
+)
+
+type testAuthRepository struct {
+	domain.AuthRepository
+	user *domain.User
+}
+
+func (r *testAuthRepository) Authenticate(ctx context.Context, email string) (*domain.User, error) {
+	if email != r.user.Email {
+		return &domain.User{}, nil
+	}
+
+	return r.user, nil
+}
+
+func (r *testAuthRepository) VerifyEmail(ctx context.Context, userID int64, email string) error {
+	verifiedAt := time.Now()
+	r.user.EmailVerifiedAt = &verifiedAt
+
+	return nil
+}
+
+type testUserRepository struct {
+	domain.UserRepository
+	user *domain.User
+}
+
+func (r *testUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if id != r.user.ID {
+		return &domain.User{}, nil
+	}
+
+	return r.user, nil
+}
+
+type testRoleRepository struct {
+	domain.RoleRepository
+	role *domain.Role
+}
+
+func (r *testRoleRepository) GetRoleByUserID(ctx context.Context, id int64) (*domain.Role, error) {
+	return r.role, nil
+}
+
+func (r *testRoleRepository) GetByID(ctx context.Context, id int64) (*domain.Role, error) {
+	return r.role, nil
+}
+
+type testPermissionRepository struct {
+	domain.PermissionRepository
+}
+
+func (r *testPermissionRepository) GetPermissionsByRoleName(ctx context.Context, name string) ([]*domain.Permission, error) {
+	return []*domain.Permission{{ID: 1, Name: "view user"}}, nil
+}
+
+type testMFAUsecase struct {
+	domain.MFAUsecase
+	enabled bool
+}
+
+func (u *testMFAUsecase) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	return u.enabled, nil
+}
+
+func (u *testMFAUsecase) Verify(ctx context.Context, userID int64, code string) error {
+	if code != testMFACode {
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+type testPasskeyUsecase struct {
+	domain.PasskeyUsecase
+	userID       int64
+	userVerified bool
+}
+
+func (u *testPasskeyUsecase) FinishLogin(ctx context.Context, credential string) (int64, bool, error) {
+	return u.userID, u.userVerified, nil
+}
+
+type testServiceAccountRepository struct {
+	domain.ServiceAccountRepository
+	serviceAccount *domain.ServiceAccount
+	credential     *domain.ServiceAccountCredential
+}
+
+func (r *testServiceAccountRepository) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	if id != r.serviceAccount.ID {
+		return &domain.ServiceAccount{}, nil
+	}
+
+	return r.serviceAccount, nil
+}
+
+func (r *testServiceAccountRepository) GetCredentialByClientID(
+	ctx context.Context,
+	clientID string,
+) (*domain.ServiceAccountCredential, error) {
+	if clientID != r.credential.ClientID {
+		return &domain.ServiceAccountCredential{}, nil
+	}
+
+	return r.credential, nil
+}
+
+func (r *testServiceAccountRepository) TouchCredential(ctx context.Context, id int64, usedAt time.Time) error {
+	r.credential.LastUsedAt = &usedAt
+
+	return nil
+}
+
+type testMailer struct {
+	mails chan *domain.Mail
+}
+
+func (m *testMailer) Send(ctx context.Context, mail *domain.Mail) error {
+	m.mails <- mail
+
+	return nil
+}
+
+type testClientRepository struct {
+	domain.ClientRepository
+	client *domain.Client
+}
+
+func (r *testClientRepository) GetByClientID(ctx context.Context, clientID string) (*domain.Client, error) {
+	if clientID != r.client.ClientID {
+		return &domain.Client{}, nil
+	}
+
+	return r.client, nil
+}
+
+type testAuth struct {
+	usecase domain.AuthUsecase
+	cache   *miniredis.Miniredis
+	user    *domain.User
+	mfa     *testMFAUsecase
+	passkey *testPasskeyUsecase
+	client  *domain.Client
+	role    *domain.Role
+	mailer  *testMailer
+
+	serviceAccount *testServiceAccountRepository
+}
+
+type testDirectoryRepository struct {
+	entry *domain.DirectoryUser
+	err   error
+}
+
+func (r *testDirectoryRepository) Authenticate(ctx context.Context, username, password string) (*domain.DirectoryUser, error) {
+	return r.entry, r.err
+}
+
+type testIdentityRepository struct {
+	domain.FederatedIdentityRepository
+	identity *domain.FederatedIdentity
+}
+
+func (r *testIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*domain.FederatedIdentity, error) {
+	if r.identity == nil || r.identity.Provider != provider || r.identity.Subject != subject {
+		return &domain.FederatedIdentity{}, nil
+	}
+
+	return r.identity, nil
+}
+
+func (r *testIdentityRepository) GetByUserID(ctx context.Context, provider string, userID int64) (*domain.FederatedIdentity, error) {
+	if r.identity == nil || r.identity.Provider != provider || r.identity.UserID != userID {
+		return &domain.FederatedIdentity{}, nil
+	}
+
+	return r.identity, nil
+}
+
+func newTestAuth(t *testing.T) *testAuth {
+	return newTestDirectoryAuth(t, nil, nil)
+}
+
+// newTestDirectoryAuth returns a testAuth checking passwords against the
+// given LDAP directory first.
+func newTestDirectoryAuth(
+	t *testing.T,
+	directory domain.DirectoryRepository,
+	identity domain.FederatedIdentityRepository,
+) *testAuth {
+	viper.Set(`jwt.token_expiration`, 15)
+	viper.Set(`jwt.refresh_token_expiration`, 7)
+
+	cache, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(cache.Close)
+
+	key, err := keyring.GenerateKey("HS256")
+	require.NoError(t, err)
+
+	password, err := crypto.HashPassword(testPassword)
+	require.NoError(t, err)
+
+	user := &domain.User{ID: 2, Name: "Homer Simpson", Email: "homer@simpsons.org", Password: password}
+	mfa := &testMFAUsecase{}
+	passkey := &testPasskeyUsecase{userID: user.ID}
+	role := &domain.Role{ID: 2, Name: "Viewer"}
+	mailer := &testMailer{mails: make(chan *domain.Mail, 10)}
+	serviceAccount := &testServiceAccountRepository{
+		serviceAccount: &domain.ServiceAccount{ID: 7, Name: "reporting", RoleID: role.ID},
+		credential: &domain.ServiceAccountCredential{
+			ID:               1,
+			ServiceAccountID: 7,
+			ClientID:         "sa_reporting",
+			Secret:           crypto.HashToken(testServiceAccountSecret),
+		},
+	}
+	client := &domain.Client{
+		ID:           1,
+		ClientID:     "app",
+		Public:       true,
+		RedirectURIs: testRedirectURI,
+		Scopes:       "reports:read",
+	}
+
+	auth := usecase.NewAuthUsecase(
+		&testAuthRepository{user: user},
+		rds.NewRedisCacheRepository(redis.NewClient(&redis.Options{Addr: cache.Addr()})),
+		&testPermissionRepository{},
+		&testRoleRepository{role: role},
+		&testUserRepository{user: user},
+		&testClientRepository{client: client},
+		nil,
+		serviceAccount,
+		identity,
+		directory,
+		keyring.New(key),
+		mailer,
+		mfa,
+		passkey,
+		nil,
+		nil,
+	)
+
+	return &testAuth{usecase: auth, cache: cache, user: user, mfa: mfa, passkey: passkey, client: client, role: role, mailer: mailer, serviceAccount: serviceAccount}
+}
+
+func TestRefreshTokenConcurrentReuse(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	token, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+
+	const exchanges = 10
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		refreshed []*domain.AuthToken
+		reused    int
+	)
+
+	for i := 0; i < exchanges; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			next, err := auth.usecase.RefreshToken(ctx, token.RefreshToken)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err == nil {
+				refreshed = append(refreshed, next)
+				return
+			}
+
+			if err == domain.ErrRefreshTokenReused || err == domain.ErrInvalidRefreshToken {
+				reused++
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// At most one exchange wins the rotation, and the others revoke the
+	// family, so the winner cannot keep using it either.
+	assert.LessOrEqual(t, len(refreshed), 1)
+	assert.Equal(t, exchanges-len(refreshed), reused)
+
+	for _, next := range refreshed {
+		_, err := auth.usecase.RefreshToken(ctx, next.RefreshToken)
+		assert.Error(t, err)
+
+		_, err = auth.usecase.ParseToken(ctx, next.Token)
+		assert.Equal(t, domain.ErrTokenRevoked, err)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	token, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+
+	next, err := auth.usecase.RefreshToken(ctx, token.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = auth.usecase.RefreshToken(ctx, next.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = auth.usecase.RefreshToken(ctx, token.RefreshToken)
+	assert.Equal(t, domain.ErrRefreshTokenReused, err)
+}
+
+func TestConcurrentLoginsAreAllRevoked(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	const logins = 10
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		tokens []*domain.AuthToken
+	)
+
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			token, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			tokens = append(tokens, token)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	sessions, err := auth.usecase.FetchSessions(ctx, auth.user.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, logins)
+
+	admin := context.WithValue(ctx, domain.ContextKeyClaims, &domain.TokenClaims{User: map[string]interface{}{"user_id": float64(1)}})
+
+	require.NoError(t, auth.usecase.RevokeSessions(admin, auth.user.ID))
+
+	for _, token := range tokens {
+		_, err := auth.usecase.RefreshToken(ctx, token.RefreshToken)
+		assert.Error(t, err)
+	}
+}
+
+func TestMagicLinkIsUsedOnce(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	verifiedAt := time.Now()
+	auth.user.EmailVerifiedAt = &verifiedAt
+
+	token, err := crypto.RandomToken(32)
+	require.NoError(t, err)
+	require.NoError(t, auth.cache.Set("magic_link:"+crypto.HashToken(token), "2"))
+
+	const logins = 10
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := auth.usecase.ConsumeMagicLink(ctx, token)
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+}
+
+func setTestConfig(t *testing.T, key string, value interface{}) {
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, nil) })
+}
+
+func TestVerifyMFAConcurrentGuesses(t *testing.T) {
+	setTestConfig(t, `lockout.free_attempts`, 100)
+	setTestConfig(t, `lockout.email_threshold`, 100)
+
+	auth := newTestAuth(t)
+	auth.mfa.enabled = true
+	ctx := context.Background()
+
+	challenge, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+	require.True(t, challenge.MFARequired)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Guesses made after the challenge is discarded find no token.
+			_, err := auth.usecase.VerifyMFA(ctx, challenge.MFAToken, "000000")
+			assert.Contains(t, []error{domain.ErrInvalidMFACode, domain.ErrInvalidMFAToken}, err)
+		}()
+	}
+
+	wg.Wait()
+
+	// Every guess counted, so the challenge is gone even for the right code.
+	_, err = auth.usecase.VerifyMFA(ctx, challenge.MFAToken, testMFACode)
+	assert.Equal(t, domain.ErrInvalidMFAToken, err)
+}
+
+func TestVerifyMFACountsTowardLockout(t *testing.T) {
+	setTestConfig(t, `lockout.email_threshold`, 3)
+
+	auth := newTestAuth(t)
+	auth.mfa.enabled = true
+	ctx := context.Background()
+
+	challenge, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := auth.usecase.VerifyMFA(ctx, challenge.MFAToken, "000000")
+		assert.Equal(t, domain.ErrInvalidMFACode, err)
+	}
+
+	_, err = auth.usecase.VerifyMFA(ctx, challenge.MFAToken, testMFACode)
+	assert.Equal(t, domain.ErrAccountLocked, err)
+
+	_, err = auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	assert.Equal(t, domain.ErrAccountLocked, err)
+}
+
+func TestVerifyMFA(t *testing.T) {
+	auth := newTestAuth(t)
+	auth.mfa.enabled = true
+	ctx := context.Background()
+
+	challenge, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+
+	token, err := auth.usecase.VerifyMFA(ctx, challenge.MFAToken, testMFACode)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token.Token)
+
+	_, err = auth.usecase.VerifyMFA(ctx, challenge.MFAToken, testMFACode)
+	assert.Equal(t, domain.ErrInvalidMFAToken, err)
+}
+
+func TestPasskeyWithoutUserVerification(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	token, err := auth.usecase.AuthenticateWithPasskey(ctx, "credential")
+	require.NoError(t, err)
+	assert.NotEmpty(t, token.Token)
+
+	// With MFA, a passkey that only proved presence is one factor.
+	auth.mfa.enabled = true
+
+	token, err = auth.usecase.AuthenticateWithPasskey(ctx, "credential")
+	require.NoError(t, err)
+	assert.True(t, token.MFARequired)
+	assert.Empty(t, token.Token)
+
+	_, err = auth.usecase.VerifyMFA(ctx, token.MFAToken, testMFACode)
+	assert.NoError(t, err)
+
+	auth.passkey.userVerified = true
+
+	token, err = auth.usecase.AuthenticateWithPasskey(ctx, "credential")
+	require.NoError(t, err)
+	assert.False(t, token.MFARequired)
+	assert.NotEmpty(t, token.Token)
+}
+
+func (a *testAuth) cacheUser(t *testing.T, key string, userCache *domain.UserCache) {
+	data, err := json.Marshal(userCache)
+	require.NoError(t, err)
+	require.NoError(t, a.cache.Set(key, string(data)))
+}
+
+func TestAuthorizeScopedClientToken(t *testing.T) {
+	setTestConfig(t, `oauth.scopes`, []map[string]interface{}{
+		{"name": "reports:read", "permissions": []string{"view report"}},
+	})
+
+	auth := newTestAuth(t)
+
+	auth.cacheUser(t, "client_user:reporting", &domain.UserCache{
+		Role:        "Manager",
+		Permissions: []string{"view report", "delete report"},
+	})
+
+	authorize := func(claims *domain.TokenClaims, permission string, roles ...string) bool {
+		ctx := context.WithValue(context.Background(), domain.ContextKeyClaims, claims)
+		return auth.usecase.Authorize(ctx, permission, roles)
+	}
+
+	scoped := &domain.TokenClaims{ClientID: "reporting", Scopes: []string{"reports:read"}}
+
+	assert.True(t, authorize(scoped, "view report"))
+	assert.False(t, authorize(scoped, "delete report"))
+	assert.False(t, authorize(scoped, "delete report", "Manager"))
+
+	// Scopes that are not configured allow nothing.
+	assert.False(t, authorize(&domain.TokenClaims{ClientID: "reporting", Scopes: []string{"reports:write"}}, "view report"))
+
+	// Without scopes the role decides.
+	assert.True(t, authorize(&domain.TokenClaims{ClientID: "reporting"}, "delete report"))
+
+	auth.cacheUser(t, "client_user:reporting", &domain.UserCache{Role: "Admin"})
+
+	assert.True(t, authorize(scoped, "view report"))
+	assert.False(t, authorize(scoped, "delete report"))
+}
+
+func TestServiceAccountTokens(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := auth.usecase.ClientCredentials(ctx, "sa_reporting", "wrong secret", "")
+	assert.Equal(t, domain.ErrOAuthInvalidClient, err)
+
+	_, err = auth.usecase.ClientCredentials(ctx, "sa_unknown", testServiceAccountSecret, "")
+	assert.Equal(t, domain.ErrOAuthInvalidClient, err)
+
+	_, err = auth.usecase.ClientCredentials(ctx, "sa_reporting", testServiceAccountSecret, "reports:read")
+	assert.Equal(t, domain.ErrOAuthInvalidScope, err)
+
+	assert.Nil(t, auth.serviceAccount.credential.LastUsedAt)
+
+	token, err := auth.usecase.ClientCredentials(ctx, "sa_reporting", testServiceAccountSecret, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.NotNil(t, auth.serviceAccount.credential.LastUsedAt)
+
+	claims, err := auth.usecase.ParseToken(ctx, token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), claims.ServiceAccountID)
+	assert.Empty(t, claims.SessionID)
+
+	// The permissions come from the role cached for the service account.
+	assert.True(t, auth.cache.Exists("service_account_user:7"))
+
+	claimsCtx := context.WithValue(ctx, domain.ContextKeyClaims, claims)
+	assert.True(t, auth.usecase.Authorize(claimsCtx, "view user", nil))
+	assert.False(t, auth.usecase.Authorize(claimsCtx, "delete user", nil))
+
+	require.NoError(t, auth.usecase.RevokeServiceAccountTokens(ctx, 7))
+
+	assert.False(t, auth.usecase.Authorize(claimsCtx, "view user", nil))
+
+	_, err = auth.usecase.ParseToken(ctx, token.AccessToken)
+	assert.Equal(t, domain.ErrTokenRevoked, err)
+}
+
+func (a *testAuth) authorizationCode(t *testing.T, scope string) string {
+	ctx := context.Background()
+
+	token, err := a.usecase.Authenticate(ctx, a.user.Email, testPassword)
+	require.NoError(t, err)
+
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+
+	code, err := a.usecase.IssueAuthorizationCode(ctx, &domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            "app",
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+	}, token)
+	require.NoError(t, err)
+
+	// The tokens of the login are not handed over.
+	_, err = a.usecase.ParseToken(ctx, token.Token)
+	assert.Equal(t, domain.ErrTokenRevoked, err)
+
+	_, err = a.usecase.RefreshToken(ctx, token.RefreshToken)
+	assert.Error(t, err)
+
+	return code
+}
+
+func TestExchangeAuthorizationCodeIssuesClientTokens(t *testing.T) {
+	setTestConfig(t, `oauth.scopes`, []map[string]interface{}{
+		{"name": "reports:read", "permissions": []string{"view report"}},
+	})
+
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	code := auth.authorizationCode(t, "openid reports:read")
+
+	token, err := auth.usecase.ExchangeAuthorizationCode(ctx, "app", "", code, testRedirectURI, testCodeVerifier)
+	require.NoError(t, err)
+	assert.Equal(t, "openid reports:read", token.Scope)
+	assert.NotEmpty(t, token.IDToken)
+
+	claims, err := auth.usecase.ParseToken(ctx, token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "app", claims.AuthorizedParty)
+	assert.Equal(t, []string{"openid", "reports:read"}, claims.Scopes)
+
+	authorized := context.WithValue(ctx, domain.ContextKeyClaims, claims)
+
+	// The role of the user allows "view user", the scopes do not.
+	assert.False(t, auth.usecase.Authorize(authorized, "view user", nil))
+
+	// Refreshed tokens stay bound to the client.
+	refreshed, err := auth.usecase.RefreshOAuthToken(ctx, "app", "", token.RefreshToken)
+	require.NoError(t, err)
+
+	claims, err = auth.usecase.ParseToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "app", claims.AuthorizedParty)
+
+	// Codes are single use.
+	_, err = auth.usecase.ExchangeAuthorizationCode(ctx, "app", "", code, testRedirectURI, testCodeVerifier)
+	assert.Equal(t, domain.ErrOAuthInvalidGrant, err)
+}
+
+func TestOpenIDTokensAreDeniedEverything(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	code := auth.authorizationCode(t, "openid profile")
+
+	token, err := auth.usecase.ExchangeAuthorizationCode(ctx, "app", "", code, testRedirectURI, testCodeVerifier)
+	require.NoError(t, err)
+
+	claims, err := auth.usecase.ParseToken(ctx, token.AccessToken)
+	require.NoError(t, err)
+
+	authorized := context.WithValue(ctx, domain.ContextKeyClaims, claims)
+
+	assert.False(t, auth.usecase.Authorize(authorized, "view user", []string{"Viewer"}))
+
+	info, err := auth.usecase.UserInfo(authorized)
+	require.NoError(t, err)
+	assert.Equal(t, "Homer Simpson", info["name"])
+}
+
+func TestRelyingPartyTokensCannotManageCredentials(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	code := auth.authorizationCode(t, "openid profile")
+
+	token, err := auth.usecase.ExchangeAuthorizationCode(ctx, "app", "", code, testRedirectURI, testCodeVerifier)
+	require.NoError(t, err)
+
+	claims, err := auth.usecase.ParseToken(ctx, token.AccessToken)
+	require.NoError(t, err)
+
+	authorized := context.WithValue(ctx, domain.ContextKeyClaims, claims)
+
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.ChangePassword(authorized, testPassword, "a brand new passphrase"))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSessions(authorized, auth.user.ID))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSession(authorized, auth.user.ID, claims.SessionID))
+
+	users := &testUserRepository{user: auth.user}
+
+	mfa := mfaUsecase.NewMFAUsecase(nil, users, nil, nil)
+
+	_, err = mfa.Enroll(authorized)
+	assert.Equal(t, domain.ErrUnauthorized, err)
+
+	assert.Equal(t, domain.ErrUnauthorized, mfa.Disable(authorized, testMFACode))
+
+	_, err = passkeyUsecase.NewPasskeyUsecase(nil, nil, nil, users, nil).BeginRegistration(authorized)
+	assert.Equal(t, domain.ErrUnauthorized, err)
+
+	// The login of the user still manages its sessions.
+	_, err = domain.SelfServiceClaims(context.WithValue(ctx, domain.ContextKeyClaims, &domain.TokenClaims{
+		SessionID: "family",
+		User:      map[string]interface{}{"user_id": float64(auth.user.ID)},
+	}))
+	assert.NoError(t, err)
+}
+
+func TestIntrospectionRequiresTheIntrospectScope(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	auth.client.Public = false
+	auth.client.Secret = crypto.HashToken("secret")
+
+	token, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	require.NoError(t, err)
+
+	_, err = auth.usecase.IntrospectToken(ctx, "app", "secret", token.Token)
+	assert.Equal(t, domain.ErrOAuthIntrospectionDenied, err)
+
+	auth.client.Scopes = "reports:read introspect"
+
+	introspection, err := auth.usecase.IntrospectToken(ctx, "app", "secret", token.Token)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+
+	// The scope is never granted to the tokens of the client.
+	_, err = auth.usecase.ClientCredentials(ctx, "app", "secret", "introspect")
+	assert.Equal(t, domain.ErrOAuthInvalidScope, err)
+}
+
+func TestAPIKeysCannotManageCredentials(t *testing.T) {
+	auth := newTestAuth(t)
+
+	ctx := context.WithValue(context.Background(), domain.ContextKeyClaims, &domain.TokenClaims{
+		APIKeyID: 1,
+		User:     map[string]interface{}{"user_id": float64(auth.user.ID)},
+	})
+
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.ChangePassword(ctx, testPassword, "a brand new passphrase"))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSessions(ctx, auth.user.ID))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSession(ctx, auth.user.ID, "family"))
+}
+
+func TestDirectoryUsersDoNotFallBackToLocalPasswords(t *testing.T) {
+	ctx := context.Background()
+
+	for name, directory := range map[string]*testDirectoryRepository{
+		"unreachable": {err: errors.New("connection refused")},
+		"removed":     {entry: &domain.DirectoryUser{}},
+	} {
+		linked := newTestDirectoryAuth(t, directory, &testIdentityRepository{identity: &domain.FederatedIdentity{
+			ID:       1,
+			UserID:   2,
+			Provider: "ldap",
+			Subject:  "uid=homer,ou=people,dc=simpsons,dc=org",
+		}})
+
+		_, err := linked.usecase.Authenticate(ctx, linked.user.Email, testPassword)
+		assert.EqualError(t, err, "authentication failed", name)
+
+		local := newTestDirectoryAuth(t, directory, &testIdentityRepository{})
+
+		_, err = local.usecase.Authenticate(ctx, local.user.Email, testPassword)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestAdminsAreNeverLinked(t *testing.T) {
+	auth := newTestDirectoryAuth(t, &testDirectoryRepository{entry: &domain.DirectoryUser{
+		DN:    "uid=homer,ou=people,dc=simpsons,dc=org",
+		Email: "homer@simpsons.org",
+	}}, &testIdentityRepository{})
+
+	auth.role.Name = "Admin"
+
+	_, err := auth.usecase.Authenticate(context.Background(), auth.user.Email, testPassword)
+	assert.Equal(t, domain.ErrFederationLinkAdmin, err)
+}
+
+func TestDisabledUsersFailLikeWrongPasswords(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	_, wrongPassword := auth.usecase.Authenticate(ctx, auth.user.Email, "not the password")
+
+	disabledAt := time.Now()
+	auth.user.DisabledAt = &disabledAt
+
+	_, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	assert.EqualError(t, err, wrongPassword.Error())
+}
+
+func TestImpersonationTokensCannotManageCredentials(t *testing.T) {
+	auth := newTestAuth(t)
+
+	ctx := context.WithValue(context.Background(), domain.ContextKeyClaims, &domain.TokenClaims{
+		Actor: map[string]interface{}{"sub": "1"},
+		User:  map[string]interface{}{"user_id": float64(auth.user.ID)},
+	})
+
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.ChangePassword(ctx, testPassword, "a brand new passphrase"))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSessions(ctx, auth.user.ID))
+	assert.Equal(t, domain.ErrUnauthorized, auth.usecase.RevokeSession(ctx, auth.user.ID, "family"))
+}
+
+func TestImpersonate(t *testing.T) {
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	support := &domain.TokenClaims{
+		SessionID: "support",
+		User:      map[string]interface{}{"user_id": float64(5), "name": "Ned Flanders"},
+	}
+
+	impersonate := func() (*domain.AuthToken, error) {
+		return auth.usecase.Impersonate(context.WithValue(ctx, domain.ContextKeyClaims, support), auth.user.ID)
+	}
+
+	// The user can "view user", the support staff cannot.
+	auth.cacheUser(t, "session_user:support", &domain.UserCache{
+		Role:        "Support",
+		Permissions: []string{"impersonate user"},
+	})
+
+	_, err := impersonate()
+	assert.Equal(t, domain.ErrImpersonatePermissions, err)
+
+	auth.cacheUser(t, "session_user:support", &domain.UserCache{
+		Role:        "Support",
+		Permissions: []string{"impersonate user", "view user"},
+	})
+
+	token, err := impersonate()
+	require.NoError(t, err)
+
+	claims, err := auth.usecase.ParseToken(ctx, token.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "5", claims.Actor["sub"])
+	assert.Empty(t, token.RefreshToken)
+
+	authorized := context.WithValue(ctx, domain.ContextKeyClaims, claims)
+
+	assert.True(t, auth.usecase.Authorize(authorized, "view user", nil))
+	assert.False(t, auth.usecase.Authorize(authorized, "impersonate user", nil))
+
+	// An impersonation token cannot impersonate again.
+	_, err = auth.usecase.Impersonate(authorized, auth.user.ID)
+	assert.Equal(t, domain.ErrUnauthorized, err)
+
+	auth.role.Name = "Admin"
+
+	_, err = impersonate()
+	assert.Equal(t, domain.ErrImpersonateAdmin, err)
+}
+
+func TestChangePasswordCountsTowardLockout(t *testing.T) {
+	auth := newTestAuth(t)
+
+	ctx := context.WithValue(context.Background(), domain.ContextKeyClaims, &domain.TokenClaims{
+		SessionID: "family",
+		User:      map[string]interface{}{"user_id": float64(auth.user.ID)},
+	})
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, domain.ErrWrongPassword, auth.usecase.ChangePassword(ctx, "not the password", "a brand new passphrase"))
+	}
+
+	assert.Equal(t, domain.ErrTooManyAttempts, auth.usecase.ChangePassword(ctx, testPassword, "a brand new passphrase"))
+
+	_, err := auth.usecase.Authenticate(ctx, auth.user.Email, testPassword)
+	assert.Equal(t, domain.ErrTooManyAttempts, err)
+}
+
+func TestPasswordResetTokensExpireByDefault(t *testing.T) {
+	setTestConfig(t, `password_reset.expiration`, 0)
+
+	auth := newTestAuth(t)
+
+	require.NoError(t, auth.usecase.RequestPasswordReset(context.Background(), auth.user.Email))
+
+	for _, key := range auth.cache.Keys() {
+		assert.Equal(t, 30*time.Minute, auth.cache.TTL(key), key)
+	}
+
+	mail := <-auth.mailer.mails
+	assert.Contains(t, mail.Body, "It expires in 30m0s")
+}
+
+func TestVerifyEmailRefusesTokensOfAChangedEmail(t *testing.T) {
+	setTestConfig(t, `email_verification.url`, "https://app.example.com/verify")
+
+	auth := newTestAuth(t)
+	ctx := context.Background()
+
+	require.NoError(t, auth.usecase.SendEmailVerification(ctx, auth.user.ID))
+
+	mail := <-auth.mailer.mails
+	link, err := url.Parse(strings.Fields(mail.Body[strings.Index(mail.Body, "https://"):])[0])
+	require.NoError(t, err)
+
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+
+	auth.user.Email = "homer.simpson@simpsons.org"
+
+	assert.Equal(t, domain.ErrInvalidVerificationToken, auth.usecase.VerifyEmail(ctx, token))
+	assert.Nil(t, auth.user.EmailVerifiedAt)
+
+	auth.user.Email = "homer@simpsons.org"
+
+	require.NoError(t, auth.usecase.VerifyEmail(ctx, token))
+	assert.NotNil(t, auth.user.EmailVerifiedAt)
+}
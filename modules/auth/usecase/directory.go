@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// directoryProvider is the provider of the federated identities linking
+// users to their LDAP entry.
+const directoryProvider = "ldap"
+
+// directoryUser authenticates a user against the LDAP directory. The
+// user is found by their entry, linked by email or created, gets the
+// name and email of the entry and the role of their groups. It returns
+// no user when the directory is not configured, does not know the user
+// or cannot be reached, local accounts that are not linked to it are
+// checked then.
+func (a *authUseCase) directoryUser(ctx context.Context, username, password string) (*domain.User, error) {
+	if a.directoryRepo == nil {
+		return nil, nil
+	}
+
+	entry, err := a.directoryRepo.Authenticate(ctx, username, password)
+	if err == domain.ErrDirectoryInvalidCredentials {
+		return nil, err
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("LDAP directory unavailable, checking local accounts")
+		return nil, nil
+	}
+
+	if entry.DN == "" {
+		return nil, nil
+	}
+
+	if entry.Email == "" {
+		log.Warn().
+			Str("event", "directory_login_refused").
+			Str("dn", entry.DN).
+			Msg(domain.ErrDirectoryUserEmail.Error())
+
+		return nil, domain.ErrDirectoryUserEmail
+	}
+
+	// The directory administrators manage the emails of its users, so
+	// they are trusted like verified ones.
+	user, created, err := a.federatedUser(ctx, directoryProvider, &federatedAccount{
+		Subject:       entry.DN,
+		Email:         entry.Email,
+		EmailVerified: true,
+		Name:          entry.Name,
+		Groups:        entry.Groups,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		user, err = a.syncDirectoryUser(ctx, user, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	roleMapping := []domain.FederationRoleMapping{}
+
+	if err := viper.UnmarshalKey(`ldap.role_mapping`, &roleMapping); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := a.syncFederatedRole(
+		ctx,
+		directoryProvider,
+		roleMapping,
+		viper.GetString(`ldap.default_role`),
+		entry.Groups,
+		user.ID,
+		created,
+	); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// directoryLinked tells whether a user is linked to an LDAP entry. Their
+// local password is never checked then: it was not set by the user, and
+// an entry removed from the directory must not fall back to it.
+func (a *authUseCase) directoryLinked(ctx context.Context, userID int64) (bool, error) {
+	if a.directoryRepo == nil || userID == 0 {
+		return false, nil
+	}
+
+	identity, err := a.identityRepo.GetByUserID(ctx, directoryProvider, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, err
+	}
+
+	return identity.ID != 0, nil
+}
+
+// syncDirectoryUser updates the name and email of a user when they
+// changed in the directory.
+func (a *authUseCase) syncDirectoryUser(
+	ctx context.Context,
+	user *domain.User,
+	entry *domain.DirectoryUser,
+) (*domain.User, error) {
+	name := entry.Name
+	if name == "" {
+		name = entry.Email
+	}
+
+	if user.Name == name && user.Email == entry.Email {
+		return user, nil
+	}
+
+	user.Name = name
+	user.Email = entry.Email
+	user.UpdatedAt = time.Now()
+
+	user, err := a.userRepo.Update(ctx, user)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	// Update clears the verification of a changed email, the directory
+	// vouches for the new one.
+	if err := a.authRepo.VerifyEmail(ctx, user.ID, user.Email); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	log.Info().
+		Str("event", "directory_user_synced").
+		Int64("user_id", user.ID).
+		Msg("user updated from the LDAP directory")
+
+	user, err = a.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,485 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/oidc"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	federationStatePrefix = "federation_state:"
+	federatedLoginPrefix  = "federated_login:"
+)
+
+// federationProvider is a configured identity provider with its OpenID
+// Connect client.
+type federationProvider struct {
+	*domain.FederationProvider
+	client *oidc.Provider
+}
+
+// federatedAccount is the account of a user at an identity provider or
+// in the LDAP directory.
+type federatedAccount struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// federationState is what is kept of a federated login between the
+// redirect to the identity provider and the callback.
+type federationState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// newFederationProviders creates the clients of the configured identity
+// providers. Their callback is served under the oidc.issuer URL.
+// Misconfigured providers are left out.
+func newFederationProviders(providers []*domain.FederationProvider) map[string]*federationProvider {
+	federation := map[string]*federationProvider{}
+
+	for _, provider := range providers {
+		client, err := oidc.NewProvider(oidc.Config{
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  oidcIssuer() + "/federation/" + provider.Name + "/callback",
+			Scopes:       provider.Scopes,
+			HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		})
+		if err != nil || provider.Name == "" || provider.Name == directoryProvider {
+			log.Error().Str("provider", provider.Name).Msg("invalid identity provider configuration")
+			continue
+		}
+
+		federation[provider.Name] = &federationProvider{FederationProvider: provider, client: client}
+	}
+
+	return federation
+}
+
+// FederatedLoginURL starts a login with an external identity provider.
+// It returns the URL of the provider the user is sent to and the state
+// of the login, which the callback must get back.
+func (a *authUseCase) FederatedLoginURL(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := a.federation[providerName]
+	if !ok {
+		return "", "", domain.ErrFederationProvider
+	}
+
+	state, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	nonce, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	codeVerifier, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	authURL, err := provider.client.AuthCodeURL(
+		ctx,
+		state,
+		nonce,
+		base64.RawURLEncoding.EncodeToString(challenge[:]),
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Str("provider", providerName).Msg(err.Error())
+		return "", "", err
+	}
+
+	expiration := viper.GetDuration(`federation.state_expiration`)
+	if expiration <= 0 {
+		expiration = 10 * time.Minute
+	}
+
+	loginState := &federationState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	}
+
+	if err := a.saveToken(ctx, federationStatePrefix+crypto.HashToken(state), loginState, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// FederatedCallback completes a login with an external identity
+// provider. The user is found by the provider account, linked by their
+// verified email or created, and gets the role of their groups. It
+// returns the federation.redirect_url link with a single use token the
+// frontend exchanges with ConsumeFederatedLogin.
+func (a *authUseCase) FederatedCallback(ctx context.Context, providerName, state, code string) (string, error) {
+	provider, ok := a.federation[providerName]
+	if !ok {
+		return "", domain.ErrFederationProvider
+	}
+
+	loginState := &federationState{}
+	key := federationStatePrefix + crypto.HashToken(state)
+
+	if state == "" || a.cacheRepo.GetDelete(ctx, key, loginState) != nil {
+		return "", domain.ErrInvalidFederationState
+	}
+
+	if loginState.Provider != providerName || code == "" {
+		return "", domain.ErrInvalidFederationState
+	}
+
+	claims, err := provider.client.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("event", "federated_login_failed").
+			Str("provider", providerName).
+			Str("client_ip", clientIP(ctx)).
+			Msg(err.Error())
+
+		return "", domain.ErrInvalidFederatedLogin
+	}
+
+	account := &federatedAccount{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}
+
+	if provider.GroupsClaim != "" {
+		account.Groups = claims.Strings(provider.GroupsClaim)
+	}
+
+	return a.completeFederatedLogin(ctx, provider.Name, account, provider.RoleMapping, provider.DefaultRole)
+}
+
+// completeFederatedLogin signs in the user of a provider account. It
+// returns the federation.redirect_url link with the single use token of
+// the login.
+func (a *authUseCase) completeFederatedLogin(
+	ctx context.Context,
+	providerName string,
+	account *federatedAccount,
+	roleMapping []domain.FederationRoleMapping,
+	defaultRole string,
+) (string, error) {
+	user, created, err := a.federatedUser(ctx, providerName, account)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.syncFederatedRole(
+		ctx,
+		providerName,
+		roleMapping,
+		defaultRole,
+		account.Groups,
+		user.ID,
+		created,
+	); err != nil {
+		return "", err
+	}
+
+	expiration := viper.GetDuration(`federation.login_expiration`)
+	if expiration <= 0 {
+		expiration = time.Minute
+	}
+
+	token, err := a.storeOneTimeToken(ctx, federatedLoginPrefix, user.ID, expiration)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	log.Info().
+		Str("event", "federated_login").
+		Str("provider", providerName).
+		Int64("user_id", user.ID).
+		Bool("created", created).
+		Msg("user signed in with an identity provider")
+
+	return linkWithToken(viper.GetString(`federation.redirect_url`), token), nil
+}
+
+// ConsumeFederatedLogin logs in with the token of a federated login. Like
+// a magic link, the identity provider replaces the password only, so
+// users with MFA still get a challenge.
+func (a *authUseCase) ConsumeFederatedLogin(ctx context.Context, token string) (*domain.AuthToken, error) {
+	userID, err := a.consumeOneTimeToken(ctx, federatedLoginPrefix, token)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidFederatedLogin
+	}
+
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrInvalidFederatedLogin
+	}
+
+	mfaEnabled, err := a.mfaUseCase.IsEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if mfaEnabled {
+		return a.mfaChallenge(ctx, user.ID)
+	}
+
+	return a.issueToken(ctx, user, nil)
+}
+
+// federatedUser returns the user of a provider account. An account seen
+// for the first time is linked to the user with the same email, which
+// the provider must have verified, or a new user is created for it.
+// Admins are never linked, whoever controls the email at the provider
+// would sign in as them.
+func (a *authUseCase) federatedUser(
+	ctx context.Context,
+	providerName string,
+	account *federatedAccount,
+) (*domain.User, bool, error) {
+	identity, err := a.identityRepo.GetBySubject(ctx, providerName, account.Subject)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, false, err
+	}
+
+	if identity.ID != 0 {
+		user, err := a.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, false, err
+		}
+
+		if user.ID == 0 {
+			return nil, false, domain.ErrInvalidFederatedLogin
+		}
+
+		if err := a.identityRepo.Touch(ctx, identity.ID, account.Email, time.Now()); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+
+		return user, false, nil
+	}
+
+	if account.Email == "" || !account.EmailVerified {
+		log.Warn().
+			Str("event", "federated_login_refused").
+			Str("provider", providerName).
+			Str("subject", account.Subject).
+			Msg(domain.ErrFederationEmailNotVerified.Error())
+
+		return nil, false, domain.ErrFederationEmailNotVerified
+	}
+
+	user, err := a.authRepo.Authenticate(ctx, account.Email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, false, err
+	}
+
+	created := user.ID == 0
+
+	if created {
+		user, err = a.createFederatedUser(ctx, account)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, false, err
+		}
+
+		if role.Name == "Admin" {
+			log.Warn().
+				Str("event", "federated_login_refused").
+				Str("provider", providerName).
+				Int64("user_id", user.ID).
+				Msg(domain.ErrFederationLinkAdmin.Error())
+
+			return nil, false, domain.ErrFederationLinkAdmin
+		}
+	}
+
+	// The provider verified the email, like following a verification
+	// link would.
+	if user.EmailVerifiedAt == nil {
+		if err := a.authRepo.VerifyEmail(ctx, user.ID, user.Email); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, false, err
+		}
+	}
+
+	now := time.Now()
+
+	if _, err := a.identityRepo.Store(ctx, &domain.FederatedIdentity{
+		UserID:      user.ID,
+		Provider:    providerName,
+		Subject:     account.Subject,
+		Email:       account.Email,
+		LastLoginAt: &now,
+		CreatedAt:   now,
+	}); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, false, err
+	}
+
+	log.Info().
+		Str("event", "federated_identity_linked").
+		Str("provider", providerName).
+		Int64("user_id", user.ID).
+		Bool("created", created).
+		Msg("identity provider account linked")
+
+	return user, created, nil
+}
+
+// createFederatedUser creates the user of a provider account. It gets a
+// random password nobody knows, a password can be set with a reset.
+func (a *authUseCase) createFederatedUser(ctx context.Context, account *federatedAccount) (*domain.User, error) {
+	password, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	name := account.Name
+	if name == "" {
+		name = account.Email
+	}
+
+	user, err := a.userRepo.Store(ctx, &domain.User{
+		Name:      name,
+		Email:     account.Email,
+		Password:  hashedPassword,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// syncFederatedRole gives the user the role mapped to their groups on
+// every login. When no mapping matches, new users get the default role
+// and the role of existing users is left as is. Groups are compared
+// ignoring case, like LDAP compares DNs.
+func (a *authUseCase) syncFederatedRole(
+	ctx context.Context,
+	providerName string,
+	roleMapping []domain.FederationRoleMapping,
+	defaultRole string,
+	groups []string,
+	userID int64,
+	created bool,
+) error {
+	roleName := ""
+
+mapping:
+	for _, mapping := range roleMapping {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.Group) {
+				roleName = mapping.Role
+				break mapping
+			}
+		}
+	}
+
+	if roleName == "" && created {
+		roleName = defaultRole
+	}
+
+	if roleName == "" {
+		return nil
+	}
+
+	roles, err := a.roleRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	var role *domain.Role
+
+	for _, r := range roles {
+		if r.Name == roleName {
+			role = r
+			break
+		}
+	}
+
+	if role == nil {
+		log.Error().
+			Str("provider", providerName).
+			Str("role", roleName).
+			Msg("the role of the identity provider mapping does not exist")
+
+		return nil
+	}
+
+	current, err := a.roleRepo.GetRoleByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if current.ID == role.ID {
+		return nil
+	}
+
+	if err := a.roleRepo.SyncRoleToUser(ctx, int(role.ID), userID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "federated_role_synced").
+		Str("provider", providerName).
+		Int64("user_id", userID).
+		Str("role", role.Name).
+		Msg("role given by the identity provider groups")
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const impersonationUserPrefix = "impersonation_user:"
+
+// Impersonate issues a short-lived access token for the given user to
+// the admin of the current session. The token carries an "act" claim
+// naming the admin (RFC 8693 section 4.1) and has no refresh token nor
+// session, it acts with the permissions of the user until it expires or
+// is logged out. Impersonation is only allowed from a user session and
+// never against a user with the Admin role or with a permission the
+// admin does not have, who could otherwise grant it to themselves.
+func (a *authUseCase) Impersonate(ctx context.Context, userID int64) (*domain.AuthToken, error) {
+	claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok || claims.SessionID == "" || claims.Actor != nil {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	actorID, ok := claims.User["user_id"].(float64)
+	if !ok || actorID == 0 {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	if int64(actorID) == userID {
+		return nil, domain.ErrBadRequest
+	}
+
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	if user.DisabledAt != nil {
+		return nil, domain.ErrUserDisabled
+	}
+
+	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if role.Name == "Admin" {
+		log.Warn().
+			Str("event", "impersonation_refused").
+			Int64("actor_id", int64(actorID)).
+			Int64("user_id", user.ID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrImpersonateAdmin.Error())
+
+		return nil, domain.ErrImpersonateAdmin
+	}
+
+	if err := a.checkImpersonationPermissions(ctx, claims.SessionID, role); err != nil {
+		log.Warn().
+			Str("event", "impersonation_refused").
+			Int64("actor_id", int64(actorID)).
+			Int64("user_id", user.ID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(err.Error())
+
+		return nil, err
+	}
+
+	expiration := viper.GetDuration(`impersonation.token_expiration`)
+	if expiration <= 0 {
+		expiration = 15 * time.Minute
+	}
+
+	t, err := a.newToken(
+		"user",
+		&domain.Auth{
+			UserID: user.ID,
+			Name:   user.Name,
+			Email:  user.Email,
+			Role:   role.Name,
+		},
+		time.Now().Add(expiration),
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	t.Set("act", map[string]interface{}{
+		"sub":     strconv.FormatInt(int64(actorID), 10),
+		"user_id": int64(actorID),
+		"name":    claims.User["name"],
+		"email":   claims.User["email"],
+	})
+
+	if err := a.cacheUser(ctx, impersonationUserKey(t.JwtID()), user, role, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	token, err := a.signToken(t)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("event", "impersonation_started").
+		Int64("actor_id", int64(actorID)).
+		Int64("user_id", user.ID).
+		Str("client_ip", clientIP(ctx)).
+		Time("expires_at", t.Expiration()).
+		Msg("access token issued to impersonate a user")
+
+	return &domain.AuthToken{Token: token}, nil
+}
+
+func impersonationUserKey(tokenID string) string {
+	return impersonationUserPrefix + tokenID
+}
+
+// checkImpersonationPermissions makes sure the admin of the session has
+// every permission of the role to impersonate.
+func (a *authUseCase) checkImpersonationPermissions(ctx context.Context, sessionID string, role *domain.Role) error {
+	actor := &domain.UserCache{}
+
+	err := a.cacheRepo.Get(ctx, sessionUserKey(sessionID), actor)
+	if err == domain.ErrCacheKeyNil {
+		return domain.ErrUnauthorized
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if actor.Role == "Admin" {
+		return nil
+	}
+
+	permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	for _, permission := range permissions {
+		if !containsString(actor.Permissions, permission.Name) {
+			return domain.ErrImpersonatePermissions
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package usecase
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/rs/zerolog/log"
+)
+
+// IntrospectToken tells an authenticated client whether an access or
+// refresh token is active and who it belongs to (RFC 7662). Only clients
+// with the introspect scope may ask, the answer tells who holds a token.
+// Checking a token does not count as activity of its session.
+func (a *authUseCase) IntrospectToken(
+	ctx context.Context,
+	clientID,
+	clientSecret,
+	token string,
+) (*domain.Introspection, error) {
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsString(strings.Fields(client.Scopes), introspectScope) {
+		log.Warn().
+			Str("event", "introspection_refused").
+			Str("client_id", client.ClientID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrOAuthIntrospectionDenied.Error())
+
+		return nil, domain.ErrOAuthIntrospectionDenied
+	}
+
+	if token == "" {
+		return nil, domain.ErrOAuthInvalidRequest
+	}
+
+	if claims, _, err := a.parseAccessToken(ctx, token); err == nil {
+		return a.introspectAccessToken(ctx, claims)
+	}
+
+	if t, family, err := a.parseRefreshToken(ctx, token); err == nil {
+		return a.introspectRefreshToken(ctx, t, family)
+	}
+
+	return &domain.Introspection{Active: false}, nil
+}
+
+// RevokeOAuthToken revokes an access or refresh token issued to the
+// client (RFC 7009). Revoking a refresh token signs its session out.
+// Unknown tokens and the tokens of other clients are ignored, the
+// response must not tell them apart.
+func (a *authUseCase) RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error {
+	client, err := a.authenticatePublicClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		return domain.ErrOAuthInvalidRequest
+	}
+
+	if claims, family, err := a.parseAccessToken(ctx, token); err == nil {
+		owner := claims.ClientID
+
+		if family != nil {
+			owner = family.ClientID
+		}
+
+		if owner != client.ClientID {
+			log.Warn().
+				Str("event", "token_revocation_refused").
+				Str("client_id", client.ClientID).
+				Msg("token was not issued to the client")
+
+			return nil
+		}
+
+		if err := a.revokeAccessToken(ctx, claims); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		return nil
+	}
+
+	if _, family, err := a.parseRefreshToken(ctx, token); err == nil {
+		if family.ClientID != client.ClientID {
+			log.Warn().
+				Str("event", "token_revocation_refused").
+				Str("client_id", client.ClientID).
+				Msg("token was not issued to the client")
+
+			return nil
+		}
+
+		if err := a.cacheRepo.Delete(ctx, sessionKeys(family.ID)...); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		log.Info().
+			Str("event", "session_revoked").
+			Int64("user_id", family.UserID).
+			Str("session_id", family.ID).
+			Str("client_id", client.ClientID).
+			Msg("session revoked by its client")
+	}
+
+	return nil
+}
+
+func (a *authUseCase) introspectAccessToken(
+	ctx context.Context,
+	claims *domain.TokenClaims,
+) (*domain.Introspection, error) {
+	introspection := &domain.Introspection{
+		Active:    true,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		JwtID:     claims.ID,
+		SessionID: claims.SessionID,
+		ClientID:  claims.ClientID,
+		Scope:     strings.Join(claims.Scopes, " "),
+	}
+
+	userKey := sessionUserKey(claims.SessionID)
+
+	switch {
+	case claims.ServiceAccountID != 0:
+		introspection.Subject = domain.ServiceAccountClientPrefix + strconv.FormatInt(claims.ServiceAccountID, 10)
+		introspection.Username, _ = claims.User["name"].(string)
+		userKey = serviceAccountUserKey(claims.ServiceAccountID)
+	case claims.ClientID != "":
+		introspection.Subject = claims.ClientID
+		userKey = clientUserKey(claims.ClientID)
+	default:
+		userID, _ := claims.User["user_id"].(float64)
+		introspection.Subject = strconv.FormatInt(int64(userID), 10)
+		introspection.Username, _ = claims.User["email"].(string)
+	}
+
+	if claims.Actor != nil {
+		introspection.Actor = claims.Actor
+		userKey = impersonationUserKey(claims.ID)
+	}
+
+	if claims.SessionID != "" {
+		family := &domain.TokenFamily{}
+
+		if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+claims.SessionID, family); err == nil && family.ClientID != "" {
+			introspection.ClientID = family.ClientID
+			introspection.Scope = strings.Join(family.Scopes, " ")
+		}
+	}
+
+	// Authorize denies a token without cached permissions, so it is not
+	// active either.
+	userCache := &domain.UserCache{}
+
+	err := a.cacheRepo.Get(ctx, userKey, userCache)
+	if err == domain.ErrCacheKeyNil {
+		return &domain.Introspection{Active: false}, nil
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	introspection.Role = userCache.Role
+	introspection.Permissions = userCache.Permissions
+
+	if len(claims.Scopes) > 0 || claims.AuthorizedParty != "" {
+		introspection.Permissions = limitToScopes(userCache.Permissions, claims.Scopes)
+	}
+
+	return introspection, nil
+}
+
+func (a *authUseCase) introspectRefreshToken(
+	ctx context.Context,
+	t jwt.Token,
+	family *domain.TokenFamily,
+) (*domain.Introspection, error) {
+	introspection := &domain.Introspection{
+		Active:    true,
+		TokenType: "refresh_token",
+		ExpiresAt: t.Expiration().Unix(),
+		Subject:   strconv.FormatInt(family.UserID, 10),
+		JwtID:     t.JwtID(),
+		SessionID: family.ID,
+		ClientID:  family.ClientID,
+		Scope:     strings.Join(family.Scopes, " "),
+	}
+
+	// The permissions of a session are cached as long as its access
+	// tokens, an idle session has none until it is refreshed.
+	userCache := &domain.UserCache{}
+
+	err := a.cacheRepo.Get(ctx, sessionUserKey(family.ID), userCache)
+	if err != nil && err != domain.ErrCacheKeyNil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	introspection.Role = userCache.Role
+	introspection.Permissions = userCache.Permissions
+
+	if family.ClientID != "" {
+		introspection.Permissions = limitToScopes(userCache.Permissions, family.Scopes)
+	}
+
+	return introspection, nil
+}
+
+// parseRefreshToken verifies a refresh token and returns its family. Only
+// the latest refresh token of a family that was not revoked is valid.
+func (a *authUseCase) parseRefreshToken(ctx context.Context, token string) (jwt.Token, *domain.TokenFamily, error) {
+	t, err := a.verifyToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	familyID, ok := t.PrivateClaims()["family"].(string)
+	if !ok || familyID == "" || t.JwtID() == "" {
+		return nil, nil, domain.ErrInvalidRefreshToken
+	}
+
+	family := &domain.TokenFamily{}
+
+	if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+familyID, family); err != nil {
+		return nil, nil, domain.ErrInvalidRefreshToken
+	}
+
+	if family.Current != t.JwtID() {
+		return nil, nil, domain.ErrInvalidRefreshToken
+	}
+
+	return t, family, nil
+}
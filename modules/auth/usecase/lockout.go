@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	loginFailuresPrefix = "login_failures:"
+	loginDelayPrefix    = "login_delay:"
+	loginLockPrefix     = "login_lock:"
+)
+
+// loginLimiter counts failed logins and locks out the emails and IP
+// addresses guessing passwords.
+type loginLimiter struct {
+	cacheRepo domain.CacheRepository
+}
+
+// NewLoginLimiter will create new a loginLimiter object representation
+// of domain.LoginLimiter interface.
+func NewLoginLimiter(cache domain.CacheRepository) domain.LoginLimiter {
+	return &loginLimiter{cacheRepo: cache}
+}
+
+// Check refuses the attempt while the email or the IP address of the
+// request is locked or still has to wait.
+func (l *loginLimiter) Check(ctx context.Context, email string) error {
+	return l.checkLogin(ctx, loginSubjects(ctx, email))
+}
+
+// RecordFailure counts a failed attempt for the email and the IP address
+// of the request.
+func (l *loginLimiter) RecordFailure(ctx context.Context, email string) error {
+	return l.recordLoginFailure(ctx, loginSubjects(ctx, email))
+}
+
+// loginSubject is something failed logins are counted for: the email
+// that was tried or the IP address they came from.
+type loginSubject struct {
+	kind      string
+	value     string
+	threshold int64
+}
+
+func (s loginSubject) key(prefix string) string {
+	return prefix + s.kind + ":" + s.value
+}
+
+func emailSubject(email string) loginSubject {
+	return loginSubject{
+		kind:      "email",
+		value:     strings.ToLower(strings.TrimSpace(email)),
+		threshold: lockoutInt(`lockout.email_threshold`, 10),
+	}
+}
+
+func loginSubjects(ctx context.Context, email string) []loginSubject {
+	subjects := []loginSubject{emailSubject(email)}
+
+	if ip := clientIP(ctx); ip != "" {
+		subjects = append(subjects, loginSubject{
+			kind:      "ip",
+			value:     ip,
+			threshold: lockoutInt(`lockout.ip_threshold`, 100),
+		})
+	}
+
+	return subjects
+}
+
+// checkLogin refuses the attempt while any of the subjects is locked or
+// still has to wait after its last failure.
+func (l *loginLimiter) checkLogin(ctx context.Context, subjects []loginSubject) error {
+	for _, subject := range subjects {
+		var flag bool
+
+		err := l.cacheRepo.Get(ctx, subject.key(loginLockPrefix), &flag)
+		if err == nil {
+			return domain.ErrAccountLocked
+		}
+
+		if err != domain.ErrCacheKeyNil {
+			return err
+		}
+
+		err = l.cacheRepo.Get(ctx, subject.key(loginDelayPrefix), &flag)
+		if err == nil {
+			return domain.ErrTooManyAttempts
+		}
+
+		if err != domain.ErrCacheKeyNil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt. After a few free attempts
+// each failure doubles the wait before the next one, and reaching the
+// threshold locks the subject for lockout.duration.
+func (l *loginLimiter) recordLoginFailure(ctx context.Context, subjects []loginSubject) error {
+	window := lockoutDuration(`lockout.window`, 15*time.Minute)
+	freeAttempts := lockoutInt(`lockout.free_attempts`, 3)
+
+	for _, subject := range subjects {
+		failures, err := l.cacheRepo.Increment(ctx, subject.key(loginFailuresPrefix), window)
+		if err != nil {
+			return err
+		}
+
+		if failures >= subject.threshold {
+			duration := lockoutDuration(`lockout.duration`, 15*time.Minute)
+
+			if err := l.cacheRepo.Set(ctx, subject.key(loginLockPrefix), true, duration); err != nil {
+				return err
+			}
+
+			if err := l.cacheRepo.Delete(ctx, subject.key(loginFailuresPrefix)); err != nil {
+				return err
+			}
+
+			log.Warn().
+				Str("event", "login_locked").
+				Str("subject", subject.kind).
+				Str(subject.kind, subject.value).
+				Str("client_ip", clientIP(ctx)).
+				Int64("failures", failures).
+				Dur("duration", duration).
+				Msg("login locked after too many failed attempts")
+
+			continue
+		}
+
+		if failures > freeAttempts {
+			maxDelay := lockoutDuration(`lockout.max_delay`, 30*time.Second)
+
+			delay := maxDelay
+			if shift := failures - freeAttempts - 1; shift < 30 {
+				delay = lockoutDuration(`lockout.base_delay`, time.Second) << shift
+			}
+
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+
+			if err := l.cacheRepo.Set(ctx, subject.key(loginDelayPrefix), true, delay); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resetLoginFailures clears the counters of a subject.
+func (l *loginLimiter) resetLoginFailures(ctx context.Context, subject loginSubject) error {
+	return l.cacheRepo.Delete(
+		ctx,
+		subject.key(loginFailuresPrefix),
+		subject.key(loginDelayPrefix),
+		subject.key(loginLockPrefix),
+	)
+}
+
+func (a *authUseCase) UnlockUser(ctx context.Context, userID int64) error {
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 {
+		return domain.ErrNotFound
+	}
+
+	if err := a.resetLoginFailures(ctx, emailSubject(user.Email)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "login_unlocked").
+		Int64("user_id", user.ID).
+		Str("email", user.Email).
+		Msg("login unlocked by an admin")
+
+	return nil
+}
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(domain.ContextKeyClientIP).(string)
+
+	return ip
+}
+
+func lockoutInt(key string, fallback int64) int64 {
+	if value := viper.GetInt64(key); value > 0 {
+		return value
+	}
+
+	return fallback
+}
+
+func lockoutDuration(key string, fallback time.Duration) time.Duration {
+	if value := viper.GetDuration(key); value > 0 {
+		return value
+	}
+
+	return fallback
+}
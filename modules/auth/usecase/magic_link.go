@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const magicLinkPrefix = "magic_link:"
+
+// RequestMagicLink emails a single use login link. Like
+// RequestPasswordReset, it answers the same way for every address.
+func (a *authUseCase) RequestMagicLink(ctx context.Context, email string) error {
+	user, err := a.authRepo.Authenticate(ctx, email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 {
+		return nil
+	}
+
+	expiration := viper.GetDuration(`magic_link.expiration`)
+	if expiration <= 0 {
+		expiration = 15 * time.Minute
+	}
+
+	token, err := a.storeOneTimeToken(ctx, magicLinkPrefix, user.ID, expiration)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	mail := &domain.Mail{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to log in. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+			user.Name,
+			expiration,
+			linkWithToken(viper.GetString(`magic_link.url`), token),
+		),
+	}
+
+	go func() {
+		if err := a.mailer.Send(context.Background(), mail); err != nil {
+			log.Error().Stack().Err(err).Int64("user_id", user.ID).Msg(err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// ConsumeMagicLink logs in with the token of a magic link. The link
+// replaces the password only, so users with MFA still get a challenge.
+// Following it proves the email belongs to the user, so it is marked
+// as verified too.
+func (a *authUseCase) ConsumeMagicLink(ctx context.Context, token string) (*domain.AuthToken, error) {
+	userID, err := a.consumeOneTimeToken(ctx, magicLinkPrefix, token)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidMagicLink
+	}
+
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrInvalidMagicLink
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := a.authRepo.VerifyEmail(ctx, user.ID, user.Email); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+	}
+
+	mfaEnabled, err := a.mfaUseCase.IsEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if mfaEnabled {
+		return a.mfaChallenge(ctx, user.ID)
+	}
+
+	return a.issueToken(ctx, user, nil)
+}
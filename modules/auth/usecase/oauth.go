@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const clientUserPrefix = "client_user:"
+
+// introspectScope allows a client to introspect tokens. It is a right of
+// the client itself and is never granted to its tokens.
+const introspectScope = "introspect"
+
+// ClientCredentials issues an access token to a machine client (RFC 6749
+// section 4.4). The token acts with the permissions of the client's
+// role, which are cached like the ones of a user session.
+func (a *authUseCase) ClientCredentials(
+	ctx context.Context,
+	clientID,
+	clientSecret,
+	scope string,
+) (*domain.OAuthToken, error) {
+	if strings.HasPrefix(clientID, domain.ServiceAccountClientPrefix) {
+		return a.serviceAccountToken(ctx, clientID, clientSecret, scope)
+	}
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := grantScopes(grantableScopes(client), scope)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := a.roleRepo.GetByID(ctx, client.RoleID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	expiration := viper.GetDuration(`oauth.token_expiration`)
+	if expiration <= 0 {
+		expiration = time.Hour
+	}
+
+	t, err := a.newToken(
+		"user",
+		map[string]interface{}{"client_id": client.ClientID, "name": client.Name, "role": role.Name},
+		time.Now().Add(expiration),
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	t.Set("client_id", client.ClientID)
+
+	if len(scopes) > 0 {
+		t.Set("scope", strings.Join(scopes, " "))
+	}
+
+	token, err := a.signToken(t)
+	if err != nil {
+		return nil, err
+	}
+
+	userCache := &domain.UserCache{Role: role.Name}
+
+	permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	for _, permission := range permissions {
+		userCache.Permissions = append(userCache.Permissions, permission.Name)
+	}
+
+	// Every token of a client shares the cache, it lives as long as the
+	// newest one.
+	if err := a.saveToken(ctx, clientUserKey(client.ClientID), userCache, expiration); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("event", "client_token_issued").
+		Str("client_id", client.ClientID).
+		Strs("scopes", scopes).
+		Msg("access token issued to a client")
+
+	return &domain.OAuthToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiration.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// RevokeClientTokens revokes every access token of a client.
+func (a *authUseCase) RevokeClientTokens(ctx context.Context, clientID string) error {
+	if err := a.cacheRepo.Delete(ctx, clientUserKey(clientID)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// authenticateClient checks the credentials of a client. Secrets are
+// random, so a SHA-256 hash is enough to store them.
+func (a *authUseCase) authenticateClient(ctx context.Context, clientID, clientSecret string) (*domain.Client, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	client, err := a.clientRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if client.ID == 0 || subtle.ConstantTimeCompare([]byte(crypto.HashToken(clientSecret)), []byte(client.Secret)) != 1 {
+		log.Warn().
+			Str("event", "client_authentication_failed").
+			Str("client_id", clientID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrOAuthInvalidClient.Error())
+
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	return client, nil
+}
+
+// grantableScopes returns the scopes of a client its tokens can be
+// granted.
+func grantableScopes(client *domain.Client) string {
+	scopes := []string{}
+
+	for _, scope := range strings.Fields(client.Scopes) {
+		if scope != introspectScope {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return strings.Join(scopes, " ")
+}
+
+// grantScopes returns the requested scopes, or every allowed scope when
+// none is requested. Asking for a scope the client is not allowed is an
+// error.
+func grantScopes(allowed, requested string) ([]string, error) {
+	allowedScopes := strings.Fields(allowed)
+
+	if strings.TrimSpace(requested) == "" {
+		return allowedScopes, nil
+	}
+
+	granted := []string{}
+
+	for _, scope := range strings.Fields(requested) {
+		if !containsString(allowedScopes, scope) {
+			return nil, domain.ErrOAuthInvalidScope
+		}
+
+		if !containsString(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return granted, nil
+}
+
+// scopePermissions returns the permissions allowed by the given scopes.
+// Scopes missing from oauth.scopes allow nothing.
+func scopePermissions(scopes []string) []string {
+	configured := []domain.OAuthScope{}
+
+	if err := viper.UnmarshalKey(`oauth.scopes`, &configured); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil
+	}
+
+	permissions := []string{}
+
+	for _, scope := range configured {
+		if containsString(scopes, scope.Name) {
+			permissions = append(permissions, scope.Permissions...)
+		}
+	}
+
+	return permissions
+}
+
+// limitToScopes returns the permissions that are also allowed by the
+// given scopes.
+func limitToScopes(permissions, scopes []string) []string {
+	allowed := scopePermissions(scopes)
+
+	limited := []string{}
+
+	for _, permission := range permissions {
+		if containsString(allowed, permission) {
+			limited = append(limited, permission)
+		}
+	}
+
+	return limited
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func clientUserKey(clientID string) string {
+	return clientUserPrefix + clientID
+}
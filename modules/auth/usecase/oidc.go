@@ -0,0 +1,542 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const authorizationCodePrefix = "authorization_code:"
+
+// oidcScopes are the OpenID Connect scopes every relying party may ask
+// for, on top of the scopes of the client.
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// ValidateAuthorizationRequest checks an authorization request against
+// the registered client. When the client is returned with an error, the
+// redirect_uri is trusted and the error can be sent back to it.
+func (a *authUseCase) ValidateAuthorizationRequest(
+	ctx context.Context,
+	req *domain.AuthorizationRequest,
+) (*domain.Client, error) {
+	if req.ClientID == "" {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	client, err := a.clientRepo.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if client.ID == 0 {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	// Redirect URIs are compared as is, a prefix match would let an
+	// attacker pick a path on the client's host.
+	if req.RedirectURI == "" || !containsString(strings.Fields(client.RedirectURIs), req.RedirectURI) {
+		return nil, domain.ErrOAuthInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return client, domain.ErrOAuthUnsupportedResponseType
+	}
+
+	if req.CodeChallengeMethod != "S256" || !validPKCEValue(req.CodeChallenge) {
+		return client, domain.ErrOAuthPKCERequired
+	}
+
+	if _, err := authorizationScopes(client, req.Scope); err != nil {
+		return client, err
+	}
+
+	return client, nil
+}
+
+// IssueAuthorizationCode returns the code of an authorization request
+// for the login of the user. The session of the login is handed over to
+// the client and keeps the granted scopes, and the tokens of the login
+// are revoked: the client gets tokens of its own from the exchange.
+func (a *authUseCase) IssueAuthorizationCode(
+	ctx context.Context,
+	req *domain.AuthorizationRequest,
+	token *domain.AuthToken,
+) (string, error) {
+	client, err := a.ValidateAuthorizationRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	scopes, err := authorizationScopes(client, req.Scope)
+	if err != nil {
+		return "", err
+	}
+
+	if token == nil || token.Token == "" {
+		return "", domain.ErrOAuthAccessDenied
+	}
+
+	claims, err := a.ParseToken(ctx, token.Token)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	userID, ok := claims.User["user_id"].(float64)
+	if !ok || userID == 0 || claims.SessionID == "" || claims.AuthorizedParty != "" || claims.Actor != nil {
+		log.Error().Stack().Msg(domain.ErrInvalidToken.Error())
+		return "", domain.ErrInvalidToken
+	}
+
+	family := &domain.TokenFamily{}
+
+	if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+claims.SessionID, family); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	if family.ClientID != "" {
+		return "", domain.ErrInvalidToken
+	}
+
+	if err := a.revokeAccessToken(ctx, claims); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	family.ClientID = client.ClientID
+	family.Scopes = scopes
+
+	if err := a.saveToken(ctx, tokenFamilyPrefix+family.ID, family, time.Until(family.ExpiresAt)); err != nil {
+		return "", err
+	}
+
+	code, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	authorizationCode := &domain.AuthorizationCode{
+		ClientID:      client.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		UserID:        int64(userID),
+		SessionID:     claims.SessionID,
+		AuthTime:      time.Now(),
+	}
+
+	expiration := viper.GetDuration(`oidc.code_expiration`)
+	if expiration <= 0 {
+		expiration = time.Minute
+	}
+
+	if err := a.saveToken(ctx, authorizationCodePrefix+crypto.HashToken(code), authorizationCode, expiration); err != nil {
+		return "", err
+	}
+
+	log.Info().
+		Str("event", "authorization_code_issued").
+		Str("client_id", client.ClientID).
+		Int64("user_id", int64(userID)).
+		Strs("scopes", scopes).
+		Msg("authorization code issued")
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode exchanges an authorization code for its
+// tokens (RFC 6749 section 4.1.3). The code is single use and bound to
+// the client, the redirect_uri and the PKCE code challenge. A failed
+// exchange revokes the session, the code may have been stolen. The
+// tokens are issued for the client, with the granted scopes, and
+// Authorize limits them to the permissions of those scopes.
+func (a *authUseCase) ExchangeAuthorizationCode(
+	ctx context.Context,
+	clientID,
+	clientSecret,
+	code,
+	redirectURI,
+	codeVerifier string,
+) (*domain.OAuthToken, error) {
+	client, err := a.authenticateRelyingParty(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if code == "" || codeVerifier == "" {
+		return nil, domain.ErrOAuthInvalidRequest
+	}
+
+	key := authorizationCodePrefix + crypto.HashToken(code)
+
+	authorizationCode := &domain.AuthorizationCode{}
+
+	// A code is redeemed once, so it is deleted as it is read.
+	err = a.cacheRepo.GetDelete(ctx, key, authorizationCode)
+	if err == domain.ErrCacheKeyNil {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if authorizationCode.ClientID != client.ClientID ||
+		authorizationCode.RedirectURI != redirectURI ||
+		!verifyCodeChallenge(authorizationCode.CodeChallenge, codeVerifier) {
+		log.Warn().
+			Str("event", "authorization_code_rejected").
+			Str("client_id", client.ClientID).
+			Int64("user_id", authorizationCode.UserID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrOAuthInvalidGrant.Error())
+
+		if err := a.cacheRepo.Delete(ctx, sessionKeys(authorizationCode.SessionID)...); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	family := &domain.TokenFamily{}
+
+	err = a.cacheRepo.Get(ctx, tokenFamilyPrefix+authorizationCode.SessionID, family)
+	if err == domain.ErrCacheKeyNil || (err == nil && family.ClientID != client.ClientID) {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	user, err := a.userRepo.GetByID(ctx, family.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	authToken, err := a.issueToken(ctx, user, family)
+	if err == domain.ErrRefreshTokenReused || err == domain.ErrUserDisabled {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
+
+	oauthToken := &domain.OAuthToken{
+		AccessToken:  authToken.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(expiration.Seconds()),
+		RefreshToken: authToken.RefreshToken,
+		Scope:        strings.Join(authorizationCode.Scopes, " "),
+	}
+
+	if containsString(authorizationCode.Scopes, "openid") {
+		idToken, err := a.idToken(ctx, client, authorizationCode)
+		if err != nil {
+			return nil, err
+		}
+
+		oauthToken.IDToken = idToken
+	}
+
+	return oauthToken, nil
+}
+
+// RefreshOAuthToken rotates the refresh token of a session handed over
+// to a client (RFC 6749 section 6). Only that client may refresh it.
+func (a *authUseCase) RefreshOAuthToken(
+	ctx context.Context,
+	clientID,
+	clientSecret,
+	refreshToken string,
+) (*domain.OAuthToken, error) {
+	client, err := a.authenticateRelyingParty(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken == "" {
+		return nil, domain.ErrOAuthInvalidRequest
+	}
+
+	t, err := a.verifyToken(refreshToken)
+	if err != nil {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	familyID, _ := t.PrivateClaims()["family"].(string)
+
+	family := &domain.TokenFamily{}
+
+	if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+familyID, family); err != nil || family.ClientID != client.ClientID {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	authToken, err := a.rotateRefreshToken(ctx, refreshToken, client.ClientID)
+	if err == domain.ErrInvalidRefreshToken || err == domain.ErrRefreshTokenReused {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := time.Duration(time.Minute * viper.GetDuration(`jwt.token_expiration`))
+
+	return &domain.OAuthToken{
+		AccessToken:  authToken.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(expiration.Seconds()),
+		RefreshToken: authToken.RefreshToken,
+		Scope:        strings.Join(family.Scopes, " "),
+	}, nil
+}
+
+// UserInfo returns the claims of the user of the current access token
+// (OpenID Connect Core section 5.3). The tokens of a client session only
+// get the claims of the scopes granted to it.
+func (a *authUseCase) UserInfo(ctx context.Context) (map[string]interface{}, error) {
+	claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok || claims.SessionID == "" {
+		return nil, domain.ErrOAuthInvalidToken
+	}
+
+	family := &domain.TokenFamily{}
+
+	if err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+claims.SessionID, family); err != nil {
+		return nil, domain.ErrOAuthInvalidToken
+	}
+
+	scopes := oidcScopes
+
+	if family.ClientID != "" {
+		scopes = family.Scopes
+	}
+
+	if !containsString(scopes, "openid") {
+		return nil, domain.ErrOAuthInsufficientScope
+	}
+
+	user, err := a.userRepo.GetByID(ctx, family.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrOAuthInvalidToken
+	}
+
+	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return userClaims(user, role, scopes), nil
+}
+
+// OpenIDConfiguration returns the discovery document of the provider.
+func (a *authUseCase) OpenIDConfiguration() *domain.OpenIDConfiguration {
+	issuer := oidcIssuer()
+
+	algorithms := []string{}
+
+	if active := a.keys.Active(); active != nil {
+		algorithms = append(algorithms, active.Algorithm.String())
+	}
+
+	return &domain.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		ScopesSupported:                   oidcScopes,
+		ClaimsSupported:                   []string{"sub", "name", "role", "email", "email_verified"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// idToken builds the ID token of an authorization (OpenID Connect Core
+// section 2) from the claims of its user.
+func (a *authUseCase) idToken(
+	ctx context.Context,
+	client *domain.Client,
+	authorizationCode *domain.AuthorizationCode,
+) (string, error) {
+	user, err := a.userRepo.GetByID(ctx, authorizationCode.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	if user.ID == 0 {
+		return "", domain.ErrOAuthInvalidGrant
+	}
+
+	role, err := a.roleRepo.GetRoleByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	expiration := viper.GetDuration(`oidc.id_token_expiration`)
+	if expiration <= 0 {
+		expiration = time.Hour
+	}
+
+	now := time.Now()
+
+	t := jwt.New()
+	t.Set(jwt.IssuerKey, oidcIssuer())
+	t.Set(jwt.AudienceKey, client.ClientID)
+	t.Set(jwt.IssuedAtKey, now.Unix())
+	t.Set(jwt.ExpirationKey, now.Add(expiration).Unix())
+	t.Set("auth_time", authorizationCode.AuthTime.Unix())
+	t.Set("azp", client.ClientID)
+	t.Set("sid", authorizationCode.SessionID)
+
+	if authorizationCode.Nonce != "" {
+		t.Set("nonce", authorizationCode.Nonce)
+	}
+
+	for claim, value := range userClaims(user, role, authorizationCode.Scopes) {
+		t.Set(claim, value)
+	}
+
+	return a.signToken(t)
+}
+
+// authenticateRelyingParty authenticates a client of the authorization
+// code flow.
+func (a *authUseCase) authenticateRelyingParty(ctx context.Context, clientID, clientSecret string) (*domain.Client, error) {
+	client, err := a.authenticatePublicClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(client.RedirectURIs) == "" {
+		return nil, domain.ErrOAuthUnauthorizedClient
+	}
+
+	return client, nil
+}
+
+// authenticatePublicClient authenticates a client that may be public.
+// Public clients only identify themselves, PKCE stands in for their
+// secret.
+func (a *authUseCase) authenticatePublicClient(ctx context.Context, clientID, clientSecret string) (*domain.Client, error) {
+	if clientID == "" {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	client, err := a.clientRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if client.ID == 0 || (client.Public && clientSecret != "") {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	if client.Public {
+		return client, nil
+	}
+
+	return a.authenticateClient(ctx, clientID, clientSecret)
+}
+
+// authorizationScopes returns the scopes of an authorization request.
+// Unlike the client_credentials grant, nothing is granted by default.
+func authorizationScopes(client *domain.Client, requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return []string{}, nil
+	}
+
+	return grantScopes(grantableScopes(client)+" "+strings.Join(oidcScopes, " "), requested)
+}
+
+// userClaims returns the standard claims of a user for the given scopes.
+func userClaims(user *domain.User, role *domain.Role, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": strconv.FormatInt(user.ID, 10),
+	}
+
+	if containsString(scopes, "profile") {
+		claims["name"] = user.Name
+
+		if role != nil && role.Name != "" {
+			claims["role"] = role.Name
+		}
+	}
+
+	if containsString(scopes, "email") {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+
+	return claims
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against the S256 code
+// challenge of the authorization request (RFC 7636 section 4.6).
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// validPKCEValue checks the length and alphabet of a code verifier or of
+// a S256 code challenge (RFC 7636 section 4.1).
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+
+	for _, c := range value {
+		if !strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func oidcIssuer() string {
+	return strings.TrimRight(viper.GetString(`oidc.issuer`), "/")
+}
@@ -0,0 +1,214 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/saml"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	samlStatePrefix = "saml_state:"
+
+	transientNameID = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// samlProvider is a configured SAML identity provider with its service
+// provider.
+type samlProvider struct {
+	*domain.SAMLProvider
+	sp *saml.ServiceProvider
+}
+
+// samlState is what is kept of a SAML login between the redirect to the
+// identity provider and the response.
+type samlState struct {
+	Provider  string `json:"provider"`
+	RequestID string `json:"request_id"`
+}
+
+// newSAMLProviders creates the service providers of the configured SAML
+// identity providers, served under the oidc.issuer URL. Misconfigured
+// providers and names already used by another provider are left out.
+func newSAMLProviders(
+	providers []*domain.SAMLProvider,
+	federation map[string]*federationProvider,
+) map[string]*samlProvider {
+	samlProviders := map[string]*samlProvider{}
+
+	for _, provider := range providers {
+		_, taken := federation[provider.Name]
+
+		certificates, err := saml.ParseCertificates(provider.Certificate)
+		if err != nil || taken || provider.Name == "" || provider.Name == directoryProvider {
+			log.Error().Str("provider", provider.Name).Msg("invalid SAML identity provider configuration")
+			continue
+		}
+
+		baseURL := oidcIssuer() + "/saml/" + provider.Name
+
+		sp, err := saml.NewServiceProvider(saml.Config{
+			EntityID:        baseURL + "/metadata",
+			ACSURL:          baseURL + "/acs",
+			IDPEntityID:     provider.EntityID,
+			IDPSSOURL:       provider.SSOURL,
+			IDPCertificates: certificates,
+		})
+		if err != nil {
+			log.Error().Str("provider", provider.Name).Msg("invalid SAML identity provider configuration")
+			continue
+		}
+
+		samlProviders[provider.Name] = &samlProvider{SAMLProvider: provider, sp: sp}
+	}
+
+	return samlProviders
+}
+
+// SAMLMetadata returns the service provider metadata that registers us
+// with a SAML identity provider.
+func (a *authUseCase) SAMLMetadata(ctx context.Context, providerName string) ([]byte, error) {
+	provider, ok := a.saml[providerName]
+	if !ok {
+		return nil, domain.ErrFederationProvider
+	}
+
+	metadata, err := provider.sp.Metadata()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// SAMLLoginURL starts a login with a SAML identity provider. It returns
+// the URL the user is sent to with an authentication request and the
+// relay state of the login, which the response must get back.
+func (a *authUseCase) SAMLLoginURL(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := a.saml[providerName]
+	if !ok {
+		return "", "", domain.ErrFederationProvider
+	}
+
+	relayState, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	authURL, requestID, err := provider.sp.AuthnRequestURL(relayState)
+	if err != nil {
+		log.Error().Stack().Err(err).Str("provider", providerName).Msg(err.Error())
+		return "", "", err
+	}
+
+	expiration := viper.GetDuration(`federation.state_expiration`)
+	if expiration <= 0 {
+		expiration = 10 * time.Minute
+	}
+
+	loginState := &samlState{Provider: providerName, RequestID: requestID}
+
+	if err := a.saveToken(ctx, samlStatePrefix+crypto.HashToken(relayState), loginState, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", "", err
+	}
+
+	return authURL, relayState, nil
+}
+
+// SAMLCallback completes a login with a SAML identity provider from the
+// response posted to the assertion consumer service. The response must
+// answer the request of the login, so it can be used once. The user is
+// then signed in like with FederatedCallback.
+func (a *authUseCase) SAMLCallback(ctx context.Context, providerName, relayState, response string) (string, error) {
+	provider, ok := a.saml[providerName]
+	if !ok {
+		return "", domain.ErrFederationProvider
+	}
+
+	loginState := &samlState{}
+	key := samlStatePrefix + crypto.HashToken(relayState)
+
+	if relayState == "" || a.cacheRepo.GetDelete(ctx, key, loginState) != nil {
+		return "", domain.ErrInvalidFederationState
+	}
+
+	if loginState.Provider != providerName {
+		return "", domain.ErrInvalidFederationState
+	}
+
+	assertion, err := provider.sp.ParseResponse(response, loginState.RequestID)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("event", "federated_login_failed").
+			Str("provider", providerName).
+			Str("client_ip", clientIP(ctx)).
+			Msg(err.Error())
+
+		return "", domain.ErrInvalidFederatedLogin
+	}
+
+	return a.completeFederatedLogin(
+		ctx,
+		provider.Name,
+		samlAccount(provider, assertion),
+		provider.RoleMapping,
+		provider.DefaultRole,
+	)
+}
+
+// samlAccount maps the attributes of an assertion to a provider account.
+// The identity provider is only trusted with the emails of its trusted
+// domains. A transient subject changes on every login, the email
+// identifies the account then.
+func samlAccount(provider *samlProvider, assertion *saml.Assertion) *federatedAccount {
+	account := &federatedAccount{
+		Subject: assertion.NameID,
+		Email:   assertion.NameID,
+	}
+
+	if provider.EmailAttribute != "" {
+		account.Email = assertion.Attribute(provider.EmailAttribute)
+	}
+
+	account.EmailVerified = trustedEmail(account.Email, provider.TrustedEmailDomains)
+
+	if provider.NameAttribute != "" {
+		account.Name = assertion.Attribute(provider.NameAttribute)
+	}
+
+	if provider.GroupsAttribute != "" {
+		account.Groups = assertion.Attributes[provider.GroupsAttribute]
+	}
+
+	if assertion.NameIDFormat == transientNameID {
+		account.Subject = account.Email
+	}
+
+	return account
+}
+
+// trustedEmail tells whether the domain of an email is one of the
+// trusted domains.
+func trustedEmail(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return false
+	}
+
+	for _, trusted := range domains {
+		if strings.EqualFold(email[at+1:], trusted) {
+			return true
+		}
+	}
+
+	return false
+}
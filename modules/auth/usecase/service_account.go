@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const serviceAccountUserPrefix = "service_account_user:"
+
+// serviceAccountToken issues an access token to a service account for
+// one of its credentials. The token acts with the permissions of the
+// service account's role, which are cached like the ones of a user
+// session. Service accounts have no scopes.
+func (a *authUseCase) serviceAccountToken(
+	ctx context.Context,
+	clientID,
+	clientSecret,
+	scope string,
+) (*domain.OAuthToken, error) {
+	credential, err := a.serviceAccountRepo.GetCredentialByClientID(ctx, clientID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if credential.ID == 0 ||
+		clientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(crypto.HashToken(clientSecret)), []byte(credential.Secret)) != 1 {
+		log.Warn().
+			Str("event", "client_authentication_failed").
+			Str("client_id", clientID).
+			Str("client_ip", clientIP(ctx)).
+			Msg(domain.ErrOAuthInvalidClient.Error())
+
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	if scope != "" {
+		return nil, domain.ErrOAuthInvalidScope
+	}
+
+	serviceAccount, err := a.serviceAccountRepo.GetByID(ctx, credential.ServiceAccountID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if serviceAccount.ID == 0 {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+
+	role, err := a.roleRepo.GetByID(ctx, serviceAccount.RoleID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	expiration := viper.GetDuration(`oauth.token_expiration`)
+	if expiration <= 0 {
+		expiration = time.Hour
+	}
+
+	t, err := a.newToken(
+		"user",
+		map[string]interface{}{
+			"service_account_id": serviceAccount.ID,
+			"name":               serviceAccount.Name,
+			"role":               role.Name,
+		},
+		time.Now().Add(expiration),
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	t.Set("svc", serviceAccount.ID)
+
+	token, err := a.signToken(t)
+	if err != nil {
+		return nil, err
+	}
+
+	userCache := &domain.UserCache{Role: role.Name}
+
+	permissions, err := a.permissionRepo.GetPermissionsByRoleName(ctx, role.Name)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	for _, permission := range permissions {
+		userCache.Permissions = append(userCache.Permissions, permission.Name)
+	}
+
+	if err := a.saveToken(ctx, serviceAccountUserKey(serviceAccount.ID), userCache, expiration); err != nil {
+		return nil, err
+	}
+
+	if err := a.serviceAccountRepo.TouchCredential(ctx, credential.ID, time.Now()); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
+
+	log.Info().
+		Str("event", "service_account_token_issued").
+		Int64("service_account_id", serviceAccount.ID).
+		Str("client_id", clientID).
+		Msg("access token issued to a service account")
+
+	return &domain.OAuthToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiration.Seconds()),
+	}, nil
+}
+
+// RevokeServiceAccountTokens revokes every access token of a service
+// account.
+func (a *authUseCase) RevokeServiceAccountTokens(ctx context.Context, serviceAccountID int64) error {
+	if err := a.cacheRepo.Delete(ctx, serviceAccountUserKey(serviceAccountID)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func serviceAccountUserKey(serviceAccountID int64) string {
+	return serviceAccountUserPrefix + strconv.FormatInt(serviceAccountID, 10)
+}
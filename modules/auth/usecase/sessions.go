@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sessionUserPrefix     = "session_user:"
+	sessionActivityPrefix = "session_activity:"
+)
+
+// FetchSessions lists the signed in devices of a user, the most recently
+// active first.
+func (a *authUseCase) FetchSessions(ctx context.Context, userID int64) ([]*domain.Session, error) {
+	familyIDs, err := a.userFamilies(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	current := ""
+
+	if claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims); ok {
+		current = claims.SessionID
+	}
+
+	sessions := []*domain.Session{}
+
+	for _, familyID := range familyIDs {
+		family := &domain.TokenFamily{}
+
+		err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+familyID, family)
+		if err == domain.ErrCacheKeyNil {
+			continue
+		}
+
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		session := &domain.Session{
+			ID:         family.ID,
+			UserAgent:  family.UserAgent,
+			IP:         family.IP,
+			CreatedAt:  family.CreatedAt,
+			LastSeenAt: family.CreatedAt,
+			ExpiresAt:  family.ExpiresAt,
+			Current:    family.ID == current,
+		}
+
+		activity := &domain.SessionActivity{}
+
+		err = a.cacheRepo.Get(ctx, sessionActivityPrefix+familyID, activity)
+		if err != nil && err != domain.ErrCacheKeyNil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if err == nil {
+			session.LastSeenAt = activity.SeenAt
+			session.IP = activity.IP
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession signs a device out: its refresh token family and the
+// access tokens issued from it stop working. API keys cannot revoke
+// sessions.
+func (a *authUseCase) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	if _, err := domain.SelfServiceClaims(ctx); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	family := &domain.TokenFamily{}
+
+	err := a.cacheRepo.Get(ctx, tokenFamilyPrefix+sessionID, family)
+	if err == domain.ErrCacheKeyNil || (err == nil && family.UserID != userID) {
+		return domain.ErrNotFound
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := a.cacheRepo.Delete(ctx, sessionKeys(sessionID)...); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "session_revoked").
+		Int64("user_id", userID).
+		Str("session_id", sessionID).
+		Msg("session revoked")
+
+	return nil
+}
+
+// RevokeSessions signs every device of a user out. API keys cannot revoke
+// sessions.
+func (a *authUseCase) RevokeSessions(ctx context.Context, userID int64) error {
+	if _, err := domain.SelfServiceClaims(ctx); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := a.revokeFamilies(ctx, userID, ""); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "sessions_revoked").
+		Int64("user_id", userID).
+		Msg("every session revoked")
+
+	return nil
+}
+
+// RevokeUserAccess signs every device of a user out and drops the cached
+// role of its API keys, so disabling the account or changing its role
+// applies right away.
+func (a *authUseCase) RevokeUserAccess(ctx context.Context, userID int64) error {
+	if err := a.revokeFamilies(ctx, userID, ""); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	apiKeys, err := a.apiKeyRepo.Fetch(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	keys := []string{}
+
+	for _, apiKey := range apiKeys {
+		keys = append(keys, apiKeyUserKey(apiKey.ID))
+	}
+
+	if err := a.cacheRepo.Delete(ctx, keys...); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "user_access_revoked").
+		Int64("user_id", userID).
+		Msg("every session and cached permission revoked")
+
+	return nil
+}
+
+// touchSession records the last activity of a session. A failure is only
+// logged, it must not fail the request.
+func (a *authUseCase) touchSession(ctx context.Context, family *domain.TokenFamily) {
+	expiration := time.Until(family.ExpiresAt)
+	if expiration <= 0 {
+		return
+	}
+
+	activity := &domain.SessionActivity{SeenAt: time.Now(), IP: clientIP(ctx)}
+
+	if activity.IP == "" {
+		activity.IP = family.IP
+	}
+
+	if err := a.saveToken(ctx, sessionActivityPrefix+family.ID, activity, expiration); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
+}
+
+// sessionKeys returns every cache key of a session.
+func sessionKeys(sessionID string) []string {
+	return []string{
+		tokenFamilyPrefix + sessionID,
+		sessionUserKey(sessionID),
+		sessionActivityPrefix + sessionID,
+	}
+}
+
+func sessionUserKey(sessionID string) string {
+	return sessionUserPrefix + sessionID
+}
+
+func userAgent(ctx context.Context) string {
+	agent, _ := ctx.Value(domain.ContextKeyUserAgent).(string)
+
+	return agent
+}
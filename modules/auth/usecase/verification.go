@@ -0,0 +1,159 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// emailVerificationClaim holds the user and the email a verification
+// token was issued for. Access and refresh tokens never carry it, so
+// they can not be used as verification tokens and the other way round.
+const emailVerificationClaim = "email_verification"
+
+// SendEmailVerification emails a verification link to the given user.
+// Nothing is sent if the email is already verified.
+func (a *authUseCase) SendEmailVerification(ctx context.Context, userID int64) error {
+	user, err := a.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 {
+		return domain.ErrNotFound
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	mail, err := a.emailVerificationMail(user)
+	if err != nil {
+		return err
+	}
+
+	if err := a.mailer.Send(ctx, mail); err != nil {
+		log.Error().Stack().Err(err).Int64("user_id", user.ID).Msg(err.Error())
+		return domain.ErrSendMail
+	}
+
+	return nil
+}
+
+// RequestEmailVerification sends the verification link again. Like
+// RequestPasswordReset, it answers the same way for every address.
+func (a *authUseCase) RequestEmailVerification(ctx context.Context, email string) error {
+	user, err := a.authRepo.Authenticate(ctx, email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	mail, err := a.emailVerificationMail(user)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := a.mailer.Send(context.Background(), mail); err != nil {
+			log.Error().Stack().Err(err).Int64("user_id", user.ID).Msg(err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// VerifyEmail marks the email of the token's user as verified. A token
+// issued before the email was changed is refused.
+func (a *authUseCase) VerifyEmail(ctx context.Context, token string) error {
+	t, err := a.verifyToken(token)
+	if err != nil {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	claim, ok := t.PrivateClaims()[emailVerificationClaim].(map[string]interface{})
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrInvalidVerificationToken.Error())
+		return domain.ErrInvalidVerificationToken
+	}
+
+	userID, _ := claim["user_id"].(float64)
+	email, _ := claim["email"].(string)
+
+	user, err := a.userRepo.GetByID(ctx, int64(userID))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID == 0 || email == "" || user.Email != email {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err := a.authRepo.VerifyEmail(ctx, user.ID, email); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	log.Info().
+		Str("event", "email_verified").
+		Int64("user_id", user.ID).
+		Str("email", email).
+		Msg("email address verified")
+
+	return nil
+}
+
+// emailVerificationMail builds the mail holding a signed verification
+// token for the current email of the user.
+func (a *authUseCase) emailVerificationMail(user *domain.User) (*domain.Mail, error) {
+	expiration := viper.GetDuration(`email_verification.expiration`)
+	if expiration <= 0 {
+		expiration = 24 * time.Hour
+	}
+
+	t, err := a.newToken(
+		emailVerificationClaim,
+		map[string]interface{}{"user_id": user.ID, "email": user.Email},
+		time.Now().Add(expiration),
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	token, err := a.signToken(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to verify your email address. It expires in %s.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+			user.Name,
+			expiration,
+			linkWithToken(viper.GetString(`email_verification.url`), token),
+		),
+	}, nil
+}
+
+// emailVerificationRequired reports whether unverified users must be
+// refused at login.
+func emailVerificationRequired(user *domain.User) bool {
+	return viper.GetBool(`email_verification.required`) && user.EmailVerifiedAt == nil
+}
@@ -0,0 +1,185 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreClientRepository will create an object that represent
+// the client.Repository interface.
+func NewPostgreClientRepository(Conn *sqlx.DB) domain.ClientRepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) Fetch(ctx context.Context) ([]*domain.Client, error) {
+	query := "SELECT * FROM clients ORDER BY id"
+
+	clients := []*domain.Client{}
+
+	err := p.Conn.SelectContext(ctx, &clients, query)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return clients, nil
+}
+
+func (p *postgreRepository) GetByID(ctx context.Context, id int64) (*domain.Client, error) {
+	var client domain.Client
+
+	query := "SELECT * FROM clients WHERE id = $1"
+
+	err := p.Conn.GetContext(ctx, &client, query, id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &client, nil
+}
+
+func (p *postgreRepository) GetByClientID(ctx context.Context, clientID string) (*domain.Client, error) {
+	var client domain.Client
+
+	query := "SELECT * FROM clients WHERE client_id = $1"
+
+	err := p.Conn.GetContext(ctx, &client, query, clientID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &client, nil
+}
+
+func (p *postgreRepository) Store(ctx context.Context, client *domain.Client) (*domain.Client, error) {
+	query := `
+		INSERT INTO clients (
+			client_id,
+			name,
+			secret,
+			scopes,
+			redirect_uris,
+			public,
+			role_id,
+			created_at,
+			updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+
+	err := p.Conn.GetContext(
+		ctx,
+		&client.ID,
+		query,
+		client.ClientID,
+		client.Name,
+		client.Secret,
+		client.Scopes,
+		client.RedirectURIs,
+		client.Public,
+		client.RoleID,
+		client.CreatedAt,
+		client.UpdatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	return client, nil
+}
+
+func (p *postgreRepository) Update(ctx context.Context, client *domain.Client) (*domain.Client, error) {
+	query := `
+		UPDATE clients
+		SET
+		name = $1,
+		scopes = $2,
+		redirect_uris = $3,
+		role_id = $4,
+		updated_at = $5
+		WHERE id = $6
+	`
+
+	result, err := p.Conn.ExecContext(
+		ctx,
+		query,
+		client.Name,
+		client.Scopes,
+		client.RedirectURIs,
+		client.RoleID,
+		client.UpdatedAt,
+		client.ID,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return p.GetByID(ctx, client.ID)
+}
+
+func (p *postgreRepository) UpdateSecret(ctx context.Context, id int64, secret string) error {
+	query := "UPDATE clients SET secret = $1, updated_at = NOW() WHERE id = $2"
+
+	result, err := p.Conn.ExecContext(ctx, query, secret, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM clients WHERE id = $1"
+
+	result, err := p.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+type clientUseCase struct {
+	authUseCase domain.AuthUsecase
+	clientRepo  domain.ClientRepository
+	roleRepo    domain.RoleRepository
+}
+
+// NewClientUsecase will create new a clientUsecase object representation
+// of domain.ClientUsecase interface.
+func NewClientUsecase(
+	auth domain.AuthUsecase,
+	client domain.ClientRepository,
+	role domain.RoleRepository,
+) domain.ClientUsecase {
+	return &clientUseCase{
+		authUseCase: auth,
+		clientRepo:  client,
+		roleRepo:    role,
+	}
+}
+
+func (c *clientUseCase) Fetch(ctx context.Context) ([]*domain.Client, error) {
+	clients, err := c.clientRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (c *clientUseCase) GetByID(ctx context.Context, id int64) (*domain.Client, error) {
+	client, err := c.clientRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Store creates a client with a random client ID and secret. Only the
+// hash of the secret is kept, so it is returned this one time. Public
+// clients get no secret.
+func (c *clientUseCase) Store(ctx context.Context, client *domain.Client) (*domain.ClientSecret, error) {
+	if err := c.checkClient(ctx, client); err != nil {
+		return nil, err
+	}
+
+	clientID, err := newClientID()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	secret := ""
+
+	if !client.Public {
+		secret, err = crypto.RandomToken(32)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		client.Secret = crypto.HashToken(secret)
+	}
+
+	client.ClientID = clientID
+	client.CreatedAt = time.Now()
+	client.UpdatedAt = time.Now()
+
+	newClient, err := c.clientRepo.Store(ctx, client)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return &domain.ClientSecret{Client: newClient, ClientSecret: secret}, nil
+}
+
+// Update changes the name, scopes, redirect URIs and role of a client,
+// whether it is public is fixed on creation. Its current tokens are
+// revoked so the new role and scopes apply right away.
+func (c *clientUseCase) Update(ctx context.Context, client *domain.Client) (*domain.Client, error) {
+	if err := c.checkClient(ctx, client); err != nil {
+		return nil, err
+	}
+
+	client.UpdatedAt = time.Now()
+
+	updatedClient, err := c.clientRepo.Update(ctx, client)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := c.authUseCase.RevokeClientTokens(ctx, updatedClient.ClientID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return updatedClient, nil
+}
+
+func (c *clientUseCase) Delete(ctx context.Context, id int64) error {
+	client, err := c.getClient(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.clientRepo.Delete(ctx, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := c.authUseCase.RevokeClientTokens(ctx, client.ClientID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RegenerateSecret replaces the secret of a client and revokes the
+// tokens issued with the previous one.
+func (c *clientUseCase) RegenerateSecret(ctx context.Context, id int64) (*domain.ClientSecret, error) {
+	client, err := c.getClient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		return nil, domain.ErrPublicClient
+	}
+
+	secret, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := c.clientRepo.UpdateSecret(ctx, id, crypto.HashToken(secret)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := c.authUseCase.RevokeClientTokens(ctx, client.ClientID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return &domain.ClientSecret{Client: client, ClientSecret: secret}, nil
+}
+
+func (c *clientUseCase) getClient(ctx context.Context, id int64) (*domain.Client, error) {
+	client, err := c.clientRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if client.ID == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return client, nil
+}
+
+// checkClient normalizes the lists of a client and checks its role and
+// redirect URIs.
+func (c *clientUseCase) checkClient(ctx context.Context, client *domain.Client) error {
+	role, err := c.roleRepo.GetByID(ctx, client.RoleID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if role.ID == 0 {
+		return domain.ErrNotFound
+	}
+
+	client.Scopes = strings.Join(strings.Fields(client.Scopes), " ")
+	client.RedirectURIs = strings.Join(strings.Fields(client.RedirectURIs), " ")
+
+	for _, redirectURI := range strings.Fields(client.RedirectURIs) {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return domain.ErrInvalidRedirectURI
+		}
+	}
+
+	return nil
+}
+
+// newClientID returns a random client ID. IDs with the prefix of the
+// service account credentials are skipped, they would never reach the
+// client.
+func newClientID() (string, error) {
+	for {
+		clientID, err := crypto.RandomToken(16)
+		if err != nil {
+			return "", err
+		}
+
+		if !strings.HasPrefix(clientID, domain.ServiceAccountClientPrefix) {
+			return clientID, nil
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreFederatedIdentityRepository will create an object that
+// represent the federation.Repository interface.
+func NewPostgreFederatedIdentityRepository(Conn *sqlx.DB) domain.FederatedIdentityRepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) GetBySubject(
+	ctx context.Context,
+	provider,
+	subject string,
+) (*domain.FederatedIdentity, error) {
+	var identity domain.FederatedIdentity
+
+	query := "SELECT * FROM federated_identities WHERE provider = $1 AND subject = $2"
+
+	err := p.Conn.GetContext(ctx, &identity, query, provider, subject)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &identity, nil
+}
+
+func (p *postgreRepository) GetByUserID(
+	ctx context.Context,
+	provider string,
+	userID int64,
+) (*domain.FederatedIdentity, error) {
+	var identity domain.FederatedIdentity
+
+	query := "SELECT * FROM federated_identities WHERE provider = $1 AND user_id = $2 LIMIT 1"
+
+	err := p.Conn.GetContext(ctx, &identity, query, provider, userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &identity, nil
+}
+
+func (p *postgreRepository) Store(
+	ctx context.Context,
+	identity *domain.FederatedIdentity,
+) (*domain.FederatedIdentity, error) {
+	query := `
+		INSERT INTO federated_identities (
+			user_id,
+			provider,
+			subject,
+			email,
+			last_login_at,
+			created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err := p.Conn.GetContext(
+		ctx,
+		&identity.ID,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		identity.LastLoginAt,
+		identity.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	return identity, nil
+}
+
+func (p *postgreRepository) Touch(ctx context.Context, id int64, email string, loginAt time.Time) error {
+	query := "UPDATE federated_identities SET email = $1, last_login_at = $2 WHERE id = $3"
+
+	if _, err := p.Conn.ExecContext(ctx, query, email, loginAt, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
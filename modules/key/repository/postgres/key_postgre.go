@@ -0,0 +1,154 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreKeyRepository will create an object that represent
+// the key.Repository interface.
+func NewPostgreKeyRepository(Conn *sqlx.DB) domain.KeyRepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) Fetch(ctx context.Context) ([]*domain.SigningKey, error) {
+	query := `
+		SELECT * FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	keys := []*domain.SigningKey{}
+
+	err := p.Conn.SelectContext(ctx, &keys, query)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return keys, nil
+}
+
+func (p *postgreRepository) Store(ctx context.Context, key *domain.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (
+			id,
+			algorithm,
+			private_key,
+			created_at,
+			activates_at
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	_, err := p.Conn.ExecContext(
+		ctx,
+		query,
+		key.ID,
+		key.Algorithm,
+		key.PrivateKey,
+		key.CreatedAt,
+		key.ActivatesAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrStoreError
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Rotate(ctx context.Context, key *domain.SigningKey, expiresAt time.Time) error {
+	tx, err := p.Conn.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrRotateKey
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE signing_keys
+		SET
+		retired_at = $1,
+		expires_at = $2
+		WHERE retired_at IS NULL
+	`
+
+	// The current key retires when the new one activates.
+	_, err = tx.ExecContext(ctx, query, key.ActivatesAt, expiresAt)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrRotateKey
+	}
+
+	query = `
+		INSERT INTO signing_keys (
+			id,
+			algorithm,
+			private_key,
+			created_at,
+			activates_at
+		)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		key.ID,
+		key.Algorithm,
+		key.PrivateKey,
+		key.CreatedAt,
+		key.ActivatesAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrRotateKey
+	}
+
+	// Another instance rotating at the same time makes the commit fail
+	// with a serialization error, so only one new key wins.
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrRotateKey
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) UpdatePrivateKey(ctx context.Context, id, privateKey string) error {
+	query := "UPDATE signing_keys SET private_key = $1 WHERE id = $2"
+
+	if _, err := p.Conn.ExecContext(ctx, query, privateKey, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) DeleteExpired(ctx context.Context) error {
+	query := "DELETE FROM signing_keys WHERE expires_at <= NOW()"
+
+	if _, err := p.Conn.ExecContext(ctx, query); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+type keyUseCase struct {
+	keyRepo domain.KeyRepository
+	keys    *keyring.Keyring
+}
+
+// NewKeyUsecase will create new a keyUsecase object representation
+// of domain.KeyUsecase interface. The given keyring is kept in sync
+// with the keys stored in the repository.
+func NewKeyUsecase(key domain.KeyRepository, keys *keyring.Keyring) domain.KeyUsecase {
+	return &keyUseCase{
+		keyRepo: key,
+		keys:    keys,
+	}
+}
+
+// Load reads the stored keys into the keyring. On the very first run the
+// key configured in jwt.private_key (or jwt.secret for HS algorithms) is
+// stored as the active key. Asymmetric algorithms without a configured
+// key fail until one is generated with Rotate.
+func (k *keyUseCase) Load(ctx context.Context) error {
+	kek, err := keyEncryptionKey()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	signingKeys, err := k.keyRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if len(signingKeys) == 0 {
+		signingKey, err := k.bootstrap(kek)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		if err := k.keyRepo.Store(ctx, signingKey); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		signingKeys = []*domain.SigningKey{signingKey}
+	}
+
+	var (
+		active   *keyring.Key
+		retiring []*keyring.Key
+	)
+
+	now := time.Now()
+
+	// Keys are ordered from the newest, so the first one past its
+	// activation is the active one. Newer keys are only published yet.
+	for _, signingKey := range signingKeys {
+		key, err := k.parse(ctx, kek, signingKey)
+		if err != nil {
+			log.Error().Stack().Err(err).Str("kid", signingKey.ID).Msg(err.Error())
+			continue
+		}
+
+		if active == nil && !signingKey.ActivatesAt.After(now) {
+			active = key
+			continue
+		}
+
+		retiring = append(retiring, key)
+	}
+
+	if active == nil {
+		return errors.New("no active signing key")
+	}
+
+	k.keys.Set(active, retiring...)
+
+	return nil
+}
+
+// Rotate generates a new key. It is published right away and becomes the
+// active key after the publish delay, so every instance and downstream
+// verifier already knows it when it signs its first token. The previous
+// one keeps verifying tokens until the overlap window is over.
+func (k *keyUseCase) Rotate(ctx context.Context) (*domain.SigningKey, error) {
+	kek, err := keyEncryptionKey()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	signingKeys, err := k.keyRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	key, err := keyring.GenerateKey(algorithm())
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	signingKey, err := newSigningKey(kek, key)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	// The first key has nobody to be published to yet.
+	if len(signingKeys) > 0 {
+		signingKey.ActivatesAt = signingKey.CreatedAt.Add(publishDelay())
+	}
+
+	expiresAt := signingKey.ActivatesAt.Add(overlap())
+
+	if err := k.keyRepo.Rotate(ctx, signingKey, expiresAt); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := k.keyRepo.DeleteExpired(ctx); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := k.Load(ctx); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	log.Info().
+		Str("kid", signingKey.ID).
+		Str("algorithm", signingKey.Algorithm).
+		Time("activates_at", signingKey.ActivatesAt).
+		Time("previous_expires_at", expiresAt).
+		Msg("signing key rotated")
+
+	return signingKey, nil
+}
+
+// RotateIfDue rotates the active key once it is older than
+// jwt.rotation.interval. A zero interval disables scheduled rotation.
+func (k *keyUseCase) RotateIfDue(ctx context.Context) (bool, error) {
+	interval := viper.GetDuration(`jwt.rotation.interval`)
+	if interval <= 0 {
+		return false, nil
+	}
+
+	signingKeys, err := k.keyRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, err
+	}
+
+	// The newest key may still be waiting for its activation, it counts
+	// as rotated already.
+	if len(signingKeys) > 0 && time.Since(signingKeys[0].CreatedAt) < interval {
+		return false, nil
+	}
+
+	if _, err := k.Rotate(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// parse opens the sealed private key of a stored key. Keys stored before
+// they were sealed are sealed on the way.
+func (k *keyUseCase) parse(ctx context.Context, kek []byte, signingKey *domain.SigningKey) (*keyring.Key, error) {
+	if !crypto.IsSealed(signingKey.PrivateKey) {
+		key, err := keyring.ParseKey(signingKey.Algorithm, []byte(signingKey.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+
+		sealed, err := newSigningKey(kek, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.keyRepo.UpdatePrivateKey(ctx, signingKey.ID, sealed.PrivateKey); err != nil {
+			return nil, err
+		}
+
+		log.Info().Str("kid", signingKey.ID).Msg("signing key sealed")
+
+		return key, nil
+	}
+
+	privateKey, err := crypto.Open(kek, signingKey.PrivateKey, []byte(signingKey.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return keyring.ParseKey(signingKey.Algorithm, privateKey)
+}
+
+func (k *keyUseCase) bootstrap(kek []byte) (*domain.SigningKey, error) {
+	var (
+		key *keyring.Key
+		err error
+	)
+
+	alg := algorithm()
+
+	if privateKey := viper.GetString(`jwt.private_key`); privateKey != "" {
+		var data []byte
+
+		data, err = ioutil.ReadFile(privateKey)
+		if err == nil {
+			key, err = keyring.ParseKey(alg, data)
+		}
+	} else if strings.HasPrefix(alg, "HS") {
+		key, err = keyring.ParseKey(alg, []byte(viper.GetString(`jwt.secret`)))
+	} else {
+		// A key generated here would only live in this instance until
+		// it is stored, and every instance starting at the same time
+		// would generate its own.
+		return nil, domain.ErrSigningKeyRequired
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKey(kek, key)
+}
+
+// newSigningKey seals the private key with the key encryption key. The
+// kid is authenticated with it, a sealed key cannot be moved to another
+// row.
+func newSigningKey(kek []byte, key *keyring.Key) (*domain.SigningKey, error) {
+	privateKey, err := key.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := crypto.Seal(kek, privateKey, []byte(key.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	return &domain.SigningKey{
+		ID:          key.ID,
+		Algorithm:   key.Algorithm.String(),
+		PrivateKey:  sealed,
+		CreatedAt:   now,
+		ActivatesAt: now,
+	}, nil
+}
+
+// keyEncryptionKey returns the key sealing the stored private keys, set
+// in jwt.key_encryption_key or the JWT_KEY_ENCRYPTION_KEY environment
+// variable.
+func keyEncryptionKey() ([]byte, error) {
+	kek, err := base64.StdEncoding.DecodeString(viper.GetString(`jwt.key_encryption_key`))
+	if err != nil || len(kek) != 32 {
+		return nil, domain.ErrKeyEncryptionKey
+	}
+
+	return kek, nil
+}
+
+func algorithm() string {
+	if alg := viper.GetString(`jwt.algorithm`); alg != "" {
+		return alg
+	}
+
+	return "HS256"
+}
+
+// publishDelay is how long a new key is published before it signs. It
+// defaults to the max-age of the JWKS response plus the reload interval
+// of the instances.
+func publishDelay() time.Duration {
+	if delay := viper.GetDuration(`jwt.rotation.publish_delay`); delay > 0 {
+		return delay
+	}
+
+	checkInterval := viper.GetDuration(`jwt.rotation.check_interval`)
+	if checkInterval <= 0 {
+		checkInterval = time.Minute
+	}
+
+	return 5*time.Minute + checkInterval
+}
+
+// overlap is how long a retired key keeps verifying tokens. It defaults to
+// the lifetime of a refresh token, so nobody is logged out by a rotation.
+func overlap() time.Duration {
+	if overlap := viper.GetDuration(`jwt.rotation.overlap`); overlap > 0 {
+		return overlap
+	}
+
+	return time.Duration(viper.GetInt(`jwt.refresh_token_expiration`))*24*time.Hour +
+		time.Minute*viper.GetDuration(`jwt.token_expiration`)
+}
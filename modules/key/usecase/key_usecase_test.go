@@ -0,0 +1,162 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/modules/key/usecase"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/keyring"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKeyRepository struct {
+	keys map[string]*domain.SigningKey
+}
+
+func (r *testKeyRepository) Fetch(ctx context.Context) ([]*domain.SigningKey, error) {
+	keys := []*domain.SigningKey{}
+
+	for _, key := range r.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (r *testKeyRepository) Store(ctx context.Context, key *domain.SigningKey) error {
+	r.keys[key.ID] = key
+
+	return nil
+}
+
+func (r *testKeyRepository) Rotate(ctx context.Context, key *domain.SigningKey, expiresAt time.Time) error {
+	for _, current := range r.keys {
+		if current.RetiredAt == nil {
+			retiredAt := key.ActivatesAt
+			current.RetiredAt = &retiredAt
+			current.ExpiresAt = &expiresAt
+		}
+	}
+
+	r.keys[key.ID] = key
+
+	return nil
+}
+
+func (r *testKeyRepository) UpdatePrivateKey(ctx context.Context, id, privateKey string) error {
+	r.keys[id].PrivateKey = privateKey
+
+	return nil
+}
+
+func (r *testKeyRepository) DeleteExpired(ctx context.Context) error {
+	return nil
+}
+
+func setTestKeyConfig() []byte {
+	kek := bytes.Repeat([]byte{7}, 32)
+
+	viper.Set(`jwt.algorithm`, "ES256")
+	viper.Set(`jwt.private_key`, "")
+	viper.Set(`jwt.key_encryption_key`, base64.StdEncoding.EncodeToString(kek))
+
+	return kek
+}
+
+func TestLoadRequiresAKey(t *testing.T) {
+	setTestKeyConfig()
+
+	keys := keyring.New(nil)
+	keyUseCase := usecase.NewKeyUsecase(&testKeyRepository{keys: map[string]*domain.SigningKey{}}, keys)
+
+	assert.Equal(t, domain.ErrSigningKeyRequired, keyUseCase.Load(context.Background()))
+
+	viper.Set(`jwt.key_encryption_key`, "")
+	assert.Equal(t, domain.ErrKeyEncryptionKey, keyUseCase.Load(context.Background()))
+}
+
+func TestRotatePublishesBeforeActivating(t *testing.T) {
+	kek := setTestKeyConfig()
+	ctx := context.Background()
+
+	repo := &testKeyRepository{keys: map[string]*domain.SigningKey{}}
+	keys := keyring.New(nil)
+	keyUseCase := usecase.NewKeyUsecase(repo, keys)
+
+	// The first key has nobody to wait for.
+	first, err := keyUseCase.Rotate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, keys.Active().ID)
+
+	// Private keys are stored sealed and bound to their kid.
+	assert.True(t, crypto.IsSealed(repo.keys[first.ID].PrivateKey))
+
+	_, err = crypto.Open(kek, repo.keys[first.ID].PrivateKey, []byte(first.ID))
+	assert.NoError(t, err)
+
+	second, err := keyUseCase.Rotate(ctx)
+	require.NoError(t, err)
+	assert.True(t, second.ActivatesAt.After(time.Now().Add(5*time.Minute)))
+
+	// The new key is published but the previous one still signs.
+	assert.Equal(t, first.ID, keys.Active().ID)
+
+	set, err := keys.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	repo.keys[second.ID].ActivatesAt = time.Now().Add(-time.Second)
+
+	require.NoError(t, keyUseCase.Load(ctx))
+	assert.Equal(t, second.ID, keys.Active().ID)
+
+	// A rotation right after does not count as due.
+	viper.Set(`jwt.rotation.interval`, "720h")
+
+	rotated, err := keyUseCase.RotateIfDue(ctx)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+}
+
+func TestLoadSealsPlaintextKeys(t *testing.T) {
+	kek := setTestKeyConfig()
+	ctx := context.Background()
+
+	key, err := keyring.GenerateKey("ES256")
+	require.NoError(t, err)
+
+	privateKey, err := key.MarshalPEM()
+	require.NoError(t, err)
+
+	repo := &testKeyRepository{keys: map[string]*domain.SigningKey{
+		key.ID: {
+			ID:          key.ID,
+			Algorithm:   "ES256",
+			PrivateKey:  string(privateKey),
+			CreatedAt:   time.Now(),
+			ActivatesAt: time.Now(),
+		},
+	}}
+
+	keys := keyring.New(nil)
+
+	require.NoError(t, usecase.NewKeyUsecase(repo, keys).Load(ctx))
+	assert.Equal(t, key.ID, keys.Active().ID)
+
+	opened, err := crypto.Open(kek, repo.keys[key.ID].PrivateKey, []byte(key.ID))
+	require.NoError(t, err)
+	assert.Equal(t, privateKey, opened)
+}
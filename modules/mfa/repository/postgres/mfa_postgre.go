@@ -0,0 +1,256 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreMFARepository will create an object that represent
+// the mfa.Repository interface.
+func NewPostgreMFARepository(Conn *sqlx.DB) domain.MFARepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) GetByUserID(ctx context.Context, userID int64) (*domain.MFA, error) {
+	var mfa domain.MFA
+
+	query := "SELECT * FROM user_mfa WHERE user_id = $1"
+
+	err := p.Conn.GetContext(ctx, &mfa, query, userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &mfa, nil
+}
+
+// Store saves a pending enrollment. A confirmed one is never replaced.
+func (p *postgreRepository) Store(ctx context.Context, mfa *domain.MFA) error {
+	query := `
+		INSERT INTO user_mfa (
+			user_id,
+			secret,
+			created_at
+		)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET
+		secret = EXCLUDED.secret,
+		last_used_step = 0,
+		created_at = EXCLUDED.created_at
+		WHERE user_mfa.confirmed_at IS NULL
+	`
+
+	result, err := p.Conn.ExecContext(ctx, query, mfa.UserID, mfa.Secret, mfa.CreatedAt)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrStoreError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrStoreError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Confirm(ctx context.Context, userID int64, recoveryCodes []string) error {
+	tx, err := p.Conn.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE user_mfa
+		SET
+		confirmed_at = $1
+		WHERE user_id = $2 AND confirmed_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		err = domain.ErrMFANotEnrolled
+		return err
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Delete(ctx context.Context, userID int64) error {
+	tx, err := p.Conn.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = $1", userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	return nil
+}
+
+// UseStep records the TOTP time step of an accepted code. It returns
+// false if the step (or a later one) was already used, so a code can
+// not be replayed.
+func (p *postgreRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `
+		UPDATE user_mfa
+		SET
+		last_used_step = $1
+		WHERE user_id = $2 AND last_used_step < $1
+	`
+
+	result, err := p.Conn.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, domain.ErrUpdateError
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (p *postgreRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodes []string) error {
+	tx, err := p.Conn.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the given (hashed) recovery code as used. It
+// returns false if the code does not exist or was already used.
+func (p *postgreRepository) UseRecoveryCode(ctx context.Context, userID int64, recoveryCode string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET
+		used_at = $1
+		WHERE user_id = $2 AND code = $3 AND used_at IS NULL
+	`
+
+	result, err := p.Conn.ExecContext(ctx, query, time.Now(), userID, recoveryCode)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, domain.ErrUpdateError
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int64, recoveryCodes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO mfa_recovery_codes (
+			user_id,
+			code,
+			created_at
+		)
+		VALUES ($1, $2, $3)
+	`
+
+	now := time.Now()
+
+	for _, recoveryCode := range recoveryCodes {
+		if _, err := tx.ExecContext(ctx, query, userID, recoveryCode, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/totp"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	// recoveryCodes is how many recovery codes a user gets.
+	recoveryCodes = 10
+	// totpSkew is how many time steps before and after the current one
+	// are accepted, to allow for clock drift.
+	totpSkew = 1
+
+	mfaUserAttemptsPrefix = "mfa_user_attempts:"
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type mfaUseCase struct {
+	mfaRepo      domain.MFARepository
+	userRepo     domain.UserRepository
+	cacheRepo    domain.CacheRepository
+	loginLimiter domain.LoginLimiter
+}
+
+// NewMFAUsecase will create new a mfaUsecase object representation
+// of domain.MFAUsecase interface.
+func NewMFAUsecase(
+	mfa domain.MFARepository,
+	user domain.UserRepository,
+	cache domain.CacheRepository,
+	loginLimiter domain.LoginLimiter,
+) domain.MFAUsecase {
+	return &mfaUseCase{
+		mfaRepo:      mfa,
+		userRepo:     user,
+		cacheRepo:    cache,
+		loginLimiter: loginLimiter,
+	}
+}
+
+// Enroll starts a TOTP enrollment for the authenticated user. It is not
+// enforced until it is confirmed with a code from the authenticator app.
+func (m *mfaUseCase) Enroll(ctx context.Context) (*domain.MFAEnrollment, error) {
+	user, err := m.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := m.mfaRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	err = m.mfaRepo.Store(ctx, &domain.MFA{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return &domain.MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(viper.GetString(`mfa.issuer`), user.Email, secret),
+	}, nil
+}
+
+// Confirm enables the pending enrollment and returns the recovery codes.
+// They are only stored hashed, so this is the only time they are shown.
+func (m *mfaUseCase) Confirm(ctx context.Context, code string) ([]string, error) {
+	user, err := m.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := m.mfaRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if mfa.UserID == 0 {
+		return nil, domain.ErrMFANotEnrolled
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	if err := m.checkUserCode(ctx, user, func() error {
+		return m.checkCode(ctx, mfa, code)
+	}); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := m.mfaRepo.Confirm(ctx, user.ID, hashes); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable removes the enrollment of the authenticated user. It takes a
+// TOTP or recovery code, whose guesses are limited, so a stolen session
+// alone can not turn it off.
+func (m *mfaUseCase) Disable(ctx context.Context, code string) error {
+	user, err := m.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := m.checkUserCode(ctx, user, func() error {
+		return m.Verify(ctx, user.ID, code)
+	}); err != nil {
+		return err
+	}
+
+	if err := m.mfaRepo.Delete(ctx, user.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the
+// authenticated user. It takes a TOTP code.
+func (m *mfaUseCase) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	user, err := m.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := m.enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkUserCode(ctx, user, func() error {
+		return m.checkCode(ctx, mfa, code)
+	}); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := m.mfaRepo.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (m *mfaUseCase) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	mfa, err := m.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false, err
+	}
+
+	return mfa.ConfirmedAt != nil, nil
+}
+
+// Verify checks a TOTP code or, failing that, a recovery code, which is
+// used up.
+func (m *mfaUseCase) Verify(ctx context.Context, userID int64, code string) error {
+	mfa, err := m.enabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	code = normalizeCode(code)
+
+	if len(code) == totp.Digits {
+		return m.checkCode(ctx, mfa, code)
+	}
+
+	used, err := m.mfaRepo.UseRecoveryCode(ctx, userID, crypto.HashToken(code))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if !used {
+		return domain.ErrInvalidMFACode
+	}
+
+	log.Info().Int64("user_id", userID).Msg("mfa recovery code used")
+
+	return nil
+}
+
+// checkCode validates a TOTP code and makes sure its time step is not
+// accepted twice.
+func (m *mfaUseCase) checkCode(ctx context.Context, mfa *domain.MFA, code string) error {
+	step, ok := totp.Validate(mfa.Secret, normalizeCode(code), time.Now(), totpSkew)
+	if !ok {
+		return domain.ErrInvalidMFACode
+	}
+
+	fresh, err := m.mfaRepo.UseStep(ctx, mfa.UserID, step)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if !fresh {
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// checkUserCode runs check on a code sent by the authenticated user.
+// Only mfa.max_attempts codes are checked per lockout.window, and wrong
+// codes count toward the login lockout, so a stolen session cannot guess
+// codes. The attempt is counted before the check, concurrent guesses
+// cannot share one.
+func (m *mfaUseCase) checkUserCode(ctx context.Context, user *domain.User, check func() error) error {
+	if err := m.loginLimiter.Check(ctx, user.Email); err != nil {
+		return err
+	}
+
+	maxAttempts := viper.GetInt64(`mfa.max_attempts`)
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	window := viper.GetDuration(`lockout.window`)
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+
+	key := mfaUserAttemptsPrefix + strconv.FormatInt(user.ID, 10)
+
+	attempts, err := m.cacheRepo.Increment(ctx, key, window)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if attempts > maxAttempts {
+		log.Warn().
+			Str("event", "mfa_code_refused").
+			Int64("user_id", user.ID).
+			Msg(domain.ErrTooManyAttempts.Error())
+
+		return domain.ErrTooManyAttempts
+	}
+
+	err = check()
+	if err == domain.ErrInvalidMFACode {
+		if err := m.loginLimiter.RecordFailure(ctx, user.Email); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+		}
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.cacheRepo.Delete(ctx, key); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+	}
+
+	return nil
+}
+
+func (m *mfaUseCase) enabled(ctx context.Context, userID int64) (*domain.MFA, error) {
+	mfa, err := m.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt == nil {
+		return nil, domain.ErrMFANotEnrolled
+	}
+
+	return mfa, nil
+}
+
+func (m *mfaUseCase) currentUser(ctx context.Context) (*domain.User, error) {
+	claims, err := domain.SelfServiceClaims(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	userID, _ := claims.User["user_id"].(float64)
+
+	user, err := m.userRepo.GetByID(ctx, int64(userID))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrUnauthorized
+	}
+
+	return user, nil
+}
+
+// newRecoveryCodes returns the recovery codes formatted for the user
+// and their hashes to be stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodes)
+	hashes := make([]string, 0, recoveryCodes)
+
+	for i := 0; i < recoveryCodes; i++ {
+		random := make([]byte, 10)
+
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+
+		code := recoveryCodeEncoding.EncodeToString(random)[:10]
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, crypto.HashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+
+	return code
+}
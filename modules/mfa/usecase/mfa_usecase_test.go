@@ -0,0 +1,131 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cyruzin/puppet_master/domain"
+	rds "github.com/cyruzin/puppet_master/modules/auth/repository/redis"
+	authUsecase "github.com/cyruzin/puppet_master/modules/auth/usecase"
+	"github.com/cyruzin/puppet_master/modules/mfa/usecase"
+	"github.com/cyruzin/puppet_master/pkg/totp"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMFARepository struct {
+	domain.MFARepository
+	mfa     *domain.MFA
+	deleted bool
+}
+
+func (r *testMFARepository) GetByUserID(ctx context.Context, userID int64) (*domain.MFA, error) {
+	return r.mfa, nil
+}
+
+func (r *testMFARepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	return true, nil
+}
+
+func (r *testMFARepository) UseRecoveryCode(ctx context.Context, userID int64, recoveryCode string) (bool, error) {
+	return false, nil
+}
+
+func (r *testMFARepository) Delete(ctx context.Context, userID int64) error {
+	r.deleted = true
+
+	return nil
+}
+
+type testUserRepository struct {
+	domain.UserRepository
+	user *domain.User
+}
+
+func (r *testUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	return r.user, nil
+}
+
+type testMFA struct {
+	usecase domain.MFAUsecase
+	repo    *testMFARepository
+	ctx     context.Context
+}
+
+func newTestMFA(t *testing.T) *testMFA {
+	server, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	confirmedAt := time.Now()
+	repo := &testMFARepository{mfa: &domain.MFA{UserID: 2, Secret: secret, ConfirmedAt: &confirmedAt}}
+	cache := rds.NewRedisCacheRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	mfa := usecase.NewMFAUsecase(
+		repo,
+		&testUserRepository{user: &domain.User{ID: 2, Email: "homer@simpsons.org"}},
+		cache,
+		authUsecase.NewLoginLimiter(cache),
+	)
+
+	ctx := context.WithValue(context.Background(), domain.ContextKeyClaims, &domain.TokenClaims{
+		SessionID: "family",
+		User:      map[string]interface{}{"user_id": float64(2)},
+	})
+
+	return &testMFA{usecase: mfa, repo: repo, ctx: ctx}
+}
+
+func (m *testMFA) code(t *testing.T) string {
+	code, err := totp.Code(m.repo.mfa.Secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+
+	return code
+}
+
+func setTestConfig(t *testing.T, key string, value interface{}) {
+	previous := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, previous) })
+}
+
+func TestDisableLimitsCodeGuesses(t *testing.T) {
+	setTestConfig(t, `lockout.free_attempts`, 100)
+
+	mfa := newTestMFA(t)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, domain.ErrInvalidMFACode, mfa.usecase.Disable(mfa.ctx, "000000"))
+	}
+
+	// Out of attempts, even the right code is refused.
+	assert.Equal(t, domain.ErrTooManyAttempts, mfa.usecase.Disable(mfa.ctx, mfa.code(t)))
+	assert.False(t, mfa.repo.deleted)
+}
+
+func TestWrongCodesCountTowardLockout(t *testing.T) {
+	mfa := newTestMFA(t)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, domain.ErrInvalidMFACode, mfa.usecase.Disable(mfa.ctx, "000000"))
+	}
+
+	// The failures delay the next attempt like wrong passwords do.
+	assert.Equal(t, domain.ErrTooManyAttempts, mfa.usecase.Disable(mfa.ctx, mfa.code(t)))
+	assert.False(t, mfa.repo.deleted)
+}
+
+func TestDisable(t *testing.T) {
+	mfa := newTestMFA(t)
+
+	assert.Equal(t, domain.ErrInvalidMFACode, mfa.usecase.Disable(mfa.ctx, "000000"))
+	require.NoError(t, mfa.usecase.Disable(mfa.ctx, mfa.code(t)))
+	assert.True(t, mfa.repo.deleted)
+}
@@ -0,0 +1,129 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jackc/pgx"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgrePasskeyRepository will create an object that represent
+// the passkey.Repository interface.
+func NewPostgrePasskeyRepository(Conn *sqlx.DB) domain.PasskeyRepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) Fetch(ctx context.Context, userID int64) ([]*domain.Passkey, error) {
+	query := "SELECT * FROM passkeys WHERE user_id = $1 ORDER BY created_at"
+
+	passkeys := []*domain.Passkey{}
+
+	err := p.Conn.SelectContext(ctx, &passkeys, query, userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return passkeys, nil
+}
+
+func (p *postgreRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.Passkey, error) {
+	var passkey domain.Passkey
+
+	query := "SELECT * FROM passkeys WHERE credential_id = $1"
+
+	err := p.Conn.GetContext(ctx, &passkey, query, credentialID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &passkey, nil
+}
+
+func (p *postgreRepository) Store(ctx context.Context, passkey *domain.Passkey) (*domain.Passkey, error) {
+	query := `
+		INSERT INTO passkeys (
+			user_id,
+			name,
+			credential_id,
+			public_key,
+			sign_count,
+			aaguid,
+			created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	err := p.Conn.GetContext(
+		ctx,
+		&passkey.ID,
+		query,
+		passkey.UserID,
+		passkey.Name,
+		passkey.CredentialID,
+		passkey.PublicKey,
+		passkey.SignCount,
+		passkey.AAGUID,
+		passkey.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
+			return nil, domain.ErrPasskeyExists
+		}
+
+		return nil, domain.ErrStoreError
+	}
+
+	return passkey, nil
+}
+
+func (p *postgreRepository) UpdateSignCount(ctx context.Context, id, signCount int64) error {
+	query := `
+		UPDATE passkeys
+		SET
+		sign_count = $1,
+		last_used_at = $2
+		WHERE id = $3
+	`
+
+	if _, err := p.Conn.ExecContext(ctx, query, signCount, time.Now(), id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) Delete(ctx context.Context, id, userID int64) error {
+	query := "DELETE FROM passkeys WHERE id = $1 AND user_id = $2"
+
+	result, err := p.Conn.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/webauthn"
+	"github.com/rs/zerolog/log"
+)
+
+const passkeyChallengePrefix = "passkey_challenge:"
+
+type passkeyUseCase struct {
+	authRepo    domain.AuthRepository
+	cacheRepo   domain.CacheRepository
+	passkeyRepo domain.PasskeyRepository
+	userRepo    domain.UserRepository
+	webAuthn    *webauthn.WebAuthn
+}
+
+// NewPasskeyUsecase will create new a passkeyUsecase object representation
+// of domain.PasskeyUsecase interface.
+func NewPasskeyUsecase(
+	auth domain.AuthRepository,
+	cache domain.CacheRepository,
+	passkey domain.PasskeyRepository,
+	user domain.UserRepository,
+	webAuthn *webauthn.WebAuthn,
+) domain.PasskeyUsecase {
+	return &passkeyUseCase{
+		authRepo:    auth,
+		cacheRepo:   cache,
+		passkeyRepo: passkey,
+		userRepo:    user,
+		webAuthn:    webAuthn,
+	}
+}
+
+func (p *passkeyUseCase) Fetch(ctx context.Context) ([]*domain.Passkey, error) {
+	user, err := p.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := p.passkeyRepo.Fetch(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// BeginRegistration returns the JSON options for
+// navigator.credentials.create() for the authenticated user.
+func (p *passkeyUseCase) BeginRegistration(ctx context.Context) (string, error) {
+	user, err := p.currentUser(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	passkeys, err := p.passkeyRepo.Fetch(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	exclude := make([][]byte, 0, len(passkeys))
+
+	for _, passkey := range passkeys {
+		exclude = append(exclude, passkey.CredentialID)
+	}
+
+	challenge, err := p.newChallenge(ctx, &domain.PasskeyChallenge{UserID: user.ID, Registration: true})
+	if err != nil {
+		return "", err
+	}
+
+	options := p.webAuthn.CreationOptions(
+		webauthn.User{ID: userHandle(user.ID), Name: user.Email, DisplayName: user.Name},
+		challenge,
+		exclude,
+	)
+
+	return marshalOptions(options)
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create()
+// and stores the new passkey.
+func (p *passkeyUseCase) FinishRegistration(ctx context.Context, name, credential string) (*domain.Passkey, error) {
+	user, err := p.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := webauthn.ParseCredentialCreation([]byte(credential))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	challenge, err := response.Challenge()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	pending, err := p.consumeChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pending.Registration || pending.UserID != user.ID {
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	verified, err := p.webAuthn.VerifyRegistration(response, challenge)
+	if err != nil {
+		log.Error().Stack().Err(err).Int64("user_id", user.ID).Msg(err.Error())
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey, err := p.passkeyRepo.Store(ctx, &domain.Passkey{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    int64(verified.SignCount),
+		AAGUID:       verified.AAGUID,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// BeginLogin returns the JSON options for navigator.credentials.get().
+// Without an email any discoverable passkey of this relying party can
+// be used.
+func (p *passkeyUseCase) BeginLogin(ctx context.Context, email string) (string, error) {
+	pending := &domain.PasskeyChallenge{}
+	allow := [][]byte{}
+
+	if email != "" {
+		user, err := p.authRepo.Authenticate(ctx, email)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return "", err
+		}
+
+		if user.ID != 0 {
+			passkeys, err := p.passkeyRepo.Fetch(ctx, user.ID)
+			if err != nil {
+				log.Error().Stack().Err(err).Msg(err.Error())
+				return "", err
+			}
+
+			for _, passkey := range passkeys {
+				allow = append(allow, passkey.CredentialID)
+			}
+
+			pending.UserID = user.ID
+		}
+	}
+
+	challenge, err := p.newChallenge(ctx, pending)
+	if err != nil {
+		return "", err
+	}
+
+	return marshalOptions(p.webAuthn.RequestOptions(challenge, allow))
+}
+
+// FinishLogin verifies the response of navigator.credentials.get() and
+// returns the ID of the user it belongs to, and whether the authenticator
+// verified that user or only their presence.
+func (p *passkeyUseCase) FinishLogin(ctx context.Context, credential string) (int64, bool, error) {
+	response, err := webauthn.ParseCredentialAssertion([]byte(credential))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	challenge, err := response.Challenge()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	pending, err := p.consumeChallenge(ctx, challenge)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if pending.Registration {
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	passkey, err := p.passkeyRepo.GetByCredentialID(ctx, response.RawID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return 0, false, err
+	}
+
+	if passkey.ID == 0 {
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	if pending.UserID != 0 && pending.UserID != passkey.UserID {
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	if len(response.Response.UserHandle) != 0 &&
+		string(response.Response.UserHandle) != string(userHandle(passkey.UserID)) {
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	signCount, err := p.webAuthn.VerifyAssertion(response, challenge, &webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: uint32(passkey.SignCount),
+	})
+	if err == webauthn.ErrSignCount {
+		log.Warn().
+			Int64("user_id", passkey.UserID).
+			Int64("passkey_id", passkey.ID).
+			Msg("passkey signature counter went backwards, the authenticator may be cloned")
+
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	if err != nil {
+		log.Error().Stack().Err(err).Int64("passkey_id", passkey.ID).Msg(err.Error())
+		return 0, false, domain.ErrInvalidPasskey
+	}
+
+	if err := p.passkeyRepo.UpdateSignCount(ctx, passkey.ID, int64(signCount)); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return 0, false, err
+	}
+
+	return passkey.UserID, response.UserVerified(), nil
+}
+
+func (p *passkeyUseCase) Delete(ctx context.Context, id int64) error {
+	user, err := p.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := p.passkeyRepo.Delete(ctx, id, user.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// newChallenge creates a ceremony challenge, kept until the ceremony
+// times out.
+func (p *passkeyUseCase) newChallenge(ctx context.Context, pending *domain.PasskeyChallenge) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := p.cacheRepo.Set(ctx, challengeKey(challenge), pending, p.webAuthn.Timeout()); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// consumeChallenge returns the pending ceremony of the given challenge.
+// A challenge can only be used once.
+func (p *passkeyUseCase) consumeChallenge(ctx context.Context, challenge []byte) (*domain.PasskeyChallenge, error) {
+	pending := &domain.PasskeyChallenge{}
+
+	if err := p.cacheRepo.GetDelete(ctx, challengeKey(challenge), pending); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	return pending, nil
+}
+
+func (p *passkeyUseCase) currentUser(ctx context.Context) (*domain.User, error) {
+	claims, err := domain.SelfServiceClaims(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	userID, _ := claims.User["user_id"].(float64)
+
+	user, err := p.userRepo.GetByID(ctx, int64(userID))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrUnauthorized
+	}
+
+	return user, nil
+}
+
+func challengeKey(challenge []byte) string {
+	return passkeyChallengePrefix + base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+// userHandle is the WebAuthn user.id of a user. It is returned by
+// discoverable credentials on login.
+func userHandle(userID int64) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+
+	return handle
+}
+
+func marshalOptions(options interface{}) (string, error) {
+	data, err := json.Marshal(options)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -223,7 +223,7 @@ func (p *postgreRepository) GetRoleByUserID(ctx context.Context, userID int64) (
 							r.updated_at
 					 FROM roles r
 					 JOIN role_user ru ON ru.role_id = r.id
-					 JOIN users u ON u.id = ru.role_id
+					 JOIN users u ON u.id = ru.user_id
 					 WHERE u.id = $1
 					 GROUP BY r.id`
 
@@ -349,3 +349,65 @@ func (p *postgreRepository) SyncRoleToUser(ctx context.Context, role int, userID
 
 	return nil
 }
+
+// GetUsersByRoleID returns the users with the given role.
+func (p *postgreRepository) GetUsersByRoleID(ctx context.Context, roleID int64) ([]*domain.User, error) {
+	query := `SELECT u.*
+					 FROM users u
+					 JOIN role_user ru ON ru.user_id = u.id
+					 WHERE ru.role_id = $1
+					 ORDER BY u.id`
+
+	users := []*domain.User{}
+
+	err := p.Conn.SelectContext(ctx, &users, query, roleID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return users, nil
+}
+
+// GetRolesByUserIDs returns the role of each of the given users that has
+// one.
+func (p *postgreRepository) GetRolesByUserIDs(ctx context.Context, userIDs []int64) (map[int64]*domain.Role, error) {
+	roles := map[int64]*domain.Role{}
+
+	if len(userIDs) == 0 {
+		return roles, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT
+							ru.user_id,
+							r.id,
+							r.name,
+							r.description,
+							r.created_at,
+							r.updated_at
+					 FROM roles r
+					 JOIN role_user ru ON ru.role_id = r.id
+					 WHERE ru.user_id IN (?)`, userIDs)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	userRoles := []*struct {
+		UserID int64 `db:"user_id"`
+		domain.Role
+	}{}
+
+	err = p.Conn.SelectContext(ctx, &userRoles, p.Conn.Rebind(query), args...)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	for _, userRole := range userRoles {
+		role := userRole.Role
+		roles[userRole.UserID] = &role
+	}
+
+	return roles, nil
+}
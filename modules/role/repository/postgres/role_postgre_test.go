@@ -1,5 +1,68 @@
 package postgre_test
 
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	postgreRepository "github.com/cyruzin/puppet_master/modules/role/repository/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRoleByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "name", "description", "created_at", "updated_at"}).
+		AddRow(3, "Editor", "This is the editor role", time.Now(), time.Now())
+
+	// The user is joined by the user of the assignment, not its role.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("JOIN users u ON u.id = ru.user_id")).
+		WithArgs(int64(2)).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	roleRepo := postgreRepository.NewPostgreRoleRepository(sqlx.NewDb(db, "sqlmock"), nil)
+
+	role, err := roleRepo.GetRoleByUserID(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Editor", role.Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRolesByUserIDs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"user_id", "id", "name", "description", "created_at", "updated_at"}).
+		AddRow(2, 3, "Editor", "This is the editor role", time.Now(), time.Now()).
+		AddRow(5, 1, "Admin", "This is the admin role", time.Now(), time.Now())
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ru.user_id IN ($1, $2, $3)")).
+		WithArgs(int64(2), int64(4), int64(5)).
+		WillReturnRows(rows)
+
+	// Named like the driver of the config, so the query is rebound to
+	// PostgreSQL placeholders.
+	roleRepo := postgreRepository.NewPostgreRoleRepository(sqlx.NewDb(db, "pgx"), nil)
+
+	roles, err := roleRepo.GetRolesByUserIDs(context.Background(), []int64{2, 4, 5})
+	require.NoError(t, err)
+	assert.Len(t, roles, 2)
+	assert.Equal(t, "Editor", roles[2].Name)
+	assert.Equal(t, "Admin", roles[5].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // import (
 // 	"context"
 // 	"regexp"
@@ -0,0 +1,427 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/enc"
+	"github.com/cyruzin/puppet_master/pkg/scim"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// provisionPermission is needed for every SCIM request.
+const provisionPermission = "provision users"
+
+// SCIMHandler represent the http handler for SCIM provisioning.
+type SCIMHandler struct {
+	AuthUseCase domain.AuthUsecase
+	SCIMUseCase domain.SCIMUsecase
+}
+
+// scimError is the error response of SCIM (RFC 7644 section 3.12).
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// NewSCIMHandler will initialize the SCIM 2.0 provisioning endpoints.
+func NewSCIMHandler(c *chi.Mux, auth domain.AuthUsecase, provisioning domain.SCIMUsecase) {
+	handler := &SCIMHandler{
+		AuthUseCase: auth,
+		SCIMUseCase: provisioning,
+	}
+
+	c.Route("/scim/v2", func(r chi.Router) {
+		r.Use(handler.authorize)
+
+		r.Get("/ServiceProviderConfig", handler.ServiceProviderConfig)
+
+		r.Get("/Users", handler.FetchUsers)
+		r.Post("/Users", handler.StoreUser)
+		r.Get("/Users/{id}", handler.GetUser)
+		r.Put("/Users/{id}", handler.ReplaceUser)
+		r.Patch("/Users/{id}", handler.PatchUser)
+		r.Delete("/Users/{id}", handler.DeleteUser)
+
+		r.Get("/Groups", handler.FetchGroups)
+		r.Post("/Groups", handler.StoreGroup)
+		r.Get("/Groups/{id}", handler.GetGroup)
+		r.Put("/Groups/{id}", handler.ReplaceGroup)
+		r.Patch("/Groups/{id}", handler.PatchGroup)
+		r.Delete("/Groups/{id}", handler.DeleteGroup)
+	})
+}
+
+// authorize lets through the bearer tokens and API keys with the
+// "provision users" permission.
+func (s *SCIMHandler) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(domain.ContextKeyClaims).(*domain.TokenClaims); !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			encodeSCIMError(w, r, domain.ErrUnauthorized)
+			return
+		}
+
+		if !s.AuthUseCase.Authorize(r.Context(), provisionPermission, nil) {
+			encodeSCIMError(w, r, domain.ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServiceProviderConfig describes the supported features, which some
+// providers read before provisioning.
+func (s *SCIMHandler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	maxResults := viper.GetInt(`scim.max_results`)
+	if maxResults <= 0 {
+		maxResults = 100
+	}
+
+	encodeSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scim.ServiceProviderConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxResults},
+		"changePassword": map[string]bool{"supported": true},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "An access token or an API key with the provision users permission",
+			"primary":     true,
+		}},
+	})
+}
+
+func (s *SCIMHandler) FetchUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := scimQuery(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	list, err := s.SCIMUseCase.FetchUsers(r.Context(), query)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, list)
+}
+
+func (s *SCIMHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	user, err := s.SCIMUseCase.GetUser(r.Context(), id)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, user)
+}
+
+func (s *SCIMHandler) StoreUser(w http.ResponseWriter, r *http.Request) {
+	user := &domain.SCIMUser{}
+
+	if err := json.NewDecoder(r.Body).Decode(user); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	user, err := s.SCIMUseCase.StoreUser(r.Context(), user)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", user.Meta.Location)
+
+	encodeSCIM(w, http.StatusCreated, user)
+}
+
+func (s *SCIMHandler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	user := &domain.SCIMUser{}
+
+	if err := json.NewDecoder(r.Body).Decode(user); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	user, err = s.SCIMUseCase.ReplaceUser(r.Context(), id, user)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, user)
+}
+
+func (s *SCIMHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	patch := &domain.SCIMPatch{}
+
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	user, err := s.SCIMUseCase.PatchUser(r.Context(), id, patch)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, user)
+}
+
+// DeleteUser deprovisions a user, the account is disabled.
+func (s *SCIMHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	if err := s.SCIMUseCase.DeleteUser(r.Context(), id); err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *SCIMHandler) FetchGroups(w http.ResponseWriter, r *http.Request) {
+	query, err := scimQuery(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	list, err := s.SCIMUseCase.FetchGroups(r.Context(), query)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, list)
+}
+
+func (s *SCIMHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	group, err := s.SCIMUseCase.GetGroup(r.Context(), id)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, group)
+}
+
+func (s *SCIMHandler) StoreGroup(w http.ResponseWriter, r *http.Request) {
+	group := &domain.SCIMGroup{}
+
+	if err := json.NewDecoder(r.Body).Decode(group); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	group, err := s.SCIMUseCase.StoreGroup(r.Context(), group)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", group.Meta.Location)
+
+	encodeSCIM(w, http.StatusCreated, group)
+}
+
+func (s *SCIMHandler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	group := &domain.SCIMGroup{}
+
+	if err := json.NewDecoder(r.Body).Decode(group); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	group, err = s.SCIMUseCase.ReplaceGroup(r.Context(), id, group)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, group)
+}
+
+func (s *SCIMHandler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	patch := &domain.SCIMPatch{}
+
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		encodeSCIMError(w, r, domain.ErrSCIMInvalidValue)
+		return
+	}
+
+	group, err := s.SCIMUseCase.PatchGroup(r.Context(), id, patch)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	encodeSCIM(w, http.StatusOK, group)
+}
+
+// DeleteGroup deletes the role of the group.
+func (s *SCIMHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := resourceID(r)
+	if err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	if err := s.SCIMUseCase.DeleteGroup(r.Context(), id); err != nil {
+		encodeSCIMError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimQuery reads the filter and the page of a list request. The
+// startIndex is 1-based.
+func scimQuery(r *http.Request) (*domain.SCIMQuery, error) {
+	params := r.URL.Query()
+
+	query := &domain.SCIMQuery{Filter: params.Get("filter"), StartIndex: 1}
+
+	if startIndex := params.Get("startIndex"); startIndex != "" {
+		value, err := strconv.Atoi(startIndex)
+		if err != nil {
+			return nil, domain.ErrSCIMInvalidValue
+		}
+
+		query.StartIndex = value
+	}
+
+	if count := params.Get("count"); count != "" {
+		value, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, domain.ErrSCIMInvalidValue
+		}
+
+		query.Count = &value
+	}
+
+	return query, nil
+}
+
+// resourceID parses the ID of the path. An ID that is not a number
+// cannot exist.
+func resourceID(r *http.Request) (int64, error) {
+	id, err := enc.ParseID(chi.URLParam(r, "id"))
+	if err != nil {
+		return 0, domain.ErrNotFound
+	}
+
+	return id, nil
+}
+
+func encodeSCIM(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+
+	enc.EncodeJSON(w, status, payload)
+}
+
+// encodeSCIMError sends the SCIM error of err. Invalid passwords and
+// fields are invalid values.
+func encodeSCIMError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	scimType := ""
+	detail := err.Error()
+
+	switch err {
+	case domain.ErrUnauthorized:
+		status = http.StatusUnauthorized
+		if _, ok := r.Context().Value(domain.ContextKeyClaims).(*domain.TokenClaims); ok {
+			status = http.StatusForbidden
+		}
+	case domain.ErrNotFound:
+		status = http.StatusNotFound
+	case domain.ErrSCIMInvalidFilter:
+		status, scimType = http.StatusBadRequest, "invalidFilter"
+	case domain.ErrSCIMInvalidPath:
+		status, scimType = http.StatusBadRequest, "invalidPath"
+	case domain.ErrSCIMNoTarget:
+		status, scimType = http.StatusBadRequest, "noTarget"
+	case domain.ErrSCIMInvalidValue:
+		status, scimType = http.StatusBadRequest, "invalidValue"
+	case domain.ErrSCIMUniqueness:
+		status, scimType = http.StatusConflict, "uniqueness"
+	case domain.ErrSCIMAdmin:
+		status = http.StatusForbidden
+	default:
+		if _, ok := err.(*validation.APIMessage); ok {
+			status, scimType = http.StatusBadRequest, "invalidValue"
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		detail = domain.ErrInternalServerError.Error()
+	}
+
+	log.Error().
+		Err(err).
+		Int("status", status).
+		Str("method", r.Method).
+		Str("end-point", r.RequestURI).
+		Msg(err.Error())
+
+	encodeSCIM(w, status, &scimError{
+		Schemas:  []string{scim.ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,995 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/cyruzin/puppet_master/pkg/scim"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// adminRole is allowed everything, SCIM must not hand it out or take it
+// away.
+const adminRole = "Admin"
+
+type scimUseCase struct {
+	authUseCase domain.AuthUsecase
+	authRepo    domain.AuthRepository
+	roleRepo    domain.RoleRepository
+	userRepo    domain.UserRepository
+}
+
+// NewSCIMUsecase will create new a scimUsecase object representation of
+// domain.SCIMUsecase interface.
+func NewSCIMUsecase(
+	auth domain.AuthUsecase,
+	authRepo domain.AuthRepository,
+	role domain.RoleRepository,
+	user domain.UserRepository,
+) domain.SCIMUsecase {
+	return &scimUseCase{
+		authUseCase: auth,
+		authRepo:    authRepo,
+		roleRepo:    role,
+		userRepo:    user,
+	}
+}
+
+// FetchUsers returns a page of the users matching the filter of the
+// query. Listing every user and looking one up by userName, what
+// provisioning clients do, are paged by the database, other filters
+// are refused rather than matched against every user.
+func (s *scimUseCase) FetchUsers(ctx context.Context, query *domain.SCIMQuery) (*domain.SCIMListResponse, error) {
+	filter, err := parseFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	userName, byUserName := "", false
+	if filter != nil {
+		userName, byUserName = filter.Equal("userName")
+	}
+
+	if filter != nil && !byUserName {
+		return nil, domain.ErrSCIMInvalidFilter
+	}
+
+	return s.fetchUserPage(ctx, userName, query)
+}
+
+// fetchUserPage returns a page of every user, or of the user with the
+// userName when one is given.
+func (s *scimUseCase) fetchUserPage(
+	ctx context.Context,
+	userName string,
+	query *domain.SCIMQuery,
+) (*domain.SCIMListResponse, error) {
+	startIndex, count := pageBounds(query)
+
+	users, total, err := s.userRepo.FetchPage(ctx, userName, startIndex-1, count)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	roles, err := s.userRoles(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]interface{}, 0, len(users))
+
+	for _, user := range users {
+		resources = append(resources, newSCIMUser(user, roles[user.ID]))
+	}
+
+	return &domain.SCIMListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func (s *scimUseCase) GetUser(ctx context.Context, id int64) (*domain.SCIMUser, error) {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetRoleByUserID(ctx, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return newSCIMUser(user, role), nil
+}
+
+// StoreUser provisions a user. Without a password, the user gets a
+// random one nobody knows and signs in with an identity provider or sets
+// a password with a reset. The email is trusted like the ones of an
+// identity provider.
+func (s *scimUseCase) StoreUser(ctx context.Context, scimUser *domain.SCIMUser) (*domain.SCIMUser, error) {
+	user := &domain.User{
+		Email:     userEmail(scimUser, ""),
+		Name:      userName(scimUser, ""),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+
+	if err := validation.IsAValidSchema(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkEmail(ctx, user.Email, 0); err != nil {
+		return nil, err
+	}
+
+	password := scimUser.Password
+
+	if password != "" {
+		if err := validation.IsAValidPassword(ctx, password, user.Name, user.Email); err != nil {
+			return nil, err
+		}
+	} else {
+		randomPassword, err := crypto.RandomToken(32)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		password = randomPassword
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	user.Password = hashedPassword
+
+	newUser, err := s.userRepo.Store(ctx, user)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := s.authRepo.VerifyEmail(ctx, newUser.ID, newUser.Email); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if scimUser.Active != nil && !*scimUser.Active {
+		if err := s.setActive(ctx, newUser, false); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().
+		Str("event", "scim_user_provisioned").
+		Int64("user_id", newUser.ID).
+		Msg("user provisioned")
+
+	return s.GetUser(ctx, newUser.ID)
+}
+
+func (s *scimUseCase) ReplaceUser(
+	ctx context.Context,
+	id int64,
+	scimUser *domain.SCIMUser,
+) (*domain.SCIMUser, error) {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceUser(ctx, user, scimUser)
+}
+
+// PatchUser applies the operations to the user as it is returned, then
+// saves it like ReplaceUser.
+func (s *scimUseCase) PatchUser(ctx context.Context, id int64, patch *domain.SCIMPatch) (*domain.SCIMUser, error) {
+	current, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := applyPatch(current, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers send booleans as strings, like "False".
+	if active, ok := resource["active"].(string); ok {
+		value, err := strconv.ParseBool(active)
+		if err != nil {
+			return nil, domain.ErrSCIMInvalidValue
+		}
+
+		resource["active"] = value
+	}
+
+	scimUser := &domain.SCIMUser{}
+
+	if err := decodeResource(resource, scimUser); err != nil {
+		return nil, err
+	}
+
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceUser(ctx, user, scimUser)
+}
+
+// DeleteUser deprovisions a user. The account is disabled rather than
+// deleted, so its history is kept, and every session and cached
+// permission of the user is revoked.
+func (s *scimUseCase) DeleteUser(ctx context.Context, id int64) error {
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkAdmin(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.setActive(ctx, user, false)
+}
+
+// FetchGroups returns a page of the groups matching the filter of the
+// query.
+func (s *scimUseCase) FetchGroups(ctx context.Context, query *domain.SCIMQuery) (*domain.SCIMListResponse, error) {
+	filter, err := parseFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.roleRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	resources := []interface{}{}
+
+	for _, role := range roles {
+		members, err := s.roleRepo.GetUsersByRoleID(ctx, role.ID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		group := newSCIMGroup(role, members)
+
+		match, err := matchFilter(filter, group)
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			resources = append(resources, group)
+		}
+	}
+
+	return page(resources, query), nil
+}
+
+func (s *scimUseCase) GetGroup(ctx context.Context, id int64) (*domain.SCIMGroup, error) {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.roleRepo.GetUsersByRoleID(ctx, role.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return newSCIMGroup(role, members), nil
+}
+
+// StoreGroup creates a role for the group and gives it to its members.
+func (s *scimUseCase) StoreGroup(ctx context.Context, group *domain.SCIMGroup) (*domain.SCIMGroup, error) {
+	name := strings.TrimSpace(group.DisplayName)
+
+	if err := s.checkRoleName(ctx, name, 0); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMembers(ctx, group.Members); err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.Store(ctx, &domain.Role{
+		Name:        name,
+		Description: name,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := s.syncMembers(ctx, role, group.Members); err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(ctx, role.ID)
+}
+
+func (s *scimUseCase) ReplaceGroup(
+	ctx context.Context,
+	id int64,
+	group *domain.SCIMGroup,
+) (*domain.SCIMGroup, error) {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceGroup(ctx, role, group)
+}
+
+// PatchGroup applies the operations to the group as it is returned, then
+// saves it like ReplaceGroup.
+func (s *scimUseCase) PatchGroup(ctx context.Context, id int64, patch *domain.SCIMPatch) (*domain.SCIMGroup, error) {
+	current, err := s.GetGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := applyPatch(current, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &domain.SCIMGroup{}
+
+	if err := decodeResource(resource, group); err != nil {
+		return nil, err
+	}
+
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceGroup(ctx, role, group)
+}
+
+// DeleteGroup deletes the role of the group, its members are left
+// without a role.
+func (s *scimUseCase) DeleteGroup(ctx context.Context, id int64) error {
+	role, err := s.role(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if role.Name == adminRole {
+		return domain.ErrSCIMAdmin
+	}
+
+	members, err := s.roleRepo.GetUsersByRoleID(ctx, role.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := s.roleRepo.Delete(ctx, role.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	for _, member := range members {
+		if err := s.authUseCase.RevokeUserAccess(ctx, member.ID); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceUser saves the attributes of a SCIM user that changed. The
+// groups are ignored, they are read only.
+func (s *scimUseCase) replaceUser(
+	ctx context.Context,
+	user *domain.User,
+	scimUser *domain.SCIMUser,
+) (*domain.SCIMUser, error) {
+	if err := s.checkAdmin(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	updatedUser := &domain.User{
+		ID:        user.ID,
+		Name:      userName(scimUser, user.Name),
+		Email:     userEmail(scimUser, user.Email),
+		UpdatedAt: time.Now(),
+	}
+
+	if updatedUser.Name != user.Name || updatedUser.Email != user.Email {
+		if err := validation.IsAValidSchema(ctx, updatedUser); err != nil {
+			return nil, err
+		}
+
+		if err := s.checkEmail(ctx, updatedUser.Email, user.ID); err != nil {
+			return nil, err
+		}
+
+		if _, err := s.userRepo.Update(ctx, updatedUser); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if updatedUser.Email != user.Email {
+			if err := s.authRepo.VerifyEmail(ctx, user.ID, updatedUser.Email); err != nil {
+				log.Error().Stack().Err(err).Msg(err.Error())
+				return nil, err
+			}
+		}
+	}
+
+	if scimUser.Password != "" {
+		if err := s.setPassword(ctx, updatedUser, scimUser.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if scimUser.Active != nil {
+		if err := s.setActive(ctx, user, *scimUser.Active); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetUser(ctx, user.ID)
+}
+
+// setPassword changes the password of a user and signs them out
+// everywhere, like a password reset.
+func (s *scimUseCase) setPassword(ctx context.Context, user *domain.User, password string) error {
+	if err := validation.IsAValidPassword(ctx, password, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := s.authRepo.ChangePassword(ctx, user.ID, hashedPassword, validation.CurrentPasswordPolicy().History); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := s.authUseCase.RevokeUserAccess(ctx, user.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// setActive enables or disables a user. A disabled user is signed out
+// and its cached permissions are dropped.
+func (s *scimUseCase) setActive(ctx context.Context, user *domain.User, active bool) error {
+	if active == (user.DisabledAt == nil) {
+		return nil
+	}
+
+	var disabledAt *time.Time
+
+	if !active {
+		now := time.Now()
+		disabledAt = &now
+	}
+
+	if err := s.userRepo.SetDisabledAt(ctx, user.ID, disabledAt); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	user.DisabledAt = disabledAt
+
+	if !active {
+		if err := s.authUseCase.RevokeUserAccess(ctx, user.ID); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+	}
+
+	log.Info().
+		Str("event", "scim_user_status_changed").
+		Int64("user_id", user.ID).
+		Bool("active", active).
+		Msg("user status changed")
+
+	return nil
+}
+
+// replaceGroup renames the role of a group and gives it to exactly the
+// members of the group.
+func (s *scimUseCase) replaceGroup(
+	ctx context.Context,
+	role *domain.Role,
+	group *domain.SCIMGroup,
+) (*domain.SCIMGroup, error) {
+	if role.Name == adminRole {
+		return nil, domain.ErrSCIMAdmin
+	}
+
+	name := strings.TrimSpace(group.DisplayName)
+
+	if err := s.checkMembers(ctx, group.Members); err != nil {
+		return nil, err
+	}
+
+	if name != role.Name {
+		if err := s.checkRoleName(ctx, name, role.ID); err != nil {
+			return nil, err
+		}
+
+		updatedRole, err := s.roleRepo.Update(ctx, &domain.Role{
+			ID:          role.ID,
+			Name:        name,
+			Description: role.Description,
+			UpdatedAt:   time.Now(),
+		})
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		role = updatedRole
+	}
+
+	if err := s.syncMembers(ctx, role, group.Members); err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(ctx, role.ID)
+}
+
+// syncMembers gives the role to the given members and takes it from the
+// other users. A user has one role, joining a group leaves the previous
+// one. The access of every user whose role changed is revoked, so the
+// new role applies right away.
+func (s *scimUseCase) syncMembers(ctx context.Context, role *domain.Role, members []*domain.SCIMMember) error {
+	current, err := s.roleRepo.GetUsersByRoleID(ctx, role.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	memberIDs := map[int64]bool{}
+
+	for _, member := range members {
+		id, _ := strconv.ParseInt(member.Value, 10, 64)
+		memberIDs[id] = true
+	}
+
+	changed := []int64{}
+
+	for _, user := range current {
+		if memberIDs[user.ID] {
+			delete(memberIDs, user.ID)
+			continue
+		}
+
+		if err := s.roleRepo.RemoveRoleToUser(ctx, int(role.ID), user.ID); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		changed = append(changed, user.ID)
+	}
+
+	for userID := range memberIDs {
+		if err := s.roleRepo.SyncRoleToUser(ctx, int(role.ID), userID); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		changed = append(changed, userID)
+	}
+
+	for _, userID := range changed {
+		if err := s.authUseCase.RevokeUserAccess(ctx, userID); err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		log.Info().
+			Str("event", "scim_group_membership_changed").
+			Int64("user_id", userID).
+			Int64("role_id", role.ID).
+			Msg("role changed by the group membership")
+	}
+
+	return nil
+}
+
+// checkMembers checks that every member is a user who is not an Admin,
+// before any role is changed.
+func (s *scimUseCase) checkMembers(ctx context.Context, members []*domain.SCIMMember) error {
+	for _, member := range members {
+		id, err := strconv.ParseInt(member.Value, 10, 64)
+		if err != nil {
+			return domain.ErrSCIMInvalidValue
+		}
+
+		user, err := s.userRepo.GetByID(ctx, id)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return err
+		}
+
+		if user.ID == 0 {
+			return domain.ErrSCIMInvalidValue
+		}
+
+		if err := s.checkAdmin(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkAdmin refuses to change the users with the Admin role.
+func (s *scimUseCase) checkAdmin(ctx context.Context, userID int64) error {
+	role, err := s.roleRepo.GetRoleByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if role.Name == adminRole {
+		return domain.ErrSCIMAdmin
+	}
+
+	return nil
+}
+
+// checkEmail refuses an email that belongs to another user.
+func (s *scimUseCase) checkEmail(ctx context.Context, email string, userID int64) error {
+	user, err := s.authRepo.Authenticate(ctx, email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if user.ID != 0 && user.ID != userID {
+		return domain.ErrSCIMUniqueness
+	}
+
+	return nil
+}
+
+// checkRoleName refuses an empty name and one that belongs to another
+// role.
+func (s *scimUseCase) checkRoleName(ctx context.Context, name string, roleID int64) error {
+	if name == "" {
+		return domain.ErrSCIMInvalidValue
+	}
+
+	roles, err := s.roleRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	for _, role := range roles {
+		if role.ID != roleID && strings.EqualFold(role.Name, name) {
+			return domain.ErrSCIMUniqueness
+		}
+	}
+
+	return nil
+}
+
+func (s *scimUseCase) user(ctx context.Context, id int64) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (s *scimUseCase) role(ctx context.Context, id int64) (*domain.Role, error) {
+	role, err := s.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if role.ID == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return role, nil
+}
+
+// userRoles returns the role of each of the users with one.
+func (s *scimUseCase) userRoles(ctx context.Context, users []*domain.User) (map[int64]*domain.Role, error) {
+	userIDs := make([]int64, 0, len(users))
+
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	roles, err := s.roleRepo.GetRolesByUserIDs(ctx, userIDs)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func newSCIMUser(user *domain.User, role *domain.Role) *domain.SCIMUser {
+	active := user.DisabledAt == nil
+	id := strconv.FormatInt(user.ID, 10)
+
+	scimUser := &domain.SCIMUser{
+		Schemas:     []string{scim.UserSchema},
+		ID:          id,
+		UserName:    user.Email,
+		Name:        &domain.SCIMName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []*domain.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &domain.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     location("Users", user.ID),
+		},
+	}
+
+	if role != nil && role.ID != 0 {
+		scimUser.Groups = []*domain.SCIMMember{{
+			Value:   strconv.FormatInt(role.ID, 10),
+			Display: role.Name,
+			Ref:     location("Groups", role.ID),
+		}}
+	}
+
+	return scimUser
+}
+
+func newSCIMGroup(role *domain.Role, members []*domain.User) *domain.SCIMGroup {
+	group := &domain.SCIMGroup{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          strconv.FormatInt(role.ID, 10),
+		DisplayName: role.Name,
+		Members:     []*domain.SCIMMember{},
+		Meta: &domain.SCIMMeta{
+			ResourceType: "Group",
+			Created:      role.CreatedAt,
+			LastModified: role.UpdatedAt,
+			Location:     location("Groups", role.ID),
+		},
+	}
+
+	for _, member := range members {
+		group.Members = append(group.Members, &domain.SCIMMember{
+			Value:   strconv.FormatInt(member.ID, 10),
+			Display: member.Name,
+			Ref:     location("Users", member.ID),
+		})
+	}
+
+	return group
+}
+
+// userName returns the first of the display name, the formatted name and
+// the given and family names that differs from the current name. The
+// resource keeps the current name in all of them, a client changes one.
+func userName(scimUser *domain.SCIMUser, current string) string {
+	names := []string{scimUser.DisplayName}
+
+	if scimUser.Name != nil {
+		names = append(
+			names,
+			scimUser.Name.Formatted,
+			scimUser.Name.GivenName+" "+scimUser.Name.FamilyName,
+		)
+	}
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" && name != current {
+			return name
+		}
+	}
+
+	return current
+}
+
+// userEmail returns the first of the userName, the primary email and the
+// other emails that differs from the current email.
+func userEmail(scimUser *domain.SCIMUser, current string) string {
+	emails := []string{scimUser.UserName}
+
+	for _, primary := range []bool{true, false} {
+		for _, email := range scimUser.Emails {
+			if email != nil && email.Primary == primary {
+				emails = append(emails, email.Value)
+			}
+		}
+	}
+
+	for _, email := range emails {
+		if email = strings.TrimSpace(email); email != "" && email != current {
+			return email
+		}
+	}
+
+	return current
+}
+
+func parseFilter(filter string) (*scim.Filter, error) {
+	if filter == "" {
+		return nil, nil
+	}
+
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, domain.ErrSCIMInvalidFilter
+	}
+
+	return f, nil
+}
+
+func matchFilter(filter *scim.Filter, resource interface{}) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+
+	object, err := encodeResource(resource)
+	if err != nil {
+		return false, err
+	}
+
+	return filter.Match(object), nil
+}
+
+func applyPatch(resource interface{}, patch *domain.SCIMPatch) (map[string]interface{}, error) {
+	object, err := encodeResource(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operation := range patch.Operations {
+		if operation == nil {
+			return nil, domain.ErrSCIMInvalidValue
+		}
+
+		err := scim.Apply(object, operation.Op, operation.Path, operation.Value)
+
+		switch err {
+		case nil:
+		case scim.ErrInvalidPath:
+			return nil, domain.ErrSCIMInvalidPath
+		case scim.ErrNoTarget:
+			return nil, domain.ErrSCIMNoTarget
+		default:
+			return nil, domain.ErrSCIMInvalidValue
+		}
+	}
+
+	return object, nil
+}
+
+// encodeResource turns a resource into the JSON object filters and
+// patches work on.
+func encodeResource(resource interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	object := map[string]interface{}{}
+
+	if err := json.Unmarshal(data, &object); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func decodeResource(object map[string]interface{}, resource interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return domain.ErrSCIMInvalidValue
+	}
+
+	if err := json.Unmarshal(data, resource); err != nil {
+		return domain.ErrSCIMInvalidValue
+	}
+
+	return nil
+}
+
+// pageBounds returns the 1-based index of the first resource of the
+// page of a query and the number of resources it holds at most.
+func pageBounds(query *domain.SCIMQuery) (int, int) {
+	count := viper.GetInt(`scim.max_results`)
+	if count <= 0 {
+		count = 100
+	}
+
+	if query.Count != nil && *query.Count < count {
+		count = *query.Count
+	}
+
+	if count < 0 {
+		count = 0
+	}
+
+	startIndex := query.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	return startIndex, count
+}
+
+// page returns the resources from the 1-based startIndex of the query,
+// at most scim.max_results of them.
+func page(resources []interface{}, query *domain.SCIMQuery) *domain.SCIMListResponse {
+	startIndex, count := pageBounds(query)
+
+	list := &domain.SCIMListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		Resources:    []interface{}{},
+	}
+
+	if startIndex <= len(resources) {
+		end := startIndex - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+
+		list.Resources = resources[startIndex-1 : end]
+	}
+
+	list.ItemsPerPage = len(list.Resources)
+
+	return list
+}
+
+func location(resourceType string, id int64) string {
+	return strings.TrimRight(viper.GetString(`oidc.issuer`), "/") +
+		"/scim/v2/" + resourceType + "/" + strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,228 @@
+package usecase_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/modules/scim/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthUsecase struct {
+	domain.AuthUsecase
+	revoked []int64
+}
+
+func (a *testAuthUsecase) RevokeUserAccess(ctx context.Context, userID int64) error {
+	a.revoked = append(a.revoked, userID)
+
+	return nil
+}
+
+type testUserRepository struct {
+	domain.UserRepository
+	users map[int64]*domain.User
+}
+
+func (r *testUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+
+	return &domain.User{}, nil
+}
+
+func (r *testUserRepository) SetDisabledAt(ctx context.Context, id int64, disabledAt *time.Time) error {
+	r.users[id].DisabledAt = disabledAt
+
+	return nil
+}
+
+// testRoleRepository keeps one role per user, like the user_role table.
+type testRoleRepository struct {
+	domain.RoleRepository
+	roles     map[int64]*domain.Role
+	userRoles map[int64]int64
+	users     *testUserRepository
+}
+
+func (r *testRoleRepository) GetByID(ctx context.Context, id int64) (*domain.Role, error) {
+	if role, ok := r.roles[id]; ok {
+		return role, nil
+	}
+
+	return &domain.Role{}, nil
+}
+
+func (r *testRoleRepository) GetRoleByUserID(ctx context.Context, userID int64) (*domain.Role, error) {
+	return r.GetByID(ctx, r.userRoles[userID])
+}
+
+func (r *testRoleRepository) GetUsersByRoleID(ctx context.Context, roleID int64) ([]*domain.User, error) {
+	users := []*domain.User{}
+
+	for userID, userRoleID := range r.userRoles {
+		if userRoleID == roleID {
+			users = append(users, r.users.users[userID])
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (r *testRoleRepository) SyncRoleToUser(ctx context.Context, role int, userID int64) error {
+	r.userRoles[userID] = int64(role)
+
+	return nil
+}
+
+func (r *testRoleRepository) RemoveRoleToUser(ctx context.Context, role int, userID int64) error {
+	if r.userRoles[userID] == int64(role) {
+		delete(r.userRoles, userID)
+	}
+
+	return nil
+}
+
+func (r *testRoleRepository) Delete(ctx context.Context, id int64) error {
+	delete(r.roles, id)
+
+	for userID, roleID := range r.userRoles {
+		if roleID == id {
+			delete(r.userRoles, userID)
+		}
+	}
+
+	return nil
+}
+
+type testSCIM struct {
+	usecase domain.SCIMUsecase
+	auth    *testAuthUsecase
+	users   *testUserRepository
+	roles   *testRoleRepository
+}
+
+// newTestSCIM returns burns (1) with the Admin role, homer (2) and bart
+// (4) with the Viewer role and marge (3) with the Editor role.
+func newTestSCIM(t *testing.T) *testSCIM {
+	users := &testUserRepository{users: map[int64]*domain.User{
+		1: {ID: 1, Name: "Burns", Email: "burns@simpsons.org"},
+		2: {ID: 2, Name: "Homer", Email: "homer@simpsons.org"},
+		3: {ID: 3, Name: "Marge", Email: "marge@simpsons.org"},
+		4: {ID: 4, Name: "Bart", Email: "bart@simpsons.org"},
+	}}
+
+	roles := &testRoleRepository{
+		roles: map[int64]*domain.Role{
+			1: {ID: 1, Name: "Admin"},
+			2: {ID: 2, Name: "Viewer"},
+			3: {ID: 3, Name: "Editor"},
+		},
+		userRoles: map[int64]int64{1: 1, 2: 2, 3: 3, 4: 2},
+		users:     users,
+	}
+
+	auth := &testAuthUsecase{}
+
+	return &testSCIM{
+		usecase: usecase.NewSCIMUsecase(auth, nil, roles, users),
+		auth:    auth,
+		users:   users,
+		roles:   roles,
+	}
+}
+
+func TestDeleteUserDisablesAndRevokesAccess(t *testing.T) {
+	scim := newTestSCIM(t)
+
+	require.NoError(t, scim.usecase.DeleteUser(context.Background(), 2))
+
+	assert.NotNil(t, scim.users.users[2].DisabledAt)
+	assert.Equal(t, []int64{2}, scim.auth.revoked)
+
+	user, err := scim.usecase.GetUser(context.Background(), 2)
+	require.NoError(t, err)
+	assert.False(t, *user.Active)
+
+	require.NoError(t, scim.usecase.DeleteUser(context.Background(), 2))
+	assert.Equal(t, []int64{2}, scim.auth.revoked, "an already disabled user is left alone")
+}
+
+func TestAdminRoleCannotBeChanged(t *testing.T) {
+	scim := newTestSCIM(t)
+	ctx := context.Background()
+
+	err := scim.usecase.DeleteUser(ctx, 1)
+	assert.Equal(t, domain.ErrSCIMAdmin, err)
+
+	active := false
+	_, err = scim.usecase.ReplaceUser(ctx, 1, &domain.SCIMUser{UserName: "burns@simpsons.org", Active: &active})
+	assert.Equal(t, domain.ErrSCIMAdmin, err)
+
+	_, err = scim.usecase.ReplaceGroup(ctx, 1, &domain.SCIMGroup{DisplayName: "Admin"})
+	assert.Equal(t, domain.ErrSCIMAdmin, err)
+
+	err = scim.usecase.DeleteGroup(ctx, 1)
+	assert.Equal(t, domain.ErrSCIMAdmin, err)
+
+	_, err = scim.usecase.ReplaceGroup(ctx, 2, &domain.SCIMGroup{
+		DisplayName: "Viewer",
+		Members:     []*domain.SCIMMember{{Value: "1"}, {Value: "2"}},
+	})
+	assert.Equal(t, domain.ErrSCIMAdmin, err)
+
+	assert.Nil(t, scim.users.users[1].DisabledAt)
+	assert.Equal(t, int64(1), scim.roles.userRoles[1])
+	assert.Contains(t, scim.roles.roles, int64(1))
+	assert.Empty(t, scim.auth.revoked)
+}
+
+func TestReplaceGroupMovesMembersBetweenRoles(t *testing.T) {
+	scim := newTestSCIM(t)
+	ctx := context.Background()
+
+	group, err := scim.usecase.ReplaceGroup(ctx, 3, &domain.SCIMGroup{
+		DisplayName: "Editor",
+		Members:     []*domain.SCIMMember{{Value: "2"}, {Value: "3"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, group.Members, 2)
+
+	assert.Equal(t, int64(3), scim.roles.userRoles[2], "homer left Viewer for Editor")
+	assert.Equal(t, int64(2), scim.roles.userRoles[4])
+	assert.Equal(t, []int64{2}, scim.auth.revoked)
+
+	_, err = scim.usecase.ReplaceGroup(ctx, 3, &domain.SCIMGroup{
+		DisplayName: "Editor",
+		Members:     []*domain.SCIMMember{{Value: "2"}},
+	})
+	require.NoError(t, err)
+
+	assert.NotContains(t, scim.roles.userRoles, int64(3), "marge was left without a role")
+	assert.Equal(t, []int64{2, 3}, scim.auth.revoked)
+}
+
+func TestDeleteGroupRevokesItsMembers(t *testing.T) {
+	scim := newTestSCIM(t)
+
+	require.NoError(t, scim.usecase.DeleteGroup(context.Background(), 2))
+
+	assert.NotContains(t, scim.roles.roles, int64(2))
+	assert.NotContains(t, scim.roles.userRoles, int64(2))
+	assert.NotContains(t, scim.roles.userRoles, int64(4))
+	assert.Equal(t, []int64{2, 4}, scim.auth.revoked)
+}
+
+func TestFetchUsersRefusesUnsupportedFilters(t *testing.T) {
+	scim := newTestSCIM(t)
+
+	_, err := scim.usecase.FetchUsers(context.Background(), &domain.SCIMQuery{Filter: `name.formatted co "Hom"`})
+	assert.Equal(t, domain.ErrSCIMInvalidFilter, err)
+}
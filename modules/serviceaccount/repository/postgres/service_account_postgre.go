@@ -0,0 +1,243 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type postgreRepository struct {
+	Conn *sqlx.DB
+}
+
+// NewPostgreServiceAccountRepository will create an object that represent
+// the serviceaccount.Repository interface.
+func NewPostgreServiceAccountRepository(Conn *sqlx.DB) domain.ServiceAccountRepository {
+	return &postgreRepository{Conn}
+}
+
+func (p *postgreRepository) Fetch(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	query := "SELECT * FROM service_accounts ORDER BY id"
+
+	serviceAccounts := []*domain.ServiceAccount{}
+
+	err := p.Conn.SelectContext(ctx, &serviceAccounts, query)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return serviceAccounts, nil
+}
+
+func (p *postgreRepository) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	var serviceAccount domain.ServiceAccount
+
+	query := "SELECT * FROM service_accounts WHERE id = $1"
+
+	err := p.Conn.GetContext(ctx, &serviceAccount, query, id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &serviceAccount, nil
+}
+
+func (p *postgreRepository) Store(ctx context.Context, serviceAccount *domain.ServiceAccount) (*domain.ServiceAccount, error) {
+	query := `
+		INSERT INTO service_accounts (
+			name,
+			description,
+			owner_id,
+			role_id,
+			created_at,
+			updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err := p.Conn.GetContext(
+		ctx,
+		&serviceAccount.ID,
+		query,
+		serviceAccount.Name,
+		serviceAccount.Description,
+		serviceAccount.OwnerID,
+		serviceAccount.RoleID,
+		serviceAccount.CreatedAt,
+		serviceAccount.UpdatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	return serviceAccount, nil
+}
+
+func (p *postgreRepository) Update(ctx context.Context, serviceAccount *domain.ServiceAccount) (*domain.ServiceAccount, error) {
+	query := `
+		UPDATE service_accounts
+		SET
+		name = $1,
+		description = $2,
+		owner_id = $3,
+		role_id = $4,
+		updated_at = $5
+		WHERE id = $6
+	`
+
+	result, err := p.Conn.ExecContext(
+		ctx,
+		query,
+		serviceAccount.Name,
+		serviceAccount.Description,
+		serviceAccount.OwnerID,
+		serviceAccount.RoleID,
+		serviceAccount.UpdatedAt,
+		serviceAccount.ID,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return p.GetByID(ctx, serviceAccount.ID)
+}
+
+func (p *postgreRepository) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM service_accounts WHERE id = $1"
+
+	result, err := p.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) FetchCredentials(
+	ctx context.Context,
+	serviceAccountID int64,
+) ([]*domain.ServiceAccountCredential, error) {
+	query := "SELECT * FROM service_account_credentials WHERE service_account_id = $1 ORDER BY id"
+
+	credentials := []*domain.ServiceAccountCredential{}
+
+	err := p.Conn.SelectContext(ctx, &credentials, query, serviceAccountID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrFetchError
+	}
+
+	return credentials, nil
+}
+
+func (p *postgreRepository) GetCredentialByClientID(
+	ctx context.Context,
+	clientID string,
+) (*domain.ServiceAccountCredential, error) {
+	var credential domain.ServiceAccountCredential
+
+	query := "SELECT * FROM service_account_credentials WHERE client_id = $1"
+
+	err := p.Conn.GetContext(ctx, &credential, query, clientID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrGetByIDError
+	}
+
+	return &credential, nil
+}
+
+func (p *postgreRepository) StoreCredential(
+	ctx context.Context,
+	credential *domain.ServiceAccountCredential,
+) (*domain.ServiceAccountCredential, error) {
+	query := `
+		INSERT INTO service_account_credentials (
+			service_account_id,
+			client_id,
+			secret,
+			created_at
+		)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := p.Conn.GetContext(
+		ctx,
+		&credential.ID,
+		query,
+		credential.ServiceAccountID,
+		credential.ClientID,
+		credential.Secret,
+		credential.CreatedAt,
+	)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
+	return credential, nil
+}
+
+func (p *postgreRepository) DeleteCredential(ctx context.Context, serviceAccountID, id int64) error {
+	query := "DELETE FROM service_account_credentials WHERE id = $1 AND service_account_id = $2"
+
+	result, err := p.Conn.ExecContext(ctx, query, id, serviceAccountID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrDeleteError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *postgreRepository) TouchCredential(ctx context.Context, id int64, usedAt time.Time) error {
+	query := "UPDATE service_account_credentials SET last_used_at = $1 WHERE id = $2"
+
+	if _, err := p.Conn.ExecContext(ctx, query, usedAt, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	return nil
+}
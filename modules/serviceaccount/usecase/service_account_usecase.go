@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+type serviceAccountUseCase struct {
+	authUseCase        domain.AuthUsecase
+	serviceAccountRepo domain.ServiceAccountRepository
+	roleRepo           domain.RoleRepository
+	userRepo           domain.UserRepository
+}
+
+// NewServiceAccountUsecase will create new a serviceAccountUsecase object
+// representation of domain.ServiceAccountUsecase interface.
+func NewServiceAccountUsecase(
+	auth domain.AuthUsecase,
+	serviceAccount domain.ServiceAccountRepository,
+	role domain.RoleRepository,
+	user domain.UserRepository,
+) domain.ServiceAccountUsecase {
+	return &serviceAccountUseCase{
+		authUseCase:        auth,
+		serviceAccountRepo: serviceAccount,
+		roleRepo:           role,
+		userRepo:           user,
+	}
+}
+
+func (s *serviceAccountUseCase) Fetch(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	serviceAccounts, err := s.serviceAccountRepo.Fetch(ctx)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccounts, nil
+}
+
+func (s *serviceAccountUseCase) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	serviceAccount, err := s.serviceAccountRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+func (s *serviceAccountUseCase) Store(
+	ctx context.Context,
+	serviceAccount *domain.ServiceAccount,
+) (*domain.ServiceAccount, error) {
+	if err := s.checkServiceAccount(ctx, serviceAccount); err != nil {
+		return nil, err
+	}
+
+	serviceAccount.CreatedAt = time.Now()
+	serviceAccount.UpdatedAt = time.Now()
+
+	newServiceAccount, err := s.serviceAccountRepo.Store(ctx, serviceAccount)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return newServiceAccount, nil
+}
+
+// Update changes a service account, it keeps its owner when none is
+// given. Its current tokens are revoked so a new role applies right away.
+func (s *serviceAccountUseCase) Update(
+	ctx context.Context,
+	serviceAccount *domain.ServiceAccount,
+) (*domain.ServiceAccount, error) {
+	if serviceAccount.OwnerID == 0 {
+		current, err := s.serviceAccountRepo.GetByID(ctx, serviceAccount.ID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg(err.Error())
+			return nil, err
+		}
+
+		if current.ID == 0 {
+			return nil, domain.ErrNotFound
+		}
+
+		serviceAccount.OwnerID = current.OwnerID
+	}
+
+	if err := s.checkServiceAccount(ctx, serviceAccount); err != nil {
+		return nil, err
+	}
+
+	serviceAccount.UpdatedAt = time.Now()
+
+	updatedServiceAccount, err := s.serviceAccountRepo.Update(ctx, serviceAccount)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if err := s.authUseCase.RevokeServiceAccountTokens(ctx, updatedServiceAccount.ID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return updatedServiceAccount, nil
+}
+
+// Delete removes a service account with its credentials and revokes its
+// tokens.
+func (s *serviceAccountUseCase) Delete(ctx context.Context, id int64) error {
+	if err := s.serviceAccountRepo.Delete(ctx, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := s.authUseCase.RevokeServiceAccountTokens(ctx, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *serviceAccountUseCase) FetchCredentials(
+	ctx context.Context,
+	id int64,
+) ([]*domain.ServiceAccountCredential, error) {
+	credentials, err := s.serviceAccountRepo.FetchCredentials(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// CreateCredential adds a client ID and secret pair to a service account.
+// Only the hash of the secret is kept, so it is returned this one time.
+// A service account may have several credentials to rotate them without
+// downtime.
+func (s *serviceAccountUseCase) CreateCredential(ctx context.Context, id int64) (*domain.ServiceAccountSecret, error) {
+	serviceAccount, err := s.serviceAccountRepo.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	if serviceAccount.ID == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	clientID, err := crypto.RandomToken(16)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	secret, err := crypto.RandomToken(32)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	credential, err := s.serviceAccountRepo.StoreCredential(ctx, &domain.ServiceAccountCredential{
+		ServiceAccountID: serviceAccount.ID,
+		ClientID:         domain.ServiceAccountClientPrefix + clientID,
+		Secret:           crypto.HashToken(secret),
+		CreatedAt:        time.Now(),
+	})
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, err
+	}
+
+	return &domain.ServiceAccountSecret{Credential: credential, ClientSecret: secret}, nil
+}
+
+// DeleteCredential removes a credential of a service account. Tokens are
+// not tied to the credential that got them, so every token of the
+// service account is revoked.
+func (s *serviceAccountUseCase) DeleteCredential(ctx context.Context, id, credentialID int64) error {
+	if err := s.serviceAccountRepo.DeleteCredential(ctx, id, credentialID); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if err := s.authUseCase.RevokeServiceAccountTokens(ctx, id); err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// checkServiceAccount checks that the owner and the role of a service
+// account exist.
+func (s *serviceAccountUseCase) checkServiceAccount(ctx context.Context, serviceAccount *domain.ServiceAccount) error {
+	owner, err := s.userRepo.GetByID(ctx, serviceAccount.OwnerID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if owner.ID == 0 {
+		return domain.ErrUserID
+	}
+
+	role, err := s.roleRepo.GetByID(ctx, serviceAccount.RoleID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return err
+	}
+
+	if role.ID == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package usecase_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/modules/serviceaccount/usecase"
+	"github.com/cyruzin/puppet_master/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthUsecase struct {
+	domain.AuthUsecase
+	revoked []int64
+}
+
+func (a *testAuthUsecase) RevokeServiceAccountTokens(ctx context.Context, serviceAccountID int64) error {
+	a.revoked = append(a.revoked, serviceAccountID)
+
+	return nil
+}
+
+type testServiceAccountRepository struct {
+	domain.ServiceAccountRepository
+	serviceAccount *domain.ServiceAccount
+	credential     *domain.ServiceAccountCredential
+}
+
+func (r *testServiceAccountRepository) GetByID(ctx context.Context, id int64) (*domain.ServiceAccount, error) {
+	if id != r.serviceAccount.ID {
+		return &domain.ServiceAccount{}, nil
+	}
+
+	return r.serviceAccount, nil
+}
+
+func (r *testServiceAccountRepository) Update(
+	ctx context.Context,
+	serviceAccount *domain.ServiceAccount,
+) (*domain.ServiceAccount, error) {
+	r.serviceAccount = serviceAccount
+
+	return serviceAccount, nil
+}
+
+func (r *testServiceAccountRepository) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (r *testServiceAccountRepository) StoreCredential(
+	ctx context.Context,
+	credential *domain.ServiceAccountCredential,
+) (*domain.ServiceAccountCredential, error) {
+	credential.ID = 1
+	r.credential = credential
+
+	return credential, nil
+}
+
+func (r *testServiceAccountRepository) DeleteCredential(ctx context.Context, serviceAccountID, id int64) error {
+	return nil
+}
+
+type testRoleRepository struct {
+	domain.RoleRepository
+}
+
+func (r *testRoleRepository) GetByID(ctx context.Context, id int64) (*domain.Role, error) {
+	return &domain.Role{ID: id, Name: "Viewer"}, nil
+}
+
+type testUserRepository struct {
+	domain.UserRepository
+}
+
+func (r *testUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	return &domain.User{ID: id}, nil
+}
+
+func newTestServiceAccount() (domain.ServiceAccountUsecase, *testAuthUsecase, *testServiceAccountRepository) {
+	auth := &testAuthUsecase{}
+	repo := &testServiceAccountRepository{
+		serviceAccount: &domain.ServiceAccount{ID: 7, Name: "reporting", OwnerID: 2, RoleID: 2},
+	}
+
+	return usecase.NewServiceAccountUsecase(auth, repo, &testRoleRepository{}, &testUserRepository{}), auth, repo
+}
+
+func TestCreateCredentialKeepsOnlyTheSecretHash(t *testing.T) {
+	serviceAccounts, _, repo := newTestServiceAccount()
+
+	secret, err := serviceAccounts.CreateCredential(context.Background(), 7)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(secret.Credential.ClientID, domain.ServiceAccountClientPrefix))
+	assert.NotEmpty(t, secret.ClientSecret)
+	assert.Equal(t, crypto.HashToken(secret.ClientSecret), repo.credential.Secret)
+	assert.Equal(t, int64(7), repo.credential.ServiceAccountID)
+
+	_, err = serviceAccounts.CreateCredential(context.Background(), 8)
+	assert.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestChangesRevokeServiceAccountTokens(t *testing.T) {
+	serviceAccounts, auth, repo := newTestServiceAccount()
+	ctx := context.Background()
+
+	updated, err := serviceAccounts.Update(ctx, &domain.ServiceAccount{ID: 7, Name: "reporting", RoleID: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.OwnerID, "the owner is kept")
+	assert.Equal(t, int64(3), repo.serviceAccount.RoleID)
+
+	require.NoError(t, serviceAccounts.DeleteCredential(ctx, 7, 1))
+	require.NoError(t, serviceAccounts.Delete(ctx, 7))
+
+	assert.Equal(t, []int64{7, 7, 7}, auth.revoked)
+}
@@ -0,0 +1,154 @@
+package gql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// MyAPIKeysQueryResolver lists the API keys of the authenticated user.
+func (r *Resolver) MyAPIKeysQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	userID, err := currentUserID(params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := r.apiKeyUseCase.Fetch(params.Context, userID)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// APIKeyCreateResolver creates an API key for the authenticated user.
+func (r *Resolver) APIKeyCreateResolver(params graphql.ResolveParams) (interface{}, error) {
+	userID, err := keyManagerID(params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyParams, ok := params.Args["APIKey"].(map[string]interface{})
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return nil, domain.ErrBadRequest
+	}
+
+	apiKey := &domain.APIKey{
+		UserID:      userID,
+		Name:        apiKeyParams["name"].(string),
+		Permissions: []string{},
+	}
+
+	if permissions, ok := apiKeyParams["permissions"].([]interface{}); ok {
+		for _, permission := range permissions {
+			apiKey.Permissions = append(apiKey.Permissions, permission.(string))
+		}
+	}
+
+	if expiresAt, ok := apiKeyParams["expires_at"].(time.Time); ok {
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := validation.IsAValidSchema(params.Context, apiKey); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	secret, err := r.apiKeyUseCase.Store(params.Context, apiKey)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// RevokeAPIKeyResolver revokes one of the authenticated user's API keys.
+func (r *Resolver) RevokeAPIKeyResolver(params graphql.ResolveParams) (interface{}, error) {
+	userID, err := keyManagerID(params.Context)
+	if err != nil {
+		return false, err
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	if err := r.apiKeyUseCase.Delete(params.Context, userID, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UserAPIKeysQueryResolver lists the API keys of the given user.
+func (r *Resolver) UserAPIKeysQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view api key", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(params.Args["UserID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	apiKeys, err := r.apiKeyUseCase.Fetch(params.Context, userID)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeUserAPIKeyResolver revokes an API key of the given user.
+func (r *Resolver) RevokeUserAPIKeyResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "revoke api key", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return false, domain.ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(params.Args["UserID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	if err := r.apiKeyUseCase.Delete(params.Context, userID, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// keyManagerID returns the authenticated user allowed to manage its API
+// keys. An API key cannot manage keys, it could otherwise create one with
+// more permissions than it has, and an admin impersonating the user could
+// keep acting as the user once the impersonation is over.
+func keyManagerID(ctx context.Context) (int64, error) {
+	if _, err := domain.SelfServiceClaims(ctx); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return 0, err
+	}
+
+	return currentUserID(ctx)
+}
@@ -0,0 +1,62 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var apiKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "APIKey",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"prefix": &graphql.Field{
+			Type: graphql.String,
+		},
+		"permissions": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"expires_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"last_used_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var apiKeySecretType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "APIKeySecret",
+	Description: "An API key with its value, which is only shown once",
+	Fields: graphql.Fields{
+		"api_key": &graphql.Field{
+			Type: apiKeyType,
+		},
+		"key": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var apiKeyInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "APIKeyInput",
+	Description: "API key payload for creating a new personal API key",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"permissions": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Description: "Names of the permissions of the key, a subset of the owner's",
+		},
+		"expires_at": &graphql.InputObjectFieldConfig{
+			Type: graphql.DateTime,
+		},
+	},
+})
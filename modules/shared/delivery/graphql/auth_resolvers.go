@@ -1,6 +1,8 @@
 package gql
 
 import (
+	"strconv"
+
 	"github.com/cyruzin/puppet_master/domain"
 	"github.com/cyruzin/puppet_master/pkg/validation"
 	"github.com/graphql-go/graphql"
@@ -20,19 +22,247 @@ func (r *Resolver) AuthQueryResolver(params graphql.ResolveParams) (interface{},
 		return nil, err
 	}
 
-	auth := &domain.AuthToken{Token: payload.Token, RefreshToken: payload.RefreshToken}
+	auth := &domain.AuthToken{
+		Token:        payload.Token,
+		RefreshToken: payload.RefreshToken,
+		MFARequired:  payload.MFARequired,
+		MFAToken:     payload.MFAToken,
+	}
 
 	return auth, nil
 }
 
+// AuthRefreshTokenResolver exchanges the given refresh token for a new token pair.
 func (r *Resolver) AuthRefreshTokenResolver(params graphql.ResolveParams) (interface{}, error) {
-	userID, ok := params.Args["UserID"].(int)
+	refreshToken, ok := params.Args["RefreshToken"].(string)
+	if !ok || refreshToken == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidRefreshToken.Error())
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	payload, err := r.authUseCase.RefreshToken(params.Context, refreshToken)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	auth := &domain.AuthToken{Token: payload.Token, RefreshToken: payload.RefreshToken}
+
+	return auth, nil
+}
+
+// AuthLogoutResolver revokes the current access token and its session.
+func (r *Resolver) AuthLogoutResolver(params graphql.ResolveParams) (interface{}, error) {
+	if err := r.authUseCase.Logout(params.Context); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthRevokeTokenResolver revokes the given access or refresh token.
+func (r *Resolver) AuthRevokeTokenResolver(params graphql.ResolveParams) (interface{}, error) {
+	token, ok := params.Args["Token"].(string)
+	if !ok || token == "" {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	if err := r.authUseCase.RevokeToken(params.Context, token); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthChangePasswordResolver changes the password of the authenticated user.
+func (r *Resolver) AuthChangePasswordResolver(params graphql.ResolveParams) (interface{}, error) {
+	oldPassword, ok := params.Args["OldPassword"].(string)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	newPassword, ok := params.Args["NewPassword"].(string)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	// The password policy is checked by the usecase, which knows the user.
+	if err := r.authUseCase.ChangePassword(params.Context, oldPassword, newPassword); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthRequestPasswordResetResolver emails a password reset link to the
+// given address. It succeeds whether or not the address is registered.
+func (r *Resolver) AuthRequestPasswordResetResolver(params graphql.ResolveParams) (interface{}, error) {
+	email, ok := params.Args["Email"].(string)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	if err := validation.IsAValidField(params.Context, email, "email", "required,email"); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	if err := r.authUseCase.RequestPasswordReset(params.Context, email); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthResetPasswordResolver sets a new password using a reset token.
+func (r *Resolver) AuthResetPasswordResolver(params graphql.ResolveParams) (interface{}, error) {
+	token, ok := params.Args["Token"].(string)
+	if !ok || token == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidResetToken.Error())
+		return false, domain.ErrInvalidResetToken
+	}
+
+	newPassword, ok := params.Args["NewPassword"].(string)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	// The password policy is checked by the usecase, which knows the user.
+	if err := r.authUseCase.ResetPassword(params.Context, token, newPassword); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthRequestEmailVerificationResolver emails a new verification link to
+// the given address. It succeeds whether or not the address is registered.
+func (r *Resolver) AuthRequestEmailVerificationResolver(params graphql.ResolveParams) (interface{}, error) {
+	email, ok := params.Args["Email"].(string)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	if err := validation.IsAValidField(params.Context, email, "email", "required,email"); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	if err := r.authUseCase.RequestEmailVerification(params.Context, email); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthVerifyEmailResolver verifies an email address.
+func (r *Resolver) AuthVerifyEmailResolver(params graphql.ResolveParams) (interface{}, error) {
+	token, ok := params.Args["Token"].(string)
+	if !ok || token == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidVerificationToken.Error())
+		return false, domain.ErrInvalidVerificationToken
+	}
+
+	if err := r.authUseCase.VerifyEmail(params.Context, token); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthRequestMagicLinkResolver emails a login link to the given address.
+// It succeeds whether or not the address is registered.
+func (r *Resolver) AuthRequestMagicLinkResolver(params graphql.ResolveParams) (interface{}, error) {
+	email, ok := params.Args["Email"].(string)
 	if !ok {
-		log.Error().Stack().Msg(domain.ErrUserID.Error())
-		return nil, domain.ErrUserID
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	if err := validation.IsAValidField(params.Context, email, "email", "required,email"); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	if err := r.authUseCase.RequestMagicLink(params.Context, email); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthConsumeMagicLinkResolver logs in with a login link.
+func (r *Resolver) AuthConsumeMagicLinkResolver(params graphql.ResolveParams) (interface{}, error) {
+	token, ok := params.Args["Token"].(string)
+	if !ok || token == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidMagicLink.Error())
+		return nil, domain.ErrInvalidMagicLink
+	}
+
+	payload, err := r.authUseCase.ConsumeMagicLink(params.Context, token)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	auth := &domain.AuthToken{
+		Token:        payload.Token,
+		RefreshToken: payload.RefreshToken,
+		MFARequired:  payload.MFARequired,
+		MFAToken:     payload.MFAToken,
+	}
+
+	return auth, nil
+}
+
+// AuthVerifyMFAResolver exchanges an MFA challenge token and a code for a token pair.
+func (r *Resolver) AuthVerifyMFAResolver(params graphql.ResolveParams) (interface{}, error) {
+	mfaToken, ok := params.Args["MFAToken"].(string)
+	if !ok || mfaToken == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidMFAToken.Error())
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	code, ok := params.Args["Code"].(string)
+	if !ok || code == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidMFACode.Error())
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	payload, err := r.authUseCase.VerifyMFA(params.Context, mfaToken, code)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	auth := &domain.AuthToken{Token: payload.Token, RefreshToken: payload.RefreshToken}
+
+	return auth, nil
+}
+
+// AuthPasskeyResolver logs in with a passkey.
+func (r *Resolver) AuthPasskeyResolver(params graphql.ResolveParams) (interface{}, error) {
+	credential, ok := params.Args["Credential"].(string)
+	if !ok || credential == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidPasskey.Error())
+		return nil, domain.ErrInvalidPasskey
 	}
 
-	payload, err := r.authUseCase.RefreshToken(params.Context, int64(userID))
+	payload, err := r.authUseCase.AuthenticateWithPasskey(params.Context, credential)
 	if err != nil {
 		log.Error().Stack().Msg(err.Error())
 		return nil, err
@@ -43,6 +273,49 @@ func (r *Resolver) AuthRefreshTokenResolver(params graphql.ResolveParams) (inter
 	return auth, nil
 }
 
+// AuthUnlockUserResolver clears the failed login lockout of the given user.
+func (r *Resolver) AuthUnlockUserResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "unlock user", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return false, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, domain.ErrIDParam
+	}
+
+	if err := r.authUseCase.UnlockUser(params.Context, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AuthImpersonateResolver issues a token to act as the given user.
+func (r *Resolver) AuthImpersonateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "impersonate user", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(params.Args["UserID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, domain.ErrIDParam
+	}
+
+	token, err := r.authUseCase.Impersonate(params.Context, userID)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return token, nil
+}
+
 func authValidation(params graphql.ResolveParams) (*domain.Auth, error) {
 	authParams, ok := params.Args["Credentials"].(map[string]interface{})
 	if !ok {
@@ -62,3 +335,28 @@ func authValidation(params graphql.ResolveParams) (*domain.Auth, error) {
 
 	return auth, nil
 }
+
+// AuthConsumeFederatedLoginResolver logs in with the token of a login
+// made with an external identity provider.
+func (r *Resolver) AuthConsumeFederatedLoginResolver(params graphql.ResolveParams) (interface{}, error) {
+	token, ok := params.Args["Token"].(string)
+	if !ok || token == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidFederatedLogin.Error())
+		return nil, domain.ErrInvalidFederatedLogin
+	}
+
+	payload, err := r.authUseCase.ConsumeFederatedLogin(params.Context, token)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	auth := &domain.AuthToken{
+		Token:        payload.Token,
+		RefreshToken: payload.RefreshToken,
+		MFARequired:  payload.MFARequired,
+		MFAToken:     payload.MFAToken,
+	}
+
+	return auth, nil
+}
@@ -13,6 +13,14 @@ var authType = graphql.NewObject(graphql.ObjectConfig{
 		"refresh_token": &graphql.Field{
 			Type: graphql.String,
 		},
+		"mfa_required": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "True when the login must be completed with VerifyMFA",
+		},
+		"mfa_token": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Challenge token to be sent to VerifyMFA",
+		},
 	},
 })
 
@@ -0,0 +1,180 @@
+package gql
+
+import (
+	"strconv"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// ClientsListQueryResolver for a list of OAuth2 clients.
+func (r *Resolver) ClientsListQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	clients, err := r.clientUseCase.Fetch(params.Context)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// ClientQueryResolver for a single OAuth2 client.
+func (r *Resolver) ClientQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	client, err := r.clientUseCase.GetByID(params.Context, id)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ClientCreateResolver creates a new OAuth2 client.
+func (r *Resolver) ClientCreateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "create client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	client, err := clientValidation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := r.clientUseCase.Store(params.Context, client)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// ClientUpdateResolver updates the given OAuth2 client.
+func (r *Resolver) ClientUpdateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "edit client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	client, err := clientValidation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.ID == 0 {
+		log.Error().Stack().Msg(domain.ErrIDParam.Error())
+		return nil, domain.ErrIDParam
+	}
+
+	client, err = r.clientUseCase.Update(params.Context, client)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ClientDeleteResolver deletes the given OAuth2 client.
+func (r *Resolver) ClientDeleteResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "delete client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	if err := r.clientUseCase.Delete(params.Context, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ClientRegenerateSecretResolver replaces the secret of the given client.
+func (r *Resolver) ClientRegenerateSecretResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "edit client", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	secret, err := r.clientUseCase.RegenerateSecret(params.Context, id)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func clientValidation(params graphql.ResolveParams) (*domain.Client, error) {
+	clientParams, ok := params.Args["Client"].(map[string]interface{})
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return nil, domain.ErrBadRequest
+	}
+
+	client := &domain.Client{
+		Name:   clientParams["name"].(string),
+		RoleID: int64(clientParams["role_id"].(int)),
+	}
+
+	if scopes, ok := clientParams["scopes"].(string); ok {
+		client.Scopes = scopes
+	}
+
+	if redirectURIs, ok := clientParams["redirect_uris"].(string); ok {
+		client.RedirectURIs = redirectURIs
+	}
+
+	if public, ok := clientParams["public"].(bool); ok {
+		client.Public = public
+	}
+
+	if id, ok := clientParams["id"].(string); ok && id != "" {
+		parsedID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			log.Error().Stack().Msg(err.Error())
+			return nil, err
+		}
+
+		client.ID = parsedID
+	}
+
+	if err := validation.IsAValidSchema(params.Context, client); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return client, nil
+}
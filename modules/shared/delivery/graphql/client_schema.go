@@ -0,0 +1,79 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var clientType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Client",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"client_id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"scopes": &graphql.Field{
+			Type: graphql.String,
+		},
+		"redirect_uris": &graphql.Field{
+			Type: graphql.String,
+		},
+		"public": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"role_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"updated_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var clientSecretType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "ClientSecret",
+	Description: "A client with its secret, which is only shown once",
+	Fields: graphql.Fields{
+		"client": &graphql.Field{
+			Type: clientType,
+		},
+		"client_secret": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var clientInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "ClientInput",
+	Description: "Client payload for creating a new OAuth2 client",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"id": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"scopes": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Space separated list of the scopes the client may ask for",
+		},
+		"redirect_uris": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Space separated list of the redirect URIs of a relying party",
+		},
+		"public": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Boolean,
+			Description: "Public clients, like browser apps, have no secret. Only set on creation",
+		},
+		"role_id": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+	},
+})
@@ -19,15 +19,100 @@ func (r *Resolver) queryFields() graphql.Fields {
 		},
 		"RefreshToken": &graphql.Field{
 			Type:        authType,
-			Description: "Refreshes the token",
+			Description: "Exchanges a refresh token for a new token pair",
 			Args: graphql.FieldConfigArgument{
-				"UserID": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.Int),
+				"RefreshToken": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
 				},
 			},
 			Resolve: r.AuthRefreshTokenResolver,
 		},
 
+		// Client
+		"FetchClients": &graphql.Field{
+			Type:        graphql.NewList(clientType),
+			Description: "Get a list of OAuth2 clients",
+			Resolve:     r.ClientsListQueryResolver,
+		},
+		"GetClient": &graphql.Field{
+			Type:        clientType,
+			Description: "Get a single OAuth2 client",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ClientQueryResolver,
+		},
+
+		// Passkey
+		"FetchPasskeys": &graphql.Field{
+			Type:        graphql.NewList(passkeyType),
+			Description: "Get the passkeys of the authenticated user",
+			Resolve:     r.PasskeysListQueryResolver,
+		},
+
+		// Session
+		"MySessions": &graphql.Field{
+			Type:        graphql.NewList(sessionType),
+			Description: "Get the signed in devices of the authenticated user",
+			Resolve:     r.MySessionsQueryResolver,
+		},
+		"UserSessions": &graphql.Field{
+			Type:        graphql.NewList(sessionType),
+			Description: "Get the signed in devices of the given user",
+			Args: graphql.FieldConfigArgument{
+				"UserID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.UserSessionsQueryResolver,
+		},
+
+		// API key
+		"MyAPIKeys": &graphql.Field{
+			Type:        graphql.NewList(apiKeyType),
+			Description: "Get the API keys of the authenticated user",
+			Resolve:     r.MyAPIKeysQueryResolver,
+		},
+		"UserAPIKeys": &graphql.Field{
+			Type:        graphql.NewList(apiKeyType),
+			Description: "Get the API keys of the given user",
+			Args: graphql.FieldConfigArgument{
+				"UserID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.UserAPIKeysQueryResolver,
+		},
+
+		// Service account
+		"FetchServiceAccounts": &graphql.Field{
+			Type:        graphql.NewList(serviceAccountType),
+			Description: "Get a list of service accounts",
+			Resolve:     r.ServiceAccountsListQueryResolver,
+		},
+		"GetServiceAccount": &graphql.Field{
+			Type:        serviceAccountType,
+			Description: "Get a single service account",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ServiceAccountQueryResolver,
+		},
+		"ServiceAccountCredentials": &graphql.Field{
+			Type:        graphql.NewList(serviceAccountCredentialType),
+			Description: "Get the credentials of a service account",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ServiceAccountCredentialsQueryResolver,
+		},
+
 		// Permission
 		"FetchPermissions": &graphql.Field{
 			Type:        graphql.NewList(permissionType),
@@ -115,6 +200,387 @@ func (r *Resolver) queryFields() graphql.Fields {
 
 func (r *Resolver) mutationFields() graphql.Fields {
 	fields := graphql.Fields{
+		// Auth
+		"Logout": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revokes the current access token and its session",
+			Resolve:     r.AuthLogoutResolver,
+		},
+		"RevokeToken": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revokes the given access or refresh token",
+			Args: graphql.FieldConfigArgument{
+				"Token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthRevokeTokenResolver,
+		},
+		"ChangePassword": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Changes the password of the authenticated user and logs out the other sessions",
+			Args: graphql.FieldConfigArgument{
+				"OldPassword": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"NewPassword": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthChangePasswordResolver,
+		},
+		"RequestPasswordReset": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails a password reset link if the address belongs to a user",
+			Args: graphql.FieldConfigArgument{
+				"Email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthRequestPasswordResetResolver,
+		},
+		"ResetPassword": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Sets a new password with a password reset token and logs out every session",
+			Args: graphql.FieldConfigArgument{
+				"Token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"NewPassword": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthResetPasswordResolver,
+		},
+		"RequestEmailVerification": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails a new verification link if the address belongs to an unverified user",
+			Args: graphql.FieldConfigArgument{
+				"Email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthRequestEmailVerificationResolver,
+		},
+		"VerifyEmail": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Verifies an email address with the token of the verification link",
+			Args: graphql.FieldConfigArgument{
+				"Token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthVerifyEmailResolver,
+		},
+		"RequestMagicLink": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails a single use login link if the address belongs to a user",
+			Args: graphql.FieldConfigArgument{
+				"Email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthRequestMagicLinkResolver,
+		},
+		"ConsumeMagicLink": &graphql.Field{
+			Type:        authType,
+			Description: "Logs in with the token of a login link",
+			Args: graphql.FieldConfigArgument{
+				"Token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthConsumeMagicLinkResolver,
+		},
+		"ConsumeFederatedLogin": &graphql.Field{
+			Type:        authType,
+			Description: "Logs in with the token of a login made with an external identity provider",
+			Args: graphql.FieldConfigArgument{
+				"Token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthConsumeFederatedLoginResolver,
+		},
+		"VerifyMFA": &graphql.Field{
+			Type:        authType,
+			Description: "Completes a login that requires multi-factor authentication",
+			Args: graphql.FieldConfigArgument{
+				"MFAToken": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"Code": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "TOTP or recovery code",
+				},
+			},
+			Resolve: r.AuthVerifyMFAResolver,
+		},
+		"UnlockUser": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Lifts the failed login lockout of the given user",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthUnlockUserResolver,
+		},
+		"Impersonate": &graphql.Field{
+			Type:        authType,
+			Description: "Issues a short-lived token to act as the given user, the admin is named in its act claim",
+			Args: graphql.FieldConfigArgument{
+				"UserID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthImpersonateResolver,
+		},
+
+		// Client
+		"CreateClient": &graphql.Field{
+			Type:        clientSecretType,
+			Description: "Creates an OAuth2 client and returns its secret",
+			Args: graphql.FieldConfigArgument{
+				"Client": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(clientInput),
+				},
+			},
+			Resolve: r.ClientCreateResolver,
+		},
+		"UpdateClient": &graphql.Field{
+			Type:        clientType,
+			Description: "Updates an OAuth2 client and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"Client": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(clientInput),
+				},
+			},
+			Resolve: r.ClientUpdateResolver,
+		},
+		"DeleteClient": &graphql.Field{
+			Type:        clientType,
+			Description: "Deletes an OAuth2 client and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ClientDeleteResolver,
+		},
+		"RegenerateClientSecret": &graphql.Field{
+			Type:        clientSecretType,
+			Description: "Replaces the secret of an OAuth2 client and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ClientRegenerateSecretResolver,
+		},
+
+		// MFA
+		"EnrollMFA": &graphql.Field{
+			Type:        mfaEnrollmentType,
+			Description: "Starts the TOTP enrollment of the authenticated user",
+			Resolve:     r.MFAEnrollResolver,
+		},
+		"ConfirmMFA": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Enables TOTP with a code from the authenticator app and returns the recovery codes",
+			Args: graphql.FieldConfigArgument{
+				"Code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.MFAConfirmResolver,
+		},
+		"DisableMFA": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Disables TOTP with a TOTP or recovery code",
+			Args: graphql.FieldConfigArgument{
+				"Code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.MFADisableResolver,
+		},
+		"RegenerateRecoveryCodes": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Replaces the recovery codes with a TOTP code",
+			Args: graphql.FieldConfigArgument{
+				"Code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.MFARegenerateRecoveryCodesResolver,
+		},
+
+		// Passkey
+		"BeginPasskeyRegistration": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Returns the JSON options for navigator.credentials.create()",
+			Resolve:     r.PasskeyBeginRegistrationResolver,
+		},
+		"FinishPasskeyRegistration": &graphql.Field{
+			Type:        passkeyType,
+			Description: "Registers a passkey from the JSON serialized navigator.credentials.create() response",
+			Args: graphql.FieldConfigArgument{
+				"Credential": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"Name": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: r.PasskeyFinishRegistrationResolver,
+		},
+		"BeginPasskeyLogin": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Returns the JSON options for navigator.credentials.get(). Without an email any discoverable passkey can be used",
+			Args: graphql.FieldConfigArgument{
+				"Email": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: r.PasskeyBeginLoginResolver,
+		},
+		"AuthenticateWithPasskey": &graphql.Field{
+			Type:        authType,
+			Description: "Logs in with the JSON serialized navigator.credentials.get() response",
+			Args: graphql.FieldConfigArgument{
+				"Credential": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.AuthPasskeyResolver,
+		},
+		"DeletePasskey": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Deletes a passkey of the authenticated user",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.PasskeyDeleteResolver,
+		},
+
+		// Session
+		"RevokeSession": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Signs out one of the authenticated user's devices",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.RevokeSessionResolver,
+		},
+		"RevokeUserSession": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Signs out one device of the given user, or all of them when ID is omitted",
+			Args: graphql.FieldConfigArgument{
+				"UserID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: r.RevokeUserSessionResolver,
+		},
+
+		// API key
+		"CreateAPIKey": &graphql.Field{
+			Type:        apiKeySecretType,
+			Description: "Creates an API key for the authenticated user and returns its value",
+			Args: graphql.FieldConfigArgument{
+				"APIKey": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(apiKeyInput),
+				},
+			},
+			Resolve: r.APIKeyCreateResolver,
+		},
+		"RevokeAPIKey": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revokes one of the authenticated user's API keys",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.RevokeAPIKeyResolver,
+		},
+		"RevokeUserAPIKey": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revokes an API key of the given user",
+			Args: graphql.FieldConfigArgument{
+				"UserID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.RevokeUserAPIKeyResolver,
+		},
+
+		// Service account
+		"CreateServiceAccount": &graphql.Field{
+			Type:        serviceAccountType,
+			Description: "Creates a service account",
+			Args: graphql.FieldConfigArgument{
+				"ServiceAccount": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(serviceAccountInput),
+				},
+			},
+			Resolve: r.ServiceAccountCreateResolver,
+		},
+		"UpdateServiceAccount": &graphql.Field{
+			Type:        serviceAccountType,
+			Description: "Updates a service account and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"ServiceAccount": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(serviceAccountInput),
+				},
+			},
+			Resolve: r.ServiceAccountUpdateResolver,
+		},
+		"DeleteServiceAccount": &graphql.Field{
+			Type:        serviceAccountType,
+			Description: "Deletes a service account and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ServiceAccountDeleteResolver,
+		},
+		"CreateServiceAccountCredential": &graphql.Field{
+			Type:        serviceAccountSecretType,
+			Description: "Creates a credential for a service account and returns its secret",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ServiceAccountCredentialCreateResolver,
+		},
+		"DeleteServiceAccountCredential": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Deletes a credential of a service account and revokes its tokens",
+			Args: graphql.FieldConfigArgument{
+				"ID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"CredentialID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: r.ServiceAccountCredentialDeleteResolver,
+		},
+
 		// Permission
 		"CreatePermission": &graphql.Field{
 			Type: permissionType,
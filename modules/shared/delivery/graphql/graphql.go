@@ -17,6 +17,12 @@ type Resolver struct {
 	permissionUseCase domain.PermissionUsecase
 	roleUseCase       domain.RoleUsecase
 	userUseCase       domain.UserUsecase
+	mfaUseCase        domain.MFAUsecase
+	passkeyUseCase    domain.PasskeyUsecase
+	clientUseCase     domain.ClientUsecase
+	apiKeyUseCase     domain.APIKeyUsecase
+
+	serviceAccountUseCase domain.ServiceAccountUsecase
 }
 
 func NewRoot(
@@ -24,12 +30,23 @@ func NewRoot(
 	permission domain.PermissionUsecase,
 	role domain.RoleUsecase,
 	user domain.UserUsecase,
+	mfa domain.MFAUsecase,
+	passkey domain.PasskeyUsecase,
+	client domain.ClientUsecase,
+	apiKey domain.APIKeyUsecase,
+	serviceAccount domain.ServiceAccountUsecase,
 ) *Root {
 	resolver := Resolver{
 		authUseCase:       auth,
 		permissionUseCase: permission,
 		roleUseCase:       role,
 		userUseCase:       user,
+		mfaUseCase:        mfa,
+		passkeyUseCase:    passkey,
+		clientUseCase:     client,
+		apiKeyUseCase:     apiKey,
+
+		serviceAccountUseCase: serviceAccount,
 	}
 	root := Root{
 		Query: graphql.NewObject(graphql.ObjectConfig{
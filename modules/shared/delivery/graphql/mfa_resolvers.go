@@ -0,0 +1,75 @@
+package gql
+
+import (
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// MFAEnrollResolver starts the TOTP enrollment of the authenticated user.
+func (r *Resolver) MFAEnrollResolver(params graphql.ResolveParams) (interface{}, error) {
+	enrollment, err := r.mfaUseCase.Enroll(params.Context)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return enrollment, nil
+}
+
+// MFAConfirmResolver enables TOTP and returns the recovery codes.
+func (r *Resolver) MFAConfirmResolver(params graphql.ResolveParams) (interface{}, error) {
+	code, err := mfaCode(params)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := r.mfaUseCase.Confirm(params.Context, code)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// MFADisableResolver disables TOTP for the authenticated user.
+func (r *Resolver) MFADisableResolver(params graphql.ResolveParams) (interface{}, error) {
+	code, err := mfaCode(params)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.mfaUseCase.Disable(params.Context, code); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MFARegenerateRecoveryCodesResolver replaces the recovery codes.
+func (r *Resolver) MFARegenerateRecoveryCodesResolver(params graphql.ResolveParams) (interface{}, error) {
+	code, err := mfaCode(params)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := r.mfaUseCase.RegenerateRecoveryCodes(params.Context, code)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func mfaCode(params graphql.ResolveParams) (string, error) {
+	code, ok := params.Args["Code"].(string)
+	if !ok || code == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidMFACode.Error())
+		return "", domain.ErrInvalidMFACode
+	}
+
+	return code, nil
+}
@@ -0,0 +1,19 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var mfaEnrollmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MFAEnrollment",
+	Fields: graphql.Fields{
+		"secret": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Base32 secret for manual entry",
+		},
+		"uri": &graphql.Field{
+			Type:        graphql.String,
+			Description: "otpauth:// provisioning URI, usually shown as a QR code",
+		},
+	},
+})
@@ -2,19 +2,26 @@ package middleware
 
 import (
 	"context"
-	"errors"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/cyruzin/puppet_master/domain"
 	"github.com/cyruzin/puppet_master/pkg/enc"
-	"github.com/lestrrat-go/jwx/jwa"
-	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
 )
 
+// Middleware holds the dependencies shared by the http middlewares.
+type Middleware struct {
+	authUseCase domain.AuthUsecase
+}
+
+// NewMiddleware will create a new Middleware.
+func NewMiddleware(auth domain.AuthUsecase) *Middleware {
+	return &Middleware{authUseCase: auth}
+}
+
 // LoggerMiddleware logs the details of all requests.
 func LoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,48 +41,48 @@ func LoggerMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// TokenMiddleware checks if the request contains Bearer Token on the
-// headers and if it is valid.
-func TokenMiddleware(next http.Handler) http.Handler {
+// ClientMiddleware puts the client IP address and User-Agent in the
+// request context.
+func ClientMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		refreshTokenHeader := r.Header.Get("X-Refresh-Token")
+		ip := r.RemoteAddr
 
-		if r.Header.Get(refreshTokenHeader) != "" {
-			if refreshTokenHeader == "" {
-				ctx := context.WithValue(r.Context(), domain.ContextKeyID, "")
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
-			}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = host
+		}
 
-			// Checking if the header contains Bearer string and if the token exists.
-			if !strings.Contains(refreshTokenHeader, "Bearer") || len(strings.Split(refreshTokenHeader, "Bearer ")) == 1 {
-				enc.EncodeErrorGraphql(w, r, errors.New("malformed token"))
-				return
-			}
+		ctx := context.WithValue(r.Context(), domain.ContextKeyClientIP, ip)
+		ctx = context.WithValue(ctx, domain.ContextKeyUserAgent, r.UserAgent())
 
-			// Capturing the refresh token.
-			jwtString := strings.Split(refreshTokenHeader, "Bearer ")[1]
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-			// Parsing the refresh token to verify its authenticity.
-			token, err := jwt.ParseString(jwtString, jwt.WithVerify(jwa.HS256, []byte(viper.GetString(`jwt.secret`))))
+// TokenMiddleware checks if the request contains Bearer Token on the
+// headers, if it is valid and if it has not been revoked. Personal API
+// keys are accepted under the ApiKey scheme. The admin behind an
+// impersonation token is put in the context next to the user.
+func (m *Middleware) TokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			claims, err := m.authUseCase.ParseAPIKey(r.Context(), strings.TrimPrefix(authHeader, "ApiKey "))
 			if err != nil {
 				enc.EncodeErrorGraphql(w, r, err)
 				return
 			}
 
-			// Validating the content.
-			if err := jwt.Validate(token); err != nil {
-				enc.EncodeErrorGraphql(w, r, errors.New("invalid token"))
-				return
-			}
+			ctx := context.WithValue(r.Context(), domain.ContextKeyID, claims.User)
+			ctx = context.WithValue(ctx, domain.ContextKeyClaims, claims)
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		authHeader := r.Header.Get("Authorization")
-
-		if authHeader == "" {
+		// Other schemes, like the HTTP Basic authentication of OAuth2
+		// clients, are left to the handlers.
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer") {
 			ctx := context.WithValue(r.Context(), domain.ContextKeyID, "")
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
@@ -83,33 +90,33 @@ func TokenMiddleware(next http.Handler) http.Handler {
 
 		// Checking if the header contains Bearer string and if the token exists.
 		if !strings.Contains(authHeader, "Bearer") || len(strings.Split(authHeader, "Bearer ")) == 1 {
-			enc.EncodeErrorGraphql(w, r, errors.New("malformed token"))
+			enc.EncodeErrorGraphql(w, r, domain.ErrInvalidToken)
 			return
 		}
 
 		// Capturing the token.
 		jwtString := strings.Split(authHeader, "Bearer ")[1]
 
-		// Parsing the token to verify its authenticity.
-		token, err := jwt.ParseString(jwtString, jwt.WithVerify(jwa.HS256, []byte(viper.GetString(`jwt.secret`))))
+		// Verifying its authenticity and checking the revocation denylist.
+		claims, err := m.authUseCase.ParseToken(r.Context(), jwtString)
 		if err != nil {
 			enc.EncodeErrorGraphql(w, r, err)
 			return
 		}
 
-		// Validating the content.
-		if err := jwt.Validate(token); err != nil {
-			enc.EncodeErrorGraphql(w, r, errors.New("invalid token"))
-			return
-		}
+		ctx := context.WithValue(r.Context(), domain.ContextKeyID, claims.User)
+		ctx = context.WithValue(ctx, domain.ContextKeyClaims, claims)
 
-		userInfo, ok := token.PrivateClaims()["user"].(map[string]interface{})
-		if !ok {
-			enc.EncodeErrorGraphql(w, r, errors.New("failed to retrieve private claims"))
-			return
-		}
+		if claims.Actor != nil {
+			ctx = context.WithValue(ctx, domain.ContextKeyActor, claims.Actor)
 
-		ctx := context.WithValue(r.Context(), domain.ContextKeyID, userInfo)
+			log.Info().
+				Str("event", "impersonated_request").
+				Interface("actor_id", claims.Actor["user_id"]).
+				Interface("user_id", claims.User["user_id"]).
+				Str("url", r.URL.String()).
+				Msg("request made while impersonating a user")
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
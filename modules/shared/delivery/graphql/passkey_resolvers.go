@@ -0,0 +1,79 @@
+package gql
+
+import (
+	"strconv"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// PasskeysListQueryResolver lists the passkeys of the authenticated user.
+func (r *Resolver) PasskeysListQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	passkeys, err := r.passkeyUseCase.Fetch(params.Context)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// PasskeyBeginRegistrationResolver starts a passkey registration.
+func (r *Resolver) PasskeyBeginRegistrationResolver(params graphql.ResolveParams) (interface{}, error) {
+	options, err := r.passkeyUseCase.BeginRegistration(params.Context)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// PasskeyFinishRegistrationResolver registers the created passkey.
+func (r *Resolver) PasskeyFinishRegistrationResolver(params graphql.ResolveParams) (interface{}, error) {
+	credential, ok := params.Args["Credential"].(string)
+	if !ok || credential == "" {
+		log.Error().Stack().Msg(domain.ErrInvalidPasskey.Error())
+		return nil, domain.ErrInvalidPasskey
+	}
+
+	name, _ := params.Args["Name"].(string)
+
+	passkey, err := r.passkeyUseCase.FinishRegistration(params.Context, name, credential)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// PasskeyBeginLoginResolver starts a passkey login.
+func (r *Resolver) PasskeyBeginLoginResolver(params graphql.ResolveParams) (interface{}, error) {
+	email, _ := params.Args["Email"].(string)
+
+	options, err := r.passkeyUseCase.BeginLogin(params.Context, email)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// PasskeyDeleteResolver deletes a passkey of the authenticated user.
+func (r *Resolver) PasskeyDeleteResolver(params graphql.ResolveParams) (interface{}, error) {
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, domain.ErrIDParam
+	}
+
+	if err := r.passkeyUseCase.Delete(params.Context, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,23 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var passkeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Passkey",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"last_used_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
@@ -0,0 +1,237 @@
+package gql
+
+import (
+	"strconv"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/cyruzin/puppet_master/pkg/validation"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// ServiceAccountsListQueryResolver for a list of service accounts.
+func (r *Resolver) ServiceAccountsListQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	serviceAccounts, err := r.serviceAccountUseCase.Fetch(params.Context)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccounts, nil
+}
+
+// ServiceAccountQueryResolver for a single service account.
+func (r *Resolver) ServiceAccountQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	serviceAccount, err := r.serviceAccountUseCase.GetByID(params.Context, id)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+// ServiceAccountCredentialsQueryResolver for the credentials of a
+// service account.
+func (r *Resolver) ServiceAccountCredentialsQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	credentials, err := r.serviceAccountUseCase.FetchCredentials(params.Context, id)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// ServiceAccountCreateResolver creates a new service account.
+func (r *Resolver) ServiceAccountCreateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "create service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	serviceAccount, err := serviceAccountValidation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceAccount, err = r.serviceAccountUseCase.Store(params.Context, serviceAccount)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+// ServiceAccountUpdateResolver updates the given service account.
+func (r *Resolver) ServiceAccountUpdateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "edit service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	serviceAccount, err := serviceAccountValidation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if serviceAccount.ID == 0 {
+		log.Error().Stack().Msg(domain.ErrIDParam.Error())
+		return nil, domain.ErrIDParam
+	}
+
+	serviceAccount, err = r.serviceAccountUseCase.Update(params.Context, serviceAccount)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+// ServiceAccountDeleteResolver deletes the given service account.
+func (r *Resolver) ServiceAccountDeleteResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "delete service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	if err := r.serviceAccountUseCase.Delete(params.Context, id); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ServiceAccountCredentialCreateResolver creates a credential for the
+// given service account.
+func (r *Resolver) ServiceAccountCredentialCreateResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "edit service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	secret, err := r.serviceAccountUseCase.CreateCredential(params.Context, id)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// ServiceAccountCredentialDeleteResolver deletes a credential of the
+// given service account.
+func (r *Resolver) ServiceAccountCredentialDeleteResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "edit service account", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	id, err := strconv.ParseInt(params.Args["ID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	credentialID, err := strconv.ParseInt(params.Args["CredentialID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	if err := r.serviceAccountUseCase.DeleteCredential(params.Context, id, credentialID); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func serviceAccountValidation(params graphql.ResolveParams) (*domain.ServiceAccount, error) {
+	serviceAccountParams, ok := params.Args["ServiceAccount"].(map[string]interface{})
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return nil, domain.ErrBadRequest
+	}
+
+	serviceAccount := &domain.ServiceAccount{
+		Name:   serviceAccountParams["name"].(string),
+		RoleID: int64(serviceAccountParams["role_id"].(int)),
+	}
+
+	if description, ok := serviceAccountParams["description"].(string); ok {
+		serviceAccount.Description = description
+	}
+
+	if id, ok := serviceAccountParams["id"].(string); ok && id != "" {
+		parsedID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			log.Error().Stack().Msg(err.Error())
+			return nil, err
+		}
+
+		serviceAccount.ID = parsedID
+	}
+
+	// A new service account belongs to its creator unless told
+	// otherwise, an updated one keeps its owner.
+	if ownerID, ok := serviceAccountParams["owner_id"].(int); ok {
+		serviceAccount.OwnerID = int64(ownerID)
+	} else if serviceAccount.ID == 0 {
+		userID, err := currentUserID(params.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		serviceAccount.OwnerID = userID
+	}
+
+	if err := validation.IsAValidSchema(params.Context, serviceAccount); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
@@ -0,0 +1,89 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var serviceAccountType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ServiceAccount",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"owner_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"role_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"updated_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var serviceAccountCredentialType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ServiceAccountCredential",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"service_account_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"client_id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"last_used_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var serviceAccountSecretType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "ServiceAccountSecret",
+	Description: "A service account credential with its secret, which is only shown once",
+	Fields: graphql.Fields{
+		"credential": &graphql.Field{
+			Type: serviceAccountCredentialType,
+		},
+		"client_secret": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var serviceAccountInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "ServiceAccountInput",
+	Description: "Service account payload for creating a new service account",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"id": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"description": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"owner_id": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Int,
+			Description: "The user responsible for the service account, the authenticated user by default on creation",
+		},
+		"role_id": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+	},
+})
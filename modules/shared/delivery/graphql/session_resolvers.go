@@ -0,0 +1,116 @@
+package gql
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+)
+
+// MySessionsQueryResolver lists the sessions of the authenticated user.
+func (r *Resolver) MySessionsQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	userID, err := currentUserID(params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := r.authUseCase.FetchSessions(params.Context, userID)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSessionResolver signs out one of the authenticated user's devices.
+func (r *Resolver) RevokeSessionResolver(params graphql.ResolveParams) (interface{}, error) {
+	userID, err := currentUserID(params.Context)
+	if err != nil {
+		return false, err
+	}
+
+	sessionID, ok := params.Args["ID"].(string)
+	if !ok || sessionID == "" {
+		log.Error().Stack().Msg(domain.ErrBadRequest.Error())
+		return false, domain.ErrBadRequest
+	}
+
+	if err := r.authUseCase.RevokeSession(params.Context, userID, sessionID); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UserSessionsQueryResolver lists the sessions of the given user.
+func (r *Resolver) UserSessionsQueryResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "view session", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return nil, domain.ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(params.Args["UserID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	sessions, err := r.authUseCase.FetchSessions(params.Context, userID)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSessionResolver signs out one device of the given user, or
+// every device when no session ID is given.
+func (r *Resolver) RevokeUserSessionResolver(params graphql.ResolveParams) (interface{}, error) {
+	if allow := r.authUseCase.Authorize(params.Context, "revoke session", nil); !allow {
+		log.Error().Err(domain.ErrUnauthorized).Stack().Msg(domain.ErrUnauthorized.Error())
+		return false, domain.ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(params.Args["UserID"].(string), 10, 64)
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	sessionID, _ := params.Args["ID"].(string)
+
+	if sessionID == "" {
+		err = r.authUseCase.RevokeSessions(params.Context, userID)
+	} else {
+		err = r.authUseCase.RevokeSession(params.Context, userID, sessionID)
+	}
+
+	if err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// currentUserID returns the ID of the authenticated user.
+func currentUserID(ctx context.Context) (int64, error) {
+	claims, ok := ctx.Value(domain.ContextKeyClaims).(*domain.TokenClaims)
+	if !ok {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return 0, domain.ErrUnauthorized
+	}
+
+	userID, ok := claims.User["user_id"].(float64)
+	if !ok || userID == 0 {
+		log.Error().Stack().Msg(domain.ErrUnauthorized.Error())
+		return 0, domain.ErrUnauthorized
+	}
+
+	return int64(userID), nil
+}
@@ -0,0 +1,32 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+var sessionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Session",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"user_agent": &graphql.Field{
+			Type: graphql.String,
+		},
+		"ip": &graphql.Field{
+			Type: graphql.String,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"last_seen_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"expires_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"current": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+	},
+})
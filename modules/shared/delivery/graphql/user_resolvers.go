@@ -1,6 +1,7 @@
 package gql
 
 import (
+	"context"
 	"strconv"
 	"time"
 
@@ -73,6 +74,12 @@ func (r *Resolver) UserCreateResolver(params graphql.ResolveParams) (interface{}
 		return nil, err
 	}
 
+	// The user is created anyway, the link can be sent again with
+	// RequestEmailVerification.
+	if err := r.authUseCase.SendEmailVerification(params.Context, user.ID); err != nil {
+		log.Error().Stack().Msg(err.Error())
+	}
+
 	return user, nil
 }
 
@@ -131,12 +138,6 @@ func storeUserValidation(params graphql.ResolveParams) (*domain.User, error) {
 		password = userParams["password"].(string)
 	}
 
-	err := validation.IsAValidField(params.Context, password, "password", "required,gte=8")
-	if err != nil {
-		log.Error().Stack().Msg(err.Error())
-		return nil, err
-	}
-
 	user := &domain.User{
 		Name:      userParams["name"].(string),
 		Email:     userParams["email"].(string),
@@ -150,7 +151,12 @@ func storeUserValidation(params graphql.ResolveParams) (*domain.User, error) {
 		return nil, err
 	}
 
-	hashedPassword, err := crypto.HashPassword(password, 6)
+	if err := passwordValidation(params.Context, password, user.Name, user.Email); err != nil {
+		log.Error().Stack().Msg(err.Error())
+		return nil, err
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
 	if err != nil {
 		log.Error().Stack().Msg(err.Error())
 		return nil, err
@@ -188,3 +194,9 @@ func updateUserValidation(params graphql.ResolveParams) (*domain.User, error) {
 
 	return user, nil
 }
+
+// passwordValidation checks the password policy. The name and email of
+// the user are checked as well when they are known.
+func passwordValidation(ctx context.Context, password string, userInfo ...string) error {
+	return validation.IsAValidPassword(ctx, password, userInfo...)
+}
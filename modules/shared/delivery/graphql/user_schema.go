@@ -22,6 +22,12 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 		"updated_at": &graphql.Field{
 			Type: graphql.DateTime,
 		},
+		"email_verified_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"disabled_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
 	},
 })
 
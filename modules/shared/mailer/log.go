@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+)
+
+type logMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewLogMailer will create an object that represent the domain.Mailer
+// interface for local development and tests. Mails are appended as JSON
+// lines to the given file, or logged when path is empty.
+func NewLogMailer(path string) domain.Mailer {
+	return &logMailer{path: path}
+}
+
+func (l *logMailer) Send(ctx context.Context, mail *domain.Mail) error {
+	if l.path == "" {
+		log.Info().
+			Str("to", mail.To).
+			Str("subject", mail.Subject).
+			Str("body", mail.Body).
+			Msg("mail sent")
+
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(domain.ErrSendMail.Error())
+		return domain.ErrSendMail
+	}
+
+	defer file.Close()
+
+	entry := struct {
+		*domain.Mail
+		SentAt time.Time `json:"sent_at"`
+	}{mail, time.Now()}
+
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		log.Error().Stack().Err(err).Msg(domain.ErrSendMail.Error())
+		return domain.ErrSendMail
+	}
+
+	return nil
+}
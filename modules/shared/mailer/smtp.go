@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/cyruzin/puppet_master/domain"
+	"github.com/rs/zerolog/log"
+)
+
+type smtpMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPMailer will create an object that represent the domain.Mailer
+// interface delivering through the given SMTP server.
+func NewSMTPMailer(host, port, username, password, from string) domain.Mailer {
+	var auth smtp.Auth
+
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpMailer{
+		address: net.JoinHostPort(host, port),
+		auth:    auth,
+		from:    from,
+	}
+}
+
+func (s *smtpMailer) Send(ctx context.Context, mail *domain.Mail) error {
+	var message bytes.Buffer
+
+	fmt.Fprintf(&message, "From: %s\r\n", s.from)
+	fmt.Fprintf(&message, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mail.Subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(mail.Body)
+
+	if err := smtp.SendMail(s.address, s.auth, s.from, []string{mail.To}, message.Bytes()); err != nil {
+		log.Error().Stack().Err(err).Msg(domain.ErrSendMail.Error())
+		return domain.ErrSendMail
+	}
+
+	return nil
+}
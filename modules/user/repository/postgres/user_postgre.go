@@ -3,6 +3,7 @@ package postgre
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/cyruzin/puppet_master/domain"
 	"github.com/jmoiron/sqlx"
@@ -29,11 +30,11 @@ func NewPostgreUserRepository(
 }
 
 func (p *postgreRepository) Fetch(ctx context.Context) ([]*domain.User, error) {
-	query := `SELECT * FROM users`
+	query := `SELECT * FROM users ORDER BY id`
 
 	users := []*domain.User{}
 
-	err := p.Conn.SelectContext(ctx, users, query)
+	err := p.Conn.SelectContext(ctx, &users, query)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error().Stack().Err(err).Msg(err.Error())
 		return nil, domain.ErrFetchError
@@ -42,6 +43,38 @@ func (p *postgreRepository) Fetch(ctx context.Context) ([]*domain.User, error) {
 	return users, nil
 }
 
+// FetchPage returns a page of the users ordered by ID, only the one with
+// the email, ignoring case, when an email is given, and the number of
+// users of every page.
+func (p *postgreRepository) FetchPage(
+	ctx context.Context,
+	email string,
+	offset,
+	limit int,
+) ([]*domain.User, int, error) {
+	where := `WHERE $1 = '' OR LOWER(email) = LOWER($1)`
+
+	total := 0
+
+	err := p.Conn.GetContext(ctx, &total, `SELECT COUNT(*) FROM users `+where, email)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, 0, domain.ErrFetchError
+	}
+
+	query := `SELECT * FROM users ` + where + ` ORDER BY id LIMIT $2 OFFSET $3`
+
+	users := []*domain.User{}
+
+	err = p.Conn.SelectContext(ctx, &users, query, email, limit, offset)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, 0, domain.ErrFetchError
+	}
+
+	return users, total, nil
+}
+
 func (p *postgreRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	query := `SELECT * FROM users WHERE id = $1`
 
@@ -100,6 +133,14 @@ func (p *postgreRepository) Store(ctx context.Context, user *domain.User) (*doma
 		return nil, domain.ErrStoreError
 	}
 
+	query = "INSERT INTO password_history (user_id, password, created_at) VALUES ($1, $2, $3)"
+
+	_, err = tx.ExecContext(ctx, query, lastID, user.Password, user.CreatedAt)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return nil, domain.ErrStoreError
+	}
+
 	tx.Commit()
 
 	newUser, err := p.GetByID(ctx, lastID)
@@ -131,7 +172,8 @@ func (p *postgreRepository) Update(ctx context.Context, user *domain.User) (*dom
 		SET 
 		name = $1, 
 		email = $2, 
-		updated_at = $3
+		updated_at = $3,
+		email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
 		WHERE id = $4
 	`
 	result, err := tx.ExecContext(
@@ -203,3 +245,26 @@ func (p *postgreRepository) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+// SetDisabledAt disables the user, or enables it again with a nil time.
+func (p *postgreRepository) SetDisabledAt(ctx context.Context, id int64, disabledAt *time.Time) error {
+	query := "UPDATE users SET disabled_at = $1, updated_at = $2 WHERE id = $3"
+
+	result, err := p.Conn.ExecContext(ctx, query, disabledAt, time.Now(), id)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return domain.ErrUpdateError
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
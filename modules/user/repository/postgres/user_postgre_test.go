@@ -1,5 +1,40 @@
 package postgre_test
 
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	postgreRepository "github.com/cyruzin/puppet_master/modules/user/repository/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE $1 = '' OR LOWER(email) = LOWER($1)")).
+		WithArgs("Homer@Simpsons.org").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY id LIMIT $2 OFFSET $3")).
+		WithArgs("Homer@Simpsons.org", 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(2, "Homer Simpson", "homer@simpsons.org"))
+
+	userRepo := postgreRepository.NewPostgreUserRepository(sqlx.NewDb(db, "sqlmock"), nil, nil)
+
+	users, total, err := userRepo.FetchPage(context.Background(), "Homer@Simpsons.org", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, users, 1)
+	assert.Equal(t, int64(2), users[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // import (
 // 	"context"
 // 	"regexp"
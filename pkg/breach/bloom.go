@@ -0,0 +1,141 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+)
+
+const bloomMagic = "PMBLOOM1"
+
+// BloomFilter is a compact, in-memory form of a corpus. It never misses
+// a breached password but reports a few other passwords as breached, at
+// the false positive rate it was built with.
+type BloomFilter struct {
+	k    uint32
+	bits []uint64
+}
+
+// NewBloomFilter sizes a filter for n hashes at the given false positive
+// rate.
+func NewBloomFilter(n uint64, falsePositiveRate float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+
+	if k == 0 {
+		k = 1
+	}
+
+	return &BloomFilter{k: k, bits: make([]uint64, (m+63)/64)}
+}
+
+// BuildBloomFilter reads HASH:COUNT lines into a filter sized for n
+// hashes. The lines do not need to be ordered.
+func BuildBloomFilter(r io.Reader, n uint64, falsePositiveRate float64) (*BloomFilter, error) {
+	filter := NewBloomFilter(n, falsePositiveRate)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := hashOf(scanner.Bytes())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		digest := make([]byte, hex.DecodedLen(len(line)))
+
+		if _, err := hex.Decode(digest, line); err != nil || len(digest) != 20 {
+			return nil, ErrInvalidCorpus
+		}
+
+		filter.add(digest)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// ReadBloomFilter reads a filter written by WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(bloomMagic)+4+8)
+
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, ErrInvalidCorpus
+	}
+
+	k := binary.BigEndian.Uint32(header[len(bloomMagic):])
+	words := binary.BigEndian.Uint64(header[len(bloomMagic)+4:])
+
+	if k == 0 || words == 0 {
+		return nil, ErrInvalidCorpus
+	}
+
+	filter := &BloomFilter{k: k, bits: make([]uint64, words)}
+
+	if err := binary.Read(r, binary.BigEndian, filter.bits); err != nil {
+		return nil, ErrInvalidCorpus
+	}
+
+	return filter, nil
+}
+
+// WriteTo writes the filter so it can be loaded with ReadBloomFilter.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+4+8)
+
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[len(bloomMagic):], f.k)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+4:], uint64(len(f.bits)))
+
+	if _, err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, f.bits); err != nil {
+		return int64(len(header)), err
+	}
+
+	return int64(len(header) + 8*len(f.bits)), nil
+}
+
+func (f *BloomFilter) Contains(password string) (bool, error) {
+	digest, _ := hex.DecodeString(Hash(password))
+
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := bloomHashes(digest)
+
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (f *BloomFilter) add(digest []byte) {
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := bloomHashes(digest)
+
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// bloomHashes splits a SHA-1 digest into the two hashes used for double
+// hashing. The digest is already uniform, so no other hashing is needed.
+func bloomHashes(digest []byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1
+}
@@ -0,0 +1,195 @@
+// Package breach checks passwords against a local copy of a breached
+// password corpus, such as the Pwned Passwords SHA-1 files, so no
+// external service is called.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidCorpus will throw if a corpus file can not be read.
+var ErrInvalidCorpus = errors.New("invalid breach corpus")
+
+// Corpus tells whether a password appears in known breaches.
+type Corpus interface {
+	Contains(password string) (bool, error)
+}
+
+// Hash returns the uppercase hex SHA-1 digest of a password, the form
+// used by the Pwned Passwords files.
+func Hash(password string) string {
+	sum := sha1.Sum([]byte(password))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Open loads the corpus at the given path:
+//
+// - a directory holds one file per 5 character hash prefix (00000.txt,
+// 00001.txt, ...) with SUFFIX:COUNT lines, as served by the range API;
+//
+// - a bloom filter file, built with BuildBloomFilter;
+//
+// - any other file holds HASH:COUNT lines ordered by hash.
+func Open(path string) (Corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &PrefixDir{path: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(bloomMagic))
+
+	if _, err := io.ReadFull(file, magic); err == nil && string(magic) == bloomMagic {
+		defer file.Close()
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		return ReadBloomFilter(bufio.NewReader(file))
+	}
+
+	return &HashFile{file: file, size: info.Size()}, nil
+}
+
+// PrefixDir is a directory of Pwned Passwords range files. Only the
+// file of the hash prefix is read on each lookup.
+type PrefixDir struct {
+	path string
+}
+
+func (d *PrefixDir) Contains(password string) (bool, error) {
+	hash := Hash(password)
+
+	file, err := os.Open(filepath.Join(d.path, hash[:5]+".txt"))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(d.path, hash[:5]))
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	suffix := []byte(hash[5:])
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if lineHash := hashOf(scanner.Bytes()); bytes.EqualFold(lineHash, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// HashFile is a file of HASH:COUNT lines ordered by hash. It is binary
+// searched on disk, so the corpus is never loaded in memory.
+type HashFile struct {
+	file *os.File
+	size int64
+}
+
+func (h *HashFile) Contains(password string) (bool, error) {
+	target := []byte(Hash(password))
+
+	lo, hi := int64(0), h.size
+
+	// Invariant: the line of the target, if any, starts in [lo, hi).
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := h.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+
+		if line == nil {
+			hi = mid
+			continue
+		}
+
+		switch bytes.Compare(bytes.ToUpper(hashOf(line)), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// Close closes the underlying file.
+func (h *HashFile) Close() error {
+	return h.file.Close()
+}
+
+// lineAt returns the first line starting at or after offset, with its
+// line ending. The line is nil at the end of the file.
+func (h *HashFile) lineAt(offset int64) (int64, []byte, error) {
+	start := offset
+
+	if offset > 0 {
+		start = offset - 1
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(h.file, start, h.size-start))
+
+	if offset > 0 {
+		skipped, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return 0, nil, nil
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+
+	if len(line) == 0 {
+		return 0, nil, nil
+	}
+
+	return start, line, nil
+}
+
+// hashOf returns the hash part of a HASH:COUNT line.
+func hashOf(line []byte) []byte {
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+
+	return bytes.TrimSpace(line)
+}
@@ -0,0 +1,106 @@
+package breach
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var breached = []string{"password", "123456", "qwerty", "letmein", "dragon", "monkey", "111111"}
+
+func corpusLines() []string {
+	lines := []string{}
+
+	for i, password := range breached {
+		lines = append(lines, fmt.Sprintf("%s:%d", Hash(password), i+1))
+	}
+
+	// Padding, so the binary search has something to skip.
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("%s:1", Hash(fmt.Sprintf("filler-%d", i))))
+	}
+
+	sort.Strings(lines)
+
+	return lines
+}
+
+func assertCorpus(t *testing.T, corpus Corpus) {
+	for _, password := range breached {
+		found, err := corpus.Contains(password)
+		require.NoError(t, err)
+		assert.True(t, found, password)
+	}
+
+	for _, password := range []string{"correct horse battery staple", "Tr0ub4dor&3", ""} {
+		found, err := corpus.Contains(password)
+		require.NoError(t, err)
+		assert.False(t, found, password)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	for _, newline := range []string{"\n", "\r\n"} {
+		path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+
+		err := os.WriteFile(path, []byte(strings.Join(corpusLines(), newline)+newline), 0600)
+		require.NoError(t, err)
+
+		corpus, err := Open(path)
+		require.NoError(t, err)
+		assert.IsType(t, &HashFile{}, corpus)
+
+		assertCorpus(t, corpus)
+	}
+}
+
+func TestPrefixDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]string{}
+
+	for _, line := range corpusLines() {
+		files[line[:5]] = append(files[line[:5]], line[5:])
+	}
+
+	for prefix, lines := range files {
+		err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "\r\n")), 0600)
+		require.NoError(t, err)
+	}
+
+	corpus, err := Open(dir)
+	require.NoError(t, err)
+	assert.IsType(t, &PrefixDir{}, corpus)
+
+	assertCorpus(t, corpus)
+}
+
+func TestBloomFilter(t *testing.T) {
+	lines := corpusLines()
+
+	filter, err := BuildBloomFilter(strings.NewReader(strings.Join(lines, "\n")), uint64(len(lines)), 0.0001)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	_, err = filter.WriteTo(&buf)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+
+	corpus, err := Open(path)
+	require.NoError(t, err)
+	assert.IsType(t, &BloomFilter{}, corpus)
+
+	assertCorpus(t, corpus)
+
+	_, err = BuildBloomFilter(strings.NewReader("not a hash:1\n"), 1, 0.01)
+	assert.Equal(t, ErrInvalidCorpus, err)
+}
@@ -1,20 +1,339 @@
 package crypto
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
-// HashPassword encrypts a given password using bcrypt algorithm.
-func HashPassword(password string, cost int) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
-	if err != nil {
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var (
+	// ErrUnsupportedHash will throw if a hash or algorithm is not supported.
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	// ErrSealKey will throw if a sealing key is not 32 bytes long.
+	ErrSealKey = errors.New("the sealing key must be 32 bytes long")
+	// ErrOpen will throw if a sealed value is malformed or was sealed with another key.
+	ErrOpen = errors.New("failed to open the sealed value")
+)
+
+// sealedPrefix tells sealed values apart from plaintext ones.
+const sealedPrefix = "sealed:v1:"
+
+// Params holds the settings used to hash new passwords.
+type Params struct {
+	Algorithm string
+
+	// BcryptCost is the bcrypt cost factor.
+	BcryptCost int
+
+	// Argon2 parameters (RFC 9106). Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follows the OWASP recommendation for argon2id.
+var DefaultParams = Params{
+	Algorithm:   Argon2id,
+	BcryptCost:  10,
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	mu     sync.RWMutex
+	params = DefaultParams
+)
+
+// Configure sets the params used to hash new passwords. Zero values are
+// taken from DefaultParams.
+func Configure(p Params) error {
+	if p.Algorithm == "" {
+		p.Algorithm = DefaultParams.Algorithm
+	}
+
+	if p.Algorithm != Argon2id && p.Algorithm != Bcrypt {
+		return ErrUnsupportedHash
+	}
+
+	if p.BcryptCost == 0 {
+		p.BcryptCost = DefaultParams.BcryptCost
+	}
+
+	if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if p.Memory == 0 {
+		p.Memory = DefaultParams.Memory
+	}
+
+	if p.Iterations == 0 {
+		p.Iterations = DefaultParams.Iterations
+	}
+
+	if p.Parallelism == 0 {
+		p.Parallelism = DefaultParams.Parallelism
+	}
+
+	if p.SaltLength == 0 {
+		p.SaltLength = DefaultParams.SaltLength
+	}
+
+	if p.KeyLength == 0 {
+		p.KeyLength = DefaultParams.KeyLength
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	params = p
+
+	return nil
+}
+
+func currentParams() Params {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return params
+}
+
+// HashPassword hashes a given password with the configured algorithm.
+// Argon2id hashes are stored in the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and bcrypt hashes in their
+// standard modular crypt format ($2a$cost$...).
+func HashPassword(password string) (string, error) {
+	p := currentParams()
+
+	if p.Algorithm == Bcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(bytes), nil
+	}
+
+	salt := make([]byte, p.SaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
 		return "", err
 	}
 
-	return string(bytes), nil
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return argon2Hash{
+		memory:      p.Memory,
+		iterations:  p.Iterations,
+		parallelism: p.Parallelism,
+		salt:        salt,
+		key:         key,
+	}.String(), nil
 }
 
 // CheckPasswordHash checks if the given passwords matches.
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	h, err := parseArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm
+// or weaker params than the configured ones, so it should be replaced
+// the next time the password is known.
+func NeedsRehash(hash string) bool {
+	p := currentParams()
+
+	if isBcrypt(hash) {
+		if p.Algorithm != Bcrypt {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+
+		return err != nil || cost != p.BcryptCost
+	}
+
+	h, err := parseArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.Algorithm != Argon2id ||
+		h.memory != p.Memory ||
+		h.iterations != p.Iterations ||
+		h.parallelism != p.Parallelism ||
+		uint32(len(h.salt)) != p.SaltLength ||
+		uint32(len(h.key)) != p.KeyLength
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h argon2Hash) String() string {
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id,
+		argon2.Version,
+		h.memory,
+		h.iterations,
+		h.parallelism,
+		base64.RawStdEncoding.EncodeToString(h.salt),
+		base64.RawStdEncoding.EncodeToString(h.key),
+	)
+}
+
+func parseArgon2Hash(hash string) (*argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, ErrUnsupportedHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnsupportedHash
+	}
+
+	h := &argon2Hash{}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism)
+	if err != nil || h.iterations == 0 || h.parallelism == 0 {
+		return nil, ErrUnsupportedHash
+	}
+
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, ErrUnsupportedHash
+	}
+
+	return h, nil
+}
+
+// RandomToken generates a URL-safe random token from the given
+// number of random bytes.
+func RandomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 digest of a random token, so it can be
+// stored and looked up without keeping the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal encrypts a secret with AES-256-GCM under the given 32 bytes key.
+// The additional data is authenticated but not encrypted, it binds the
+// sealed value to its owner so it cannot be moved to another one.
+func Seal(key, plaintext, additionalData []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed by Seal with the same key and additional
+// data.
+func Open(key []byte, sealed string, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsSealed(sealed) {
+		return nil, ErrOpen
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrOpen
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrOpen
+	}
+
+	return plaintext, nil
+}
+
+// IsSealed reports whether the value was sealed by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrSealKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 
-	return err == nil
+	return cipher.NewGCM(block)
 }
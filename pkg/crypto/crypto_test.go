@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	sealed, err := Seal(key, []byte("private key"), []byte("kid"))
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "private key")
+
+	plaintext, err := Open(key, sealed, []byte("kid"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("private key"), plaintext)
+
+	// Sealing twice gives different values.
+	again, err := Seal(key, []byte("private key"), []byte("kid"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	_, err = Open(key, sealed, []byte("another kid"))
+	assert.Equal(t, ErrOpen, err)
+
+	_, err = Open(bytes.Repeat([]byte{8}, 32), sealed, []byte("kid"))
+	assert.Equal(t, ErrOpen, err)
+
+	for _, malformed := range []string{"", "private key", sealedPrefix, sealedPrefix + "!!!", sealedPrefix + "AAAA", sealed[:len(sealed)-4]} {
+		_, err = Open(key, malformed, []byte("kid"))
+		assert.Equal(t, ErrOpen, err, malformed)
+	}
+
+	_, err = Seal([]byte("short"), []byte("private key"), nil)
+	assert.Equal(t, ErrSealKey, err)
+}
+
+func setTestParams(t *testing.T, p Params) {
+	require.NoError(t, Configure(p))
+	t.Cleanup(func() { require.NoError(t, Configure(DefaultParams)) })
+}
+
+func TestArgon2HashRoundTrip(t *testing.T) {
+	setTestParams(t, Params{Memory: 1024, Iterations: 1})
+
+	hash, err := HashPassword("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+	assert.LessOrEqual(t, len(hash), 255)
+
+	parsed, err := parseArgon2Hash(hash)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1024), parsed.memory)
+	assert.Equal(t, uint32(1), parsed.iterations)
+	assert.Equal(t, uint8(1), parsed.parallelism)
+	assert.Len(t, parsed.salt, 16)
+	assert.Len(t, parsed.key, 32)
+	assert.Equal(t, hash, parsed.String())
+
+	assert.True(t, CheckPasswordHash("correct horse battery staple", hash))
+	assert.False(t, CheckPasswordHash("Correct horse battery staple", hash))
+	assert.False(t, NeedsRehash(hash))
+}
+
+func TestDefaultArgon2HashFitsTheColumn(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	require.NoError(t, err)
+
+	// users.password and password_history.password are VARCHAR(255).
+	assert.Greater(t, len(hash), 80)
+	assert.LessOrEqual(t, len(hash), 255)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	setTestParams(t, Params{Memory: 1024, Iterations: 1})
+
+	hash, err := HashPassword("password")
+	require.NoError(t, err)
+
+	setTestParams(t, Params{Memory: 1024, Iterations: 2})
+	assert.True(t, NeedsRehash(hash))
+
+	setTestParams(t, Params{Memory: 2048, Iterations: 1})
+	assert.True(t, NeedsRehash(hash))
+
+	setTestParams(t, Params{Memory: 1024, Iterations: 1, KeyLength: 16})
+	assert.True(t, NeedsRehash(hash))
+
+	setTestParams(t, Params{Algorithm: Bcrypt, BcryptCost: 4})
+	assert.True(t, NeedsRehash(hash))
+
+	bcryptHash, err := HashPassword("password")
+	require.NoError(t, err)
+	assert.True(t, CheckPasswordHash("password", bcryptHash))
+	assert.False(t, NeedsRehash(bcryptHash))
+
+	setTestParams(t, Params{Algorithm: Bcrypt, BcryptCost: 5})
+	assert.True(t, NeedsRehash(bcryptHash))
+
+	setTestParams(t, Params{})
+	assert.True(t, NeedsRehash(bcryptHash))
+	assert.True(t, CheckPasswordHash("password", bcryptHash))
+}
+
+func TestMalformedArgon2Hashes(t *testing.T) {
+	valid := "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"
+
+	_, err := parseArgon2Hash(valid)
+	require.NoError(t, err)
+
+	malformed := []string{
+		"",
+		"password",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA",
+		valid + "$extra",
+	}
+
+	for _, hash := range malformed {
+		_, err := parseArgon2Hash(hash)
+		assert.Equal(t, ErrUnsupportedHash, err, hash)
+		assert.False(t, CheckPasswordHash("password", hash), hash)
+		assert.True(t, NeedsRehash(hash), hash)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	assert.Equal(t, ErrUnsupportedHash, Configure(Params{Algorithm: "scrypt"}))
+	assert.Error(t, Configure(Params{Algorithm: Bcrypt, BcryptCost: 64}))
+
+	setTestParams(t, Params{})
+	assert.Equal(t, DefaultParams, currentParams())
+}
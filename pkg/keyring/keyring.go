@@ -0,0 +1,343 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+var (
+	// ErrUnsupportedAlgorithm will throw if the signing algorithm is not supported
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	// ErrKeyNotFound will throw if the token kid does not match any known key
+	ErrKeyNotFound = errors.New("signing key not found")
+)
+
+// Key is a JWT signing key identified by its kid.
+type Key struct {
+	ID        string
+	Algorithm jwa.SignatureAlgorithm
+	raw       interface{}
+	private   jwk.Key
+}
+
+// NewKey wraps the given raw key (a []byte secret for the HS family, or a
+// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey) and derives
+// its kid from the RFC 7638 thumbprint.
+func NewKey(algorithm string, raw interface{}) (*Key, error) {
+	alg, err := parseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKeyType(alg, raw); err != nil {
+		return nil, err
+	}
+
+	private, err := jwk.New(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := jwk.AssignKeyID(private); err != nil {
+		return nil, err
+	}
+
+	private.Set(jwk.AlgorithmKey, alg)
+
+	return &Key{
+		ID:        private.KeyID(),
+		Algorithm: alg,
+		raw:       raw,
+		private:   private,
+	}, nil
+}
+
+// ParseKey parses a PEM encoded private key. For the HS family the
+// given bytes are used as the shared secret.
+func ParseKey(algorithm string, data []byte) (*Key, error) {
+	alg, err := parseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSymmetric(alg) {
+		return NewKey(algorithm, data)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM data")
+	}
+
+	var raw interface{}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		raw, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("invalid PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(algorithm, raw)
+}
+
+// GenerateKey creates a new random key for the given algorithm.
+func GenerateKey(algorithm string) (*Key, error) {
+	alg, err := parseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+
+	switch alg {
+	case jwa.HS256, jwa.HS384, jwa.HS512:
+		secret := make([]byte, 64)
+		_, err = rand.Read(secret)
+		raw = secret
+	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512:
+		raw, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwa.ES256, jwa.ES384, jwa.ES512:
+		raw, err = ecdsa.GenerateKey(curves[alg], rand.Reader)
+	case jwa.EdDSA:
+		_, raw, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(algorithm, raw)
+}
+
+// MarshalPEM encodes the private key in PKCS8 PEM format. For the HS
+// family the raw secret is returned.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	if secret, ok := k.raw.([]byte); ok {
+		return secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(k.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// PublicKey returns the public JWK of the key. Symmetric keys have no
+// public part and return nil.
+func (k *Key) PublicKey() (jwk.Key, error) {
+	if isSymmetric(k.Algorithm) {
+		return nil, nil
+	}
+
+	public, err := jwk.PublicKeyOf(k.private)
+	if err != nil {
+		return nil, err
+	}
+
+	public.Set(jwk.KeyIDKey, k.ID)
+	public.Set(jwk.AlgorithmKey, k.Algorithm)
+	public.Set(jwk.KeyUsageKey, jwk.ForSignature)
+
+	return public, nil
+}
+
+func (k *Key) verificationKey() (interface{}, error) {
+	if secret, ok := k.raw.([]byte); ok {
+		return secret, nil
+	}
+
+	signer, ok := k.raw.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return signer.Public(), nil
+}
+
+// Keyring holds the keys used to sign and verify JWTs. Tokens are always
+// signed with the active key and verified with the key matching their
+// kid, so retiring keys keep validating the tokens they issued until
+// they are removed from the keyring.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+// New creates a keyring with the given active and retiring keys.
+func New(active *Key, retiring ...*Key) *Keyring {
+	k := &Keyring{}
+	k.Set(active, retiring...)
+
+	return k
+}
+
+// Set atomically replaces the keys of the keyring.
+func (k *Keyring) Set(active *Key, retiring ...*Key) {
+	keys := make(map[string]*Key, len(retiring)+1)
+
+	for _, key := range retiring {
+		keys[key.ID] = key
+	}
+
+	if active != nil {
+		keys[active.ID] = active
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active = active
+	k.keys = keys
+}
+
+// Active returns the key currently used for signing.
+func (k *Keyring) Active() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// Sign signs the given token with the active key, setting its kid header.
+func (k *Keyring) Sign(t jwt.Token) (string, error) {
+	active := k.Active()
+	if active == nil {
+		return "", ErrKeyNotFound
+	}
+
+	payload, err := jwt.Sign(t, active.Algorithm, active.private)
+	if err != nil {
+		return "", err
+	}
+
+	return string(payload), nil
+}
+
+// Verify parses the given token, checks its signature against the key
+// named by its kid header and validates its registered claims. The
+// algorithm is taken from the key, never from the token header.
+func (k *Keyring) Verify(token string) (jwt.Token, error) {
+	message, err := jws.ParseString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(message.Signatures()) != 1 {
+		return nil, errors.New("token must have exactly one signature")
+	}
+
+	kid := message.Signatures()[0].ProtectedHeaders().KeyID()
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	verificationKey, err := key.verificationKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseString(
+		token,
+		jwt.WithVerify(key.Algorithm, verificationKey),
+		jwt.WithValidate(true),
+	)
+}
+
+// PublicKeys returns the JWK set of every asymmetric key in the keyring.
+func (k *Keyring) PublicKeys() (jwk.Set, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jwk.NewSet()
+
+	for _, key := range k.keys {
+		public, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		if public != nil {
+			set.Add(public)
+		}
+	}
+
+	return set, nil
+}
+
+var curves = map[jwa.SignatureAlgorithm]elliptic.Curve{
+	jwa.ES256: elliptic.P256(),
+	jwa.ES384: elliptic.P384(),
+	jwa.ES512: elliptic.P521(),
+}
+
+func parseAlgorithm(algorithm string) (jwa.SignatureAlgorithm, error) {
+	var alg jwa.SignatureAlgorithm
+
+	if err := alg.Accept(algorithm); err != nil {
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	if alg == jwa.NoSignature {
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	return alg, nil
+}
+
+func isSymmetric(alg jwa.SignatureAlgorithm) bool {
+	return alg == jwa.HS256 || alg == jwa.HS384 || alg == jwa.HS512
+}
+
+func checkKeyType(alg jwa.SignatureAlgorithm, raw interface{}) error {
+	ok := false
+
+	switch alg {
+	case jwa.HS256, jwa.HS384, jwa.HS512:
+		secret, isSecret := raw.([]byte)
+		ok = isSecret && len(secret) > 0
+	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512:
+		_, ok = raw.(*rsa.PrivateKey)
+	case jwa.ES256, jwa.ES384, jwa.ES512:
+		// Each ES algorithm is defined for a single curve (RFC 7518
+		// section 3.4).
+		private, isECDSA := raw.(*ecdsa.PrivateKey)
+		ok = isECDSA && private.Curve == curves[alg]
+	case jwa.EdDSA:
+		_, ok = raw.(ed25519.PrivateKey)
+	}
+
+	if !ok {
+		return fmt.Errorf("key %T does not match algorithm %s", raw, alg)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testToken(t *testing.T) jwt.Token {
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.SubjectKey, "homer"))
+	require.NoError(t, token.Set(jwt.ExpirationKey, time.Now().Add(time.Minute).Unix()))
+
+	return token
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"HS256", "HS512", "RS256", "PS384", "ES256", "ES384", "ES512", "EdDSA"} {
+		key, err := GenerateKey(algorithm)
+		require.NoError(t, err, algorithm)
+
+		keys := New(key)
+
+		token, err := keys.Sign(testToken(t))
+		require.NoError(t, err, algorithm)
+
+		message, err := jws.ParseString(token)
+		require.NoError(t, err, algorithm)
+		assert.Equal(t, key.ID, message.Signatures()[0].ProtectedHeaders().KeyID(), algorithm)
+
+		verified, err := keys.Verify(token)
+		require.NoError(t, err, algorithm)
+		assert.Equal(t, "homer", verified.Subject(), algorithm)
+	}
+}
+
+func TestParseKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{"HS256", "RS256", "ES256", "EdDSA"} {
+		key, err := GenerateKey(algorithm)
+		require.NoError(t, err, algorithm)
+
+		data, err := key.MarshalPEM()
+		require.NoError(t, err, algorithm)
+
+		parsed, err := ParseKey(algorithm, data)
+		require.NoError(t, err, algorithm)
+		assert.Equal(t, key.ID, parsed.ID, algorithm)
+
+		// A token signed before the round trip still verifies after it.
+		token, err := New(key).Sign(testToken(t))
+		require.NoError(t, err, algorithm)
+
+		_, err = New(parsed).Verify(token)
+		assert.NoError(t, err, algorithm)
+	}
+}
+
+func TestNewKeyMismatch(t *testing.T) {
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewKey("ES256", p384)
+	assert.Error(t, err)
+
+	_, err = NewKey("ES384", p384)
+	assert.NoError(t, err)
+
+	_, err = NewKey("RS256", p384)
+	assert.Error(t, err)
+
+	_, err = NewKey("HS256", []byte{})
+	assert.Error(t, err)
+
+	_, err = NewKey("none", []byte("secret"))
+	assert.Equal(t, ErrUnsupportedAlgorithm, err)
+
+	_, err = ParseKey("RS256", []byte("not a PEM block"))
+	assert.Error(t, err)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	previous, err := GenerateKey("ES256")
+	require.NoError(t, err)
+
+	active, err := GenerateKey("ES256")
+	require.NoError(t, err)
+
+	keys := New(previous)
+
+	token, err := keys.Sign(testToken(t))
+	require.NoError(t, err)
+
+	// A retiring key keeps verifying the tokens it signed.
+	keys.Set(active, previous)
+
+	_, err = keys.Verify(token)
+	assert.NoError(t, err)
+
+	set, err := keys.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	keys.Set(active)
+
+	_, err = keys.Verify(token)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestVerifyUsesTheKeyAlgorithm(t *testing.T) {
+	key, err := GenerateKey("RS256")
+	require.NoError(t, err)
+
+	// A token signed with HS256 under the kid of the RSA key must not
+	// verify, whatever secret was used.
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.KeyIDKey, key.ID))
+
+	forged, err := jwt.Sign(testToken(t), jwa.HS256, []byte(key.ID), jwt.WithHeaders(headers))
+	require.NoError(t, err)
+
+	_, err = New(key).Verify(string(forged))
+	assert.Error(t, err)
+}
+
+func TestPublicKeys(t *testing.T) {
+	rsa, err := GenerateKey("RS256")
+	require.NoError(t, err)
+
+	hs, err := GenerateKey("HS256")
+	require.NoError(t, err)
+
+	// Symmetric keys are never published.
+	set, err := New(rsa, hs).PublicKeys()
+	require.NoError(t, err)
+	require.Equal(t, 1, set.Len())
+
+	public, ok := set.Get(0)
+	require.True(t, ok)
+	assert.Equal(t, rsa.ID, public.KeyID())
+}
@@ -0,0 +1,417 @@
+// Package oidc signs users in with an external OpenID Connect provider,
+// using the authorization code flow with PKCE
+// (https://openid.net/specs/openid-connect-core-1_0.html).
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+var (
+	// ErrDiscovery will throw if the provider metadata cannot be fetched or is invalid
+	ErrDiscovery = errors.New("oidc: invalid provider metadata")
+	// ErrTokenExchange will throw if the token endpoint refuses the authorization code
+	ErrTokenExchange = errors.New("oidc: token exchange failed")
+	// ErrInvalidIDToken will throw if the ID token is malformed, badly signed or not for this client
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+	// ErrNonceMismatch will throw if the ID token was not issued for this login
+	ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+)
+
+// The ID token signature algorithms that are accepted. Symmetric
+// algorithms and "none" never are.
+var signatureAlgorithms = map[jwa.SignatureAlgorithm]bool{
+	jwa.RS256: true,
+	jwa.RS384: true,
+	jwa.RS512: true,
+	jwa.PS256: true,
+	jwa.PS384: true,
+	jwa.PS512: true,
+	jwa.ES256: true,
+	jwa.ES384: true,
+	jwa.ES512: true,
+	jwa.EdDSA: true,
+}
+
+const (
+	// clockSkew is the difference allowed between the clocks of the
+	// provider and ours.
+	clockSkew = time.Minute
+	// keysRefreshInterval limits how often the keys are fetched again
+	// when an ID token is signed with an unknown key.
+	keysRefreshInterval = time.Minute
+	// maxResponseSize limits the size of the responses of the provider.
+	maxResponseSize = 1 << 20
+)
+
+// Config holds the client settings registered with the provider.
+type Config struct {
+	// Issuer is the issuer identifier of the provider, its metadata is
+	// discovered from Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider sends the user back to.
+	RedirectURL string
+	// Scopes are asked for besides "openid".
+	Scopes []string
+	// HTTPClient is used to call the provider, http.DefaultClient by
+	// default.
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the provider metadata
+// (https://openid.net/specs/openid-connect-discovery-1_0.html) the
+// authorization code flow needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Raw holds every claim of the token.
+	Raw map[string]interface{}
+}
+
+// Strings returns a claim that is a string or a list of strings, such as
+// a groups claim.
+func (c *Claims) Strings(name string) []string {
+	switch value := c.Raw[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := []string{}
+
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+// Provider is an OpenID Connect provider. Its metadata and keys are
+// fetched on first use and kept, the keys are fetched again when a token
+// is signed with a key that is not known yet.
+type Provider struct {
+	config Config
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          jwk.Set
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns the provider of the given config.
+func NewProvider(config Config) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc: the issuer, client id and redirect url are required")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	return &Provider{config: config}, nil
+}
+
+// AuthCodeURL returns the URL of the authorization endpoint the user is
+// sent to. The code challenge is the S256 challenge of the verifier
+// given to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", ErrDiscovery
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange trades an authorization code for an ID token and returns its
+// verified claims.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// The credentials are form encoded before being put in the header
+	// (RFC 6749 section 2.3.1).
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, ErrTokenExchange
+	}
+
+	if res.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrTokenExchange, token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: the response has no id_token", ErrTokenExchange)
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiration and
+// nonce of an ID token and returns its claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, token, nonce string) (*Claims, error) {
+	message, err := jws.ParseString(token)
+	if err != nil || len(message.Signatures()) != 1 {
+		return nil, ErrInvalidIDToken
+	}
+
+	headers := message.Signatures()[0].ProtectedHeaders()
+
+	if !signatureAlgorithms[headers.Algorithm()] {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, headers.Algorithm())
+	}
+
+	key, err := p.verificationKey(ctx, headers.KeyID())
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := jwt.ParseString(
+		token,
+		jwt.WithVerify(headers.Algorithm(), key),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithAcceptableSkew(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+
+	if t.Subject() == "" || t.Expiration().IsZero() {
+		return nil, ErrInvalidIDToken
+	}
+
+	raw, err := t.AsMap(ctx)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	// With several audiences the token must name the client it was
+	// issued to.
+	if len(t.Audience()) > 1 {
+		if azp, _ := raw["azp"].(string); azp != p.config.ClientID {
+			return nil, ErrInvalidIDToken
+		}
+	}
+
+	if tokenNonce, _ := raw["nonce"].(string); tokenNonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	claims := &Claims{Subject: t.Subject(), Raw: raw}
+	claims.Email, _ = raw["email"].(string)
+	claims.Name, _ = raw["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+
+	return claims, nil
+}
+
+// Metadata returns the provider metadata, discovering it on first use.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	metadata := &Metadata{}
+
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", metadata); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDiscovery, err)
+	}
+
+	// The issuer must be the one that was configured, or the provider
+	// could speak for another one.
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match", ErrDiscovery, metadata.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, ErrDiscovery
+	}
+
+	p.metadata = metadata
+
+	return metadata, nil
+}
+
+// verificationKey returns the raw public key of the given kid, fetching
+// the keys of the provider again when it is unknown.
+func (p *Provider) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := lookupKey(p.keys, kid)
+
+	if !ok && time.Since(p.keysFetchedAt) >= keysRefreshInterval {
+		var body json.RawMessage
+
+		if err := p.getJSON(ctx, metadata.JWKSURI, &body); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDiscovery, err)
+		}
+
+		keys, err := jwk.Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDiscovery, err)
+		}
+
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+
+		key, ok = lookupKey(p.keys, kid)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+
+	var raw interface{}
+
+	if err := key.Raw(&raw); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	return raw, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxResponseSize))
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
+
+// lookupKey finds a signing key by kid. A token without a kid may only
+// be verified when the provider has a single key.
+func lookupKey(keys jwk.Set, kid string) (jwk.Key, bool) {
+	if keys == nil {
+		return nil, false
+	}
+
+	if kid == "" {
+		if keys.Len() != 1 {
+			return nil, false
+		}
+
+		return keys.Get(0)
+	}
+
+	key, ok := keys.LookupKeyID(kid)
+	if !ok || (key.KeyUsage() != "" && key.KeyUsage() != "sig") {
+		return nil, false
+	}
+
+	return key, true
+}
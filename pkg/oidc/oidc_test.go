@@ -0,0 +1,417 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "puppet_master"
+	testClientSecret = "s3cr3t"
+	testRedirectURL  = "http://localhost:8000/federation/mock/callback"
+)
+
+// mockIdP is a local OpenID Connect provider. Codes are issued by signIn,
+// which stands for the user signing in on the authorization page.
+type mockIdP struct {
+	server *httptest.Server
+	issuer string
+
+	mu    sync.Mutex
+	key   jwk.Key
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	idp := &mockIdP{codes: map[string]mockCode{}}
+	idp.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) rotateKey(t *testing.T) {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := jwk.New(raw)
+	require.NoError(t, err)
+	require.NoError(t, jwk.AssignKeyID(key))
+
+	idp.mu.Lock()
+	idp.key = key
+	idp.mu.Unlock()
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 idp.issuer,
+		"authorization_endpoint": idp.issuer + "/authorize",
+		"token_endpoint":         idp.issuer + "/token",
+		"jwks_uri":               idp.issuer + "/jwks",
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	public, _ := jwk.PublicKeyOf(idp.key)
+	idp.mu.Unlock()
+
+	set := jwk.NewSet()
+	set.Add(public)
+
+	json.NewEncoder(w).Encode(set)
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != testClientID || clientSecret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	code, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	if !ok ||
+		r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != testRedirectURL ||
+		s256(r.PostFormValue("code_verifier")) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idp.idToken(code.claims),
+	})
+}
+
+// signIn follows the authorization URL as the given user and returns the
+// code sent back to the client.
+func (idp *mockIdP) signIn(t *testing.T, authURL string, claims map[string]interface{}) string {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	query := u.Query()
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	tokenClaims := map[string]interface{}{
+		"iss":   idp.issuer,
+		"aud":   query.Get("client_id"),
+		"nonce": query.Get("nonce"),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+	}
+
+	for k, v := range claims {
+		tokenClaims[k] = v
+	}
+
+	random := make([]byte, 16)
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+
+	code := base64.RawURLEncoding.EncodeToString(random)
+
+	idp.mu.Lock()
+	idp.codes[code] = mockCode{challenge: query.Get("code_challenge"), claims: tokenClaims}
+	idp.mu.Unlock()
+
+	return code
+}
+
+func (idp *mockIdP) idToken(claims map[string]interface{}) string {
+	t := jwt.New()
+
+	for k, v := range claims {
+		t.Set(k, v)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	signed, err := jwt.Sign(t, jwa.RS256, idp.key)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(signed)
+}
+
+func (idp *mockIdP) provider(t *testing.T) *Provider {
+	provider, err := NewProvider(Config{
+		Issuer:       idp.issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email", "profile"},
+	})
+	require.NoError(t, err)
+
+	return provider
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", s256("verifier"))
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	query := u.Query()
+
+	assert.Equal(t, idp.issuer+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, testClientID, query.Get("client_id"))
+	assert.Equal(t, testRedirectURL, query.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, s256("verifier"), query.Get("code_challenge"))
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", s256("verifier"))
+	require.NoError(t, err)
+
+	code := idp.signIn(t, authURL, map[string]interface{}{
+		"sub":            "248289761001",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+		"groups":         []string{"engineering", "admins"},
+	})
+
+	claims, err := provider.Exchange(ctx, code, "verifier", "nonce")
+	require.NoError(t, err)
+
+	assert.Equal(t, "248289761001", claims.Subject)
+	assert.Equal(t, "jane@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "Jane Doe", claims.Name)
+	assert.Equal(t, []string{"engineering", "admins"}, claims.Strings("groups"))
+
+	_, err = provider.Exchange(ctx, code, "verifier", "nonce")
+	assert.ErrorIs(t, err, ErrTokenExchange, "codes are single use")
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", s256("verifier"))
+	require.NoError(t, err)
+
+	code := idp.signIn(t, authURL, map[string]interface{}{"sub": "1"})
+
+	_, err = provider.Exchange(ctx, code, "other verifier", "nonce")
+	assert.ErrorIs(t, err, ErrTokenExchange)
+}
+
+func TestExchangeRejectsWrongClientSecret(t *testing.T) {
+	idp := newMockIdP(t)
+	ctx := context.Background()
+
+	provider, err := NewProvider(Config{
+		Issuer:       idp.issuer,
+		ClientID:     testClientID,
+		ClientSecret: "wrong",
+		RedirectURL:  testRedirectURL,
+	})
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", s256("verifier"))
+	require.NoError(t, err)
+
+	code := idp.signIn(t, authURL, map[string]interface{}{"sub": "1"})
+
+	_, err = provider.Exchange(ctx, code, "verifier", "nonce")
+	assert.ErrorIs(t, err, ErrTokenExchange)
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", s256("verifier"))
+	require.NoError(t, err)
+
+	code := idp.signIn(t, authURL, map[string]interface{}{"sub": "1"})
+
+	_, err = provider.Exchange(ctx, code, "verifier", "another login")
+	assert.ErrorIs(t, err, ErrNonceMismatch)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   idp.issuer,
+			"sub":   "1",
+			"aud":   testClientID,
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	_, err := provider.VerifyIDToken(ctx, idp.idToken(valid()), "nonce")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		change func(map[string]interface{})
+	}{
+		{"other issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"other audience", func(c map[string]interface{}) { c["aud"] = "another_client" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiration", func(c map[string]interface{}) { delete(c, "exp") }},
+		{"no subject", func(c map[string]interface{}) { delete(c, "sub") }},
+		{"several audiences without azp", func(c map[string]interface{}) { c["aud"] = []string{testClientID, "another_client"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+
+			_, err := provider.VerifyIDToken(ctx, idp.idToken(claims), "nonce")
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignKey(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	t1 := jwt.New()
+	t1.Set(jwt.IssuerKey, idp.issuer)
+	t1.Set(jwt.SubjectKey, "1")
+	t1.Set(jwt.AudienceKey, testClientID)
+	t1.Set(jwt.ExpirationKey, time.Now().Add(time.Hour).Unix())
+	t1.Set("nonce", "nonce")
+
+	signed, err := jwt.Sign(t1, jwa.ES256, raw)
+	require.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(ctx, string(signed), "nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	signed, err = jwt.Sign(t1, jwa.HS256, []byte(testClientSecret))
+	require.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(ctx, string(signed), "nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestVerifyIDTokenFollowsKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t)
+	ctx := context.Background()
+
+	claims := map[string]interface{}{
+		"iss":   idp.issuer,
+		"sub":   "1",
+		"aud":   testClientID,
+		"nonce": "nonce",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	_, err := provider.VerifyIDToken(ctx, idp.idToken(claims), "nonce")
+	require.NoError(t, err)
+
+	idp.rotateKey(t)
+
+	// The keys were just fetched, so they are not fetched again yet.
+	_, err = provider.VerifyIDToken(ctx, idp.idToken(claims), "nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	provider.keysFetchedAt = time.Now().Add(-keysRefreshInterval)
+
+	_, err = provider.VerifyIDToken(ctx, idp.idToken(claims), "nonce")
+	assert.NoError(t, err)
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+
+	// A provider that speaks for another issuer.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.issuer,
+			"authorization_endpoint": idp.issuer + "/authorize",
+			"token_endpoint":         idp.issuer + "/token",
+			"jwks_uri":               idp.issuer + "/jwks",
+		})
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(Config{
+		Issuer:      server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+	require.NoError(t, err)
+
+	_, err = provider.AuthCodeURL(context.Background(), "state", "nonce", s256("verifier"))
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
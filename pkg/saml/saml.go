@@ -0,0 +1,570 @@
+// Package saml signs users in with an external SAML 2.0 identity
+// provider, as a service provider using the HTTP-Redirect binding for
+// authentication requests and the HTTP-POST binding for responses
+// (https://docs.oasis-open.org/security/saml/v2.0/saml-profiles-2.0-os.pdf).
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+var (
+	// ErrInvalidResponse will throw if the response is malformed, expired or not for this service provider
+	ErrInvalidResponse = errors.New("saml: invalid response")
+	// ErrInvalidSignature will throw if the assertion is not signed by the identity provider
+	ErrInvalidSignature = errors.New("saml: invalid signature")
+	// ErrStatus will throw if the identity provider did not sign the user in
+	ErrStatus = errors.New("saml: the identity provider refused the login")
+)
+
+const (
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	httpPostBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	bearerMethod    = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	statusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+	// clockSkew is the difference allowed between the clocks of the
+	// identity provider and ours.
+	clockSkew = time.Minute
+	// maxResponseSize limits the size of the responses posted back.
+	maxResponseSize = 1 << 20
+)
+
+// Config holds the service provider settings registered with the
+// identity provider and the identity provider settings it gave.
+type Config struct {
+	// EntityID identifies the service provider, it is usually the URL
+	// of its metadata.
+	EntityID string
+	// ACSURL is the assertion consumer service the identity provider
+	// posts its responses to.
+	ACSURL string
+	// IDPEntityID is the issuer of the identity provider responses.
+	IDPEntityID string
+	// IDPSSOURL is the single sign on service of the identity provider,
+	// for the HTTP-Redirect binding.
+	IDPSSOURL string
+	// IDPCertificates are the certificates the identity provider signs
+	// with. Several can be trusted during a rotation.
+	IDPCertificates []*x509.Certificate
+}
+
+// Assertion is the verified assertion of a response.
+type Assertion struct {
+	ID           string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	// Attributes holds the values of every attribute, by name and by
+	// friendly name.
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of an attribute.
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// ServiceProvider is a SAML service provider trusting one identity
+// provider.
+type ServiceProvider struct {
+	config Config
+	roots  *dsig.MemoryX509CertificateStore
+}
+
+// NewServiceProvider returns the service provider of the given config.
+func NewServiceProvider(config Config) (*ServiceProvider, error) {
+	if config.EntityID == "" || config.ACSURL == "" || config.IDPEntityID == "" || config.IDPSSOURL == "" {
+		return nil, errors.New("saml: the entity id, acs url, identity provider entity id and sso url are required")
+	}
+
+	if len(config.IDPCertificates) == 0 {
+		return nil, errors.New("saml: the identity provider certificate is required")
+	}
+
+	return &ServiceProvider{
+		config: config,
+		roots:  &dsig.MemoryX509CertificateStore{Roots: config.IDPCertificates},
+	}, nil
+}
+
+// ParseCertificates parses the PEM encoded certificates of an identity
+// provider. The base64 body of a single certificate, as found in the
+// metadata of most providers, is accepted too.
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	data = strings.TrimSpace(data)
+
+	if !strings.HasPrefix(data, "-----BEGIN") {
+		data = "-----BEGIN CERTIFICATE-----\n" + data + "\n-----END CERTIFICATE-----"
+	}
+
+	certificates := []*x509.Certificate{}
+	rest := []byte(data)
+
+	for {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid certificate: %w", err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("saml: no certificate found")
+	}
+
+	return certificates, nil
+}
+
+type entityDescriptor struct {
+	XMLName         xml.Name        `xml:"md:EntityDescriptor"`
+	Namespace       string          `xml:"xmlns:md,attr"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"md:SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                       `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                       `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                     `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormats              []string                   `xml:"md:NameIDFormat"`
+	AssertionConsumerServices  []assertionConsumerService `xml:"md:AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata returns the metadata of the service provider, which is
+// registered with the identity provider.
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(&entityDescriptor{
+		Namespace: metadataNamespace,
+		EntityID:  sp.config.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: protocolNamespace,
+			NameIDFormats: []string{
+				"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+				"urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+			},
+			AssertionConsumerServices: []assertionConsumerService{{
+				Binding:   httpPostBinding,
+				Location:  sp.config.ACSURL,
+				Index:     1,
+				IsDefault: true,
+			}},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"samlp:AuthnRequest"`
+	ProtocolNamespace           string       `xml:"xmlns:samlp,attr"`
+	AssertionNamespace          string       `xml:"xmlns:saml,attr"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      string       `xml:"saml:Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"samlp:NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	AllowCreate bool `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequestURL returns the URL of the identity provider the user is
+// sent to with an authentication request, and the ID of the request,
+// which the response must answer.
+func (sp *ServiceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", "", err
+	}
+
+	request, err := xml.Marshal(&authnRequest{
+		ProtocolNamespace:           protocolNamespace,
+		AssertionNamespace:          assertionNamespace,
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 sp.config.IDPSSOURL,
+		AssertionConsumerServiceURL: sp.config.ACSURL,
+		ProtocolBinding:             httpPostBinding,
+		Issuer:                      sp.config.EntityID,
+		NameIDPolicy:                nameIDPolicy{AllowCreate: true},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var deflated bytes.Buffer
+
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := writer.Write(request); err != nil {
+		return "", "", err
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+
+	u, err := url.Parse(sp.config.IDPSSOURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := u.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String(), id, nil
+}
+
+type response struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	ID           string   `xml:"ID,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"StatusCode"`
+	} `xml:"Status"`
+}
+
+type assertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"NameID"`
+		SubjectConfirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				InResponseTo string    `xml:"InResponseTo,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions struct {
+		NotBefore            time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter         time.Time `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AuthnStatements []struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"AttributeValue"`
+		} `xml:"Attribute"`
+	} `xml:"AttributeStatement"`
+}
+
+// ParseResponse verifies a base64 encoded response posted to the
+// assertion consumer service and returns its assertion. The response or
+// its assertion must be signed by the identity provider, only what the
+// signature covers is read. The response must answer the request of the
+// given ID, unsolicited responses are refused.
+func (sp *ServiceProvider) ParseResponse(encoded, requestID string) (*Assertion, error) {
+	if len(encoded) > maxResponseSize || requestID == "" {
+		return nil, ErrInvalidResponse
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	doc := etree.NewDocument()
+
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != protocolNamespace {
+		return nil, ErrInvalidResponse
+	}
+
+	res := &response{}
+
+	if err := unmarshalElement(root, res); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+
+	if res.Status.StatusCode.Value != statusSuccess {
+		return nil, fmt.Errorf("%w: %s", ErrStatus, res.Status.StatusCode.Value)
+	}
+
+	if res.Destination != "" && res.Destination != sp.config.ACSURL {
+		return nil, fmt.Errorf("%w: wrong destination", ErrInvalidResponse)
+	}
+
+	if res.InResponseTo != requestID {
+		return nil, fmt.Errorf("%w: not an answer to the request", ErrInvalidResponse)
+	}
+
+	if res.Issuer != "" && res.Issuer != sp.config.IDPEntityID {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidResponse)
+	}
+
+	assertionElement, err := sp.signedAssertion(root)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &assertion{}
+
+	if err := unmarshalElement(assertionElement, a); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+
+	if err := sp.validateAssertion(a, requestID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	result := &Assertion{
+		ID:           a.ID,
+		NameID:       strings.TrimSpace(a.Subject.NameID.Value),
+		NameIDFormat: a.Subject.NameID.Format,
+		Attributes:   map[string][]string{},
+	}
+
+	if len(a.AuthnStatements) > 0 {
+		result.SessionIndex = a.AuthnStatements[0].SessionIndex
+	}
+
+	for _, statement := range a.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			values := []string{}
+
+			for _, value := range attribute.Values {
+				values = append(values, strings.TrimSpace(value))
+			}
+
+			result.Attributes[attribute.Name] = append(result.Attributes[attribute.Name], values...)
+
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				result.Attributes[attribute.FriendlyName] = append(result.Attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// signedAssertion returns the assertion covered by the signature of the
+// response, or by its own. Exactly one assertion is accepted, so an
+// unsigned assertion cannot be slipped next to a signed one.
+func (sp *ServiceProvider) signedAssertion(root *etree.Element) (*etree.Element, error) {
+	validator := dsig.NewDefaultValidationContext(sp.roots)
+
+	if childElements(root, dsig.Namespace, dsig.SignatureTag) != nil {
+		validated, err := validator.Validate(root)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+		}
+
+		return singleAssertion(validated)
+	}
+
+	assertionElement, err := singleAssertion(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := etreeutils.NSBuildParentContext(assertionElement)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	detached, err := etreeutils.NSDetatch(ctx, assertionElement)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	validated, err := validator.Validate(detached)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	return validated, nil
+}
+
+func singleAssertion(response *etree.Element) (*etree.Element, error) {
+	if childElements(response, assertionNamespace, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+
+	assertions := childElements(response, assertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected one assertion", ErrInvalidResponse)
+	}
+
+	return assertions[0], nil
+}
+
+func (sp *ServiceProvider) validateAssertion(a *assertion, requestID string, now time.Time) error {
+	if a.Issuer != sp.config.IDPEntityID {
+		return fmt.Errorf("%w: wrong issuer", ErrInvalidResponse)
+	}
+
+	if strings.TrimSpace(a.Subject.NameID.Value) == "" {
+		return fmt.Errorf("%w: no subject", ErrInvalidResponse)
+	}
+
+	if !a.Conditions.NotBefore.IsZero() && now.Add(clockSkew).Before(a.Conditions.NotBefore) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidResponse)
+	}
+
+	if !a.Conditions.NotOnOrAfter.IsZero() && !now.Add(-clockSkew).Before(a.Conditions.NotOnOrAfter) {
+		return fmt.Errorf("%w: expired", ErrInvalidResponse)
+	}
+
+	// Every audience restriction must name us, and bearer assertions
+	// must have one.
+	if len(a.Conditions.AudienceRestrictions) == 0 {
+		return fmt.Errorf("%w: no audience", ErrInvalidResponse)
+	}
+
+	for _, restriction := range a.Conditions.AudienceRestrictions {
+		found := false
+
+		for _, audience := range restriction.Audiences {
+			if strings.TrimSpace(audience) == sp.config.EntityID {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%w: wrong audience", ErrInvalidResponse)
+		}
+	}
+
+	for _, confirmation := range a.Subject.SubjectConfirmations {
+		data := confirmation.Data
+
+		if confirmation.Method == bearerMethod &&
+			data.Recipient == sp.config.ACSURL &&
+			data.InResponseTo == requestID &&
+			!data.NotOnOrAfter.IsZero() &&
+			now.Add(-clockSkew).Before(data.NotOnOrAfter) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no valid bearer subject confirmation", ErrInvalidResponse)
+}
+
+func childElements(el *etree.Element, namespace, tag string) []*etree.Element {
+	var children []*etree.Element
+
+	for _, child := range el.ChildElements() {
+		if child.Tag == tag && child.NamespaceURI() == namespace {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// unmarshalElement decodes an element with the namespaces declared by
+// its parents.
+func unmarshalElement(el *etree.Element, v interface{}) error {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return err
+	}
+
+	detached, err := etreeutils.NSDetatch(ctx, el)
+	if err != nil {
+		return err
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(detached)
+
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(data, v)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 20)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// IDs are xsd:ID values, which cannot start with a digit.
+	return "_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,389 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testEntityID    = "http://localhost:8000/saml/mock/metadata"
+	testACSURL      = "http://localhost:8000/saml/mock/acs"
+	testIDPEntityID = "https://idp.example.com/saml"
+	testIDPSSOURL   = "https://idp.example.com/saml/sso?tenant=acme"
+	testRequestID   = "_4f1c0e2f3b7a"
+)
+
+// mockIdP signs responses like a SAML identity provider would.
+type mockIdP struct {
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &mockIdP{key: key, certificate: certificate}
+}
+
+func (idp *mockIdP) sign(t *testing.T, el *etree.Element) *etree.Element {
+	ctx, err := dsig.NewSigningContext(idp.key, [][]byte{idp.certificate.Raw})
+	require.NoError(t, err)
+
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	signed, err := ctx.SignEnveloped(el)
+	require.NoError(t, err)
+
+	return signed
+}
+
+// responseOptions change a valid response to test what is refused.
+type responseOptions struct {
+	nameID       string
+	audience     string
+	inResponseTo string
+	recipient    string
+	notOnOrAfter time.Time
+	status       string
+	signResponse bool
+	unsigned     bool
+}
+
+func defaultOptions() responseOptions {
+	return responseOptions{
+		nameID:       "jdoe@example.com",
+		audience:     testEntityID,
+		inResponseTo: testRequestID,
+		recipient:    testACSURL,
+		notOnOrAfter: time.Now().Add(5 * time.Minute),
+		status:       statusSuccess,
+	}
+}
+
+func newAssertion(options responseOptions) *etree.Element {
+	now := time.Now().UTC()
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", assertionNamespace)
+	assertion.CreateAttr("ID", "_assertion1")
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	assertion.CreateElement("saml:Issuer").SetText(testIDPEntityID)
+
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress")
+	nameID.SetText(options.nameID)
+
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", bearerMethod)
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("InResponseTo", options.inResponseTo)
+	data.CreateAttr("Recipient", options.recipient)
+	data.CreateAttr("NotOnOrAfter", options.notOnOrAfter.UTC().Format(time.RFC3339))
+
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", now.Add(-time.Minute).Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", options.notOnOrAfter.UTC().Format(time.RFC3339))
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(options.audience)
+
+	authn := assertion.CreateElement("saml:AuthnStatement")
+	authn.CreateAttr("AuthnInstant", now.Format(time.RFC3339))
+	authn.CreateAttr("SessionIndex", "_session1")
+
+	statement := assertion.CreateElement("saml:AttributeStatement")
+
+	for name, values := range map[string][]string{
+		"email":  {"jdoe@example.com"},
+		"name":   {"John Doe"},
+		"groups": {"engineering", "pm-admins"},
+	} {
+		attribute := statement.CreateElement("saml:Attribute")
+		attribute.CreateAttr("Name", "urn:example:"+name)
+		attribute.CreateAttr("FriendlyName", name)
+
+		for _, value := range values {
+			attribute.CreateElement("saml:AttributeValue").SetText(value)
+		}
+	}
+
+	return assertion
+}
+
+func newResponse(assertions ...*etree.Element) *etree.Element {
+	return newResponseWithStatus(statusSuccess, assertions...)
+}
+
+func newResponseWithStatus(status string, assertions ...*etree.Element) *etree.Element {
+	response := etree.NewElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", protocolNamespace)
+	response.CreateAttr("xmlns:saml", assertionNamespace)
+	response.CreateAttr("ID", "_response1")
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", time.Now().UTC().Format(time.RFC3339))
+	response.CreateAttr("Destination", testACSURL)
+	response.CreateAttr("InResponseTo", testRequestID)
+	response.CreateElement("saml:Issuer").SetText(testIDPEntityID)
+	response.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", status)
+
+	for _, assertion := range assertions {
+		response.AddChild(assertion)
+	}
+
+	return response
+}
+
+func (idp *mockIdP) response(t *testing.T, options responseOptions) string {
+	assertion := newAssertion(options)
+
+	if !options.signResponse && !options.unsigned {
+		assertion = idp.sign(t, assertion)
+	}
+
+	response := newResponseWithStatus(options.status, assertion)
+
+	if options.signResponse {
+		response = idp.sign(t, response)
+	}
+
+	return encode(t, response)
+}
+
+func encode(t *testing.T, el *etree.Element) string {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+
+	b, err := doc.WriteToBytes()
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func newTestServiceProvider(t *testing.T, idp *mockIdP) *ServiceProvider {
+	sp, err := NewServiceProvider(Config{
+		EntityID:        testEntityID,
+		ACSURL:          testACSURL,
+		IDPEntityID:     testIDPEntityID,
+		IDPSSOURL:       testIDPSSOURL,
+		IDPCertificates: []*x509.Certificate{idp.certificate},
+	})
+	require.NoError(t, err)
+
+	return sp
+}
+
+func TestMetadata(t *testing.T) {
+	sp := newTestServiceProvider(t, newMockIdP(t))
+
+	metadata, err := sp.Metadata()
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(metadata))
+
+	root := doc.Root()
+	assert.Equal(t, metadataNamespace, root.NamespaceURI())
+	assert.Equal(t, testEntityID, root.SelectAttrValue("entityID", ""))
+
+	acs := root.FindElement("./SPSSODescriptor/AssertionConsumerService")
+	require.NotNil(t, acs)
+	assert.Equal(t, testACSURL, acs.SelectAttrValue("Location", ""))
+	assert.Equal(t, httpPostBinding, acs.SelectAttrValue("Binding", ""))
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	sp := newTestServiceProvider(t, newMockIdP(t))
+
+	authURL, requestID, err := sp.AuthnRequestURL("state")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	query := u.Query()
+	assert.Equal(t, "acme", query.Get("tenant"))
+	assert.Equal(t, "state", query.Get("RelayState"))
+
+	deflated, err := base64.StdEncoding.DecodeString(query.Get("SAMLRequest"))
+	require.NoError(t, err)
+
+	raw, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+
+	request := struct {
+		ID     string `xml:"ID,attr"`
+		ACS    string `xml:"AssertionConsumerServiceURL,attr"`
+		Issuer string `xml:"Issuer"`
+	}{}
+
+	require.NoError(t, xml.Unmarshal(raw, &request))
+	assert.Equal(t, requestID, request.ID)
+	assert.Equal(t, testACSURL, request.ACS)
+	assert.Equal(t, testEntityID, request.Issuer)
+	assert.True(t, strings.HasPrefix(requestID, "_"))
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	assertion, err := sp.ParseResponse(idp.response(t, defaultOptions()), testRequestID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "jdoe@example.com", assertion.NameID)
+	assert.Equal(t, "_session1", assertion.SessionIndex)
+	assert.Equal(t, "John Doe", assertion.Attribute("name"))
+	assert.Equal(t, "John Doe", assertion.Attribute("urn:example:name"))
+	assert.Equal(t, []string{"engineering", "pm-admins"}, assertion.Attributes["groups"])
+}
+
+func TestParseResponseSignedResponse(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	options := defaultOptions()
+	options.signResponse = true
+
+	assertion, err := sp.ParseResponse(idp.response(t, options), testRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe@example.com", assertion.NameID)
+}
+
+func TestParseResponseRejectsUnsigned(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	options := defaultOptions()
+	options.unsigned = true
+
+	_, err := sp.ParseResponse(idp.response(t, options), testRequestID)
+	assert.True(t, errors.Is(err, ErrInvalidSignature))
+}
+
+func TestParseResponseRejectsOtherIdP(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	_, err := sp.ParseResponse(newMockIdP(t).response(t, defaultOptions()), testRequestID)
+	assert.True(t, errors.Is(err, ErrInvalidSignature))
+}
+
+func TestParseResponseRejectsTampering(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	signed := idp.sign(t, newAssertion(defaultOptions()))
+	signed.FindElement("./Subject/NameID").SetText("admin@example.com")
+
+	_, err := sp.ParseResponse(encode(t, newResponse(signed)), testRequestID)
+	assert.True(t, errors.Is(err, ErrInvalidSignature))
+}
+
+func TestParseResponseRejectsWrapping(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	options := defaultOptions()
+	signed := idp.sign(t, newAssertion(options))
+
+	options.nameID = "admin@example.com"
+	injected := newAssertion(options)
+	injected.CreateAttr("ID", "_assertion2")
+
+	_, err := sp.ParseResponse(encode(t, newResponse(injected, signed)), testRequestID)
+	assert.True(t, errors.Is(err, ErrInvalidResponse))
+}
+
+func TestParseResponseRejectsInvalidAssertions(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	tests := map[string]func(*responseOptions){
+		"wrong audience":  func(o *responseOptions) { o.audience = "https://other.example.com" },
+		"other request":   func(o *responseOptions) { o.inResponseTo = "_other" },
+		"wrong recipient": func(o *responseOptions) { o.recipient = "https://other.example.com/acs" },
+		"expired":         func(o *responseOptions) { o.notOnOrAfter = time.Now().Add(-5 * time.Minute) },
+	}
+
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			options := defaultOptions()
+			change(&options)
+
+			_, err := sp.ParseResponse(idp.response(t, options), testRequestID)
+			assert.True(t, errors.Is(err, ErrInvalidResponse), err)
+		})
+	}
+}
+
+func TestParseResponseRejectsUnsolicited(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	_, err := sp.ParseResponse(idp.response(t, defaultOptions()), "_other")
+	assert.True(t, errors.Is(err, ErrInvalidResponse))
+
+	_, err = sp.ParseResponse(idp.response(t, defaultOptions()), "")
+	assert.True(t, errors.Is(err, ErrInvalidResponse))
+}
+
+func TestParseResponseStatus(t *testing.T) {
+	idp := newMockIdP(t)
+	sp := newTestServiceProvider(t, idp)
+
+	options := defaultOptions()
+	options.status = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+
+	_, err := sp.ParseResponse(idp.response(t, options), testRequestID)
+	assert.True(t, errors.Is(err, ErrStatus))
+}
+
+func TestParseCertificates(t *testing.T) {
+	idp := newMockIdP(t)
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.certificate.Raw})
+
+	certificates, err := ParseCertificates(string(encoded))
+	require.NoError(t, err)
+	assert.True(t, certificates[0].Equal(idp.certificate))
+
+	certificates, err = ParseCertificates(base64.StdEncoding.EncodeToString(idp.certificate.Raw))
+	require.NoError(t, err)
+	assert.True(t, certificates[0].Equal(idp.certificate))
+
+	_, err = ParseCertificates("not a certificate")
+	assert.Error(t, err)
+}
@@ -0,0 +1,545 @@
+// Package scim implements the filters and the PATCH operations of SCIM
+// 2.0 (RFC 7644) over resources decoded as JSON objects.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The messages and resources of the protocol.
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+var (
+	// ErrInvalidFilter will throw if a filter cannot be parsed
+	ErrInvalidFilter = errors.New("scim: invalid filter")
+	// ErrInvalidPath will throw if the path of an operation cannot be parsed
+	ErrInvalidPath = errors.New("scim: invalid path")
+	// ErrNoTarget will throw if the path of an operation matches no value
+	ErrNoTarget = errors.New("scim: no target")
+	// ErrInvalidValue will throw if the value of an operation does not fit its path
+	ErrInvalidValue = errors.New("scim: invalid value")
+	// ErrInvalidOperation will throw if the operation is not add, remove or replace
+	ErrInvalidOperation = errors.New("scim: invalid operation")
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2), like
+// `userName eq "homer@simpsons.org" and active eq true`.
+type Filter struct {
+	// op is "and", "or", "not", "[]" for a value path, or the operator
+	// of an attribute expression.
+	op        string
+	left      *Filter
+	right     *Filter
+	attribute string
+	value     interface{}
+}
+
+var comparisonOperators = map[string]bool{
+	"eq": true,
+	"ne": true,
+	"co": true,
+	"sw": true,
+	"ew": true,
+	"gt": true,
+	"ge": true,
+	"lt": true,
+	"le": true,
+}
+
+// ParseFilter parses a filter expression. Attribute names may carry the
+// URN of their schema, which is dropped.
+func ParseFilter(filter string) (*Filter, error) {
+	tokens, err := lex(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, ErrInvalidFilter
+	}
+
+	return f, nil
+}
+
+// Match reports whether the resource matches the filter. Strings are
+// compared ignoring case and a multi-valued attribute matches when one
+// of its values does. Complex values are compared by their "value"
+// sub-attribute.
+func (f *Filter) Match(resource map[string]interface{}) bool {
+	switch f.op {
+	case "and":
+		return f.left.Match(resource) && f.right.Match(resource)
+	case "or":
+		return f.left.Match(resource) || f.right.Match(resource)
+	case "not":
+		return !f.left.Match(resource)
+	case "[]":
+		for _, value := range lookup(resource, f.attribute) {
+			if object, ok := value.(map[string]interface{}); ok && f.left.Match(object) {
+				return true
+			}
+		}
+
+		return false
+	case "pr":
+		for _, value := range lookup(resource, f.attribute) {
+			if present(value) {
+				return true
+			}
+		}
+
+		return false
+	case "ne":
+		for _, value := range lookup(resource, f.attribute) {
+			if compare("eq", value, f.value) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		for _, value := range lookup(resource, f.attribute) {
+			if compare(f.op, value, f.value) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Equal returns the value of a filter comparing the attribute for
+// equality with a string, like `userName eq "bjensen"`, so it can be
+// looked up by a database instead of matched.
+func (f *Filter) Equal(attribute string) (string, bool) {
+	if f.op != "eq" || !strings.EqualFold(f.attribute, attribute) {
+		return "", false
+	}
+
+	value, ok := f.value.(string)
+
+	return value, ok
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpen
+	tokenClose
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(filter string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(filter)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket})
+			i++
+		case r == '"':
+			end := i + 1
+
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+
+			if end >= len(runes) {
+				return nil, ErrInvalidFilter
+			}
+
+			var text string
+
+			if err := json.Unmarshal([]byte(string(runes[i:end+1])), &text); err != nil {
+				return nil, ErrInvalidFilter
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i = end + 1
+		default:
+			end := i
+
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()[]"`, runes[end]) {
+				end++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[i:end])})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+
+	return &p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) expect(kind tokenKind) error {
+	t := p.next()
+	if t == nil || t.kind != kind {
+		return ErrInvalidFilter
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (*Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Filter{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Filter{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (*Filter, error) {
+	if p.keyword("not") {
+		p.next()
+
+		if err := p.expect(tokenOpen); err != nil {
+			return nil, err
+		}
+
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(tokenClose); err != nil {
+			return nil, err
+		}
+
+		return &Filter{op: "not", left: f}, nil
+	}
+
+	t := p.next()
+	if t == nil {
+		return nil, ErrInvalidFilter
+	}
+
+	switch t.kind {
+	case tokenOpen:
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(tokenClose); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+	case tokenWord:
+		return p.parseAttribute(t.text)
+	default:
+		return nil, ErrInvalidFilter
+	}
+}
+
+func (p *parser) parseAttribute(name string) (*Filter, error) {
+	attribute, err := attributeName(name)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	t := p.next()
+	if t == nil {
+		return nil, ErrInvalidFilter
+	}
+
+	if t.kind == tokenOpenBracket {
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(tokenCloseBracket); err != nil {
+			return nil, err
+		}
+
+		return &Filter{op: "[]", attribute: attribute, left: f}, nil
+	}
+
+	op := strings.ToLower(t.text)
+
+	if t.kind != tokenWord {
+		return nil, ErrInvalidFilter
+	}
+
+	if op == "pr" {
+		return &Filter{op: op, attribute: attribute}, nil
+	}
+
+	if !comparisonOperators[op] {
+		return nil, ErrInvalidFilter
+	}
+
+	t = p.next()
+	if t == nil {
+		return nil, ErrInvalidFilter
+	}
+
+	f := &Filter{op: op, attribute: attribute}
+
+	switch {
+	case t.kind == tokenString:
+		f.value = t.text
+	case t.kind != tokenWord:
+		return nil, ErrInvalidFilter
+	case t.text == "true", t.text == "false":
+		f.value = t.text == "true"
+	case t.text == "null":
+		f.value = nil
+	default:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, ErrInvalidFilter
+		}
+
+		f.value = number
+	}
+
+	return f, nil
+}
+
+// attributeName drops the schema URN of an attribute path, like
+// "urn:ietf:params:scim:schemas:core:2.0:User:userName".
+func attributeName(name string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(name), "urn:") {
+		name = name[strings.LastIndex(name, ":")+1:]
+	}
+
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return "", ErrInvalidPath
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".$_-", r) {
+			return "", ErrInvalidPath
+		}
+	}
+
+	return name, nil
+}
+
+// lookup returns the values of an attribute path, the ones of every
+// element of a multi-valued attribute along the way.
+func lookup(resource map[string]interface{}, path string) []interface{} {
+	values := []interface{}{resource}
+
+	for _, name := range strings.Split(path, ".") {
+		next := []interface{}{}
+
+		for _, value := range values {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if key, ok := attributeKey(object, name); ok {
+				next = append(next, flatten(object[key])...)
+			}
+		}
+
+		values = next
+	}
+
+	return values
+}
+
+// attributeKey finds the key of an attribute, whose names are case
+// insensitive.
+func attributeKey(object map[string]interface{}, name string) (string, bool) {
+	if _, ok := object[name]; ok {
+		return name, true
+	}
+
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+
+	return name, false
+}
+
+func flatten(value interface{}) []interface{} {
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+
+	return []interface{}{value}
+}
+
+func present(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+func compare(op string, actual, expected interface{}) bool {
+	if object, ok := actual.(map[string]interface{}); ok {
+		key, _ := attributeKey(object, "value")
+		actual = object[key]
+	}
+
+	switch e := expected.(type) {
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return false
+		}
+
+		a, e = strings.ToLower(a), strings.ToLower(e)
+
+		switch op {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "eq":
+			return a == e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		a, ok := actual.(bool)
+
+		return ok && op == "eq" && a == e
+	case nil:
+		return op == "eq" && actual == nil
+	}
+
+	return false
+}
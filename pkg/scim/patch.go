@@ -0,0 +1,289 @@
+package scim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path is the target of a PATCH operation (RFC 7644 section 3.5.2), like
+// `name.givenName`, `members[value eq "2"]` or
+// `emails[type eq "work"].value`.
+type Path struct {
+	Attribute    string
+	Filter       *Filter
+	SubAttribute string
+}
+
+// ParsePath parses the path of a PATCH operation.
+func ParsePath(path string) (*Path, error) {
+	attribute := path
+	rest := ""
+
+	p := &Path{}
+
+	if open := strings.Index(path, "["); open >= 0 {
+		end := strings.LastIndex(path, "]")
+		if end < open {
+			return nil, ErrInvalidPath
+		}
+
+		filter, err := ParseFilter(path[open+1 : end])
+		if err != nil {
+			return nil, ErrInvalidPath
+		}
+
+		p.Filter = filter
+		attribute = path[:open]
+		rest = path[end+1:]
+
+		if rest != "" && !strings.HasPrefix(rest, ".") {
+			return nil, ErrInvalidPath
+		}
+
+		rest = strings.TrimPrefix(rest, ".")
+	}
+
+	attribute, err := attributeName(attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Filter == nil {
+		if dot := strings.Index(attribute, "."); dot >= 0 {
+			attribute, rest = attribute[:dot], attribute[dot+1:]
+		}
+	}
+
+	if strings.Contains(rest, ".") || (rest != "" && strings.Contains(attribute, ".")) {
+		return nil, ErrInvalidPath
+	}
+
+	if rest != "" {
+		if _, err := attributeName(rest); err != nil {
+			return nil, err
+		}
+	}
+
+	p.Attribute = attribute
+	p.SubAttribute = rest
+
+	return p, nil
+}
+
+// Apply applies an "add", "replace" or "remove" operation to a resource.
+// Without a path, the value holds the attributes to add or replace.
+// Adding to a multi-valued attribute appends the values it does not
+// have yet. Removing values from a multi-valued attribute without a
+// filter, like some providers do for group members, removes the given
+// values only.
+func Apply(resource map[string]interface{}, op, path string, value interface{}) error {
+	switch strings.ToLower(op) {
+	case "add", "replace":
+		replace := strings.EqualFold(op, "replace")
+
+		if path == "" {
+			attributes, ok := value.(map[string]interface{})
+			if !ok {
+				return ErrInvalidValue
+			}
+
+			for name, value := range attributes {
+				if err := Apply(resource, op, name, value); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		p, err := ParsePath(path)
+		if err != nil {
+			return err
+		}
+
+		return p.set(resource, value, replace)
+	case "remove":
+		if path == "" {
+			return ErrNoTarget
+		}
+
+		p, err := ParsePath(path)
+		if err != nil {
+			return err
+		}
+
+		return p.remove(resource, value)
+	default:
+		return ErrInvalidOperation
+	}
+}
+
+func (p *Path) set(resource map[string]interface{}, value interface{}, replace bool) error {
+	key, _ := attributeKey(resource, p.Attribute)
+	current := resource[key]
+
+	if p.Filter != nil {
+		values, _ := current.([]interface{})
+		matched := false
+
+		for _, element := range values {
+			object, ok := element.(map[string]interface{})
+			if !ok || !p.Filter.Match(object) {
+				continue
+			}
+
+			matched = true
+
+			if p.SubAttribute != "" {
+				subKey, _ := attributeKey(object, p.SubAttribute)
+				object[subKey] = value
+				continue
+			}
+
+			attributes, ok := value.(map[string]interface{})
+			if !ok {
+				return ErrInvalidValue
+			}
+
+			merge(object, attributes)
+		}
+
+		if !matched {
+			return ErrNoTarget
+		}
+
+		return nil
+	}
+
+	if p.SubAttribute != "" {
+		object, ok := current.(map[string]interface{})
+		if current != nil && !ok {
+			return ErrInvalidPath
+		}
+
+		if object == nil {
+			object = map[string]interface{}{}
+			resource[key] = object
+		}
+
+		subKey, _ := attributeKey(object, p.SubAttribute)
+		object[subKey] = value
+
+		return nil
+	}
+
+	if values, ok := current.([]interface{}); ok && !replace {
+		resource[key] = appendValues(values, value)
+		return nil
+	}
+
+	object, isObject := current.(map[string]interface{})
+	attributes, ok := value.(map[string]interface{})
+
+	if isObject && ok {
+		merge(object, attributes)
+		return nil
+	}
+
+	resource[key] = value
+
+	return nil
+}
+
+func (p *Path) remove(resource map[string]interface{}, value interface{}) error {
+	key, ok := attributeKey(resource, p.Attribute)
+	if !ok {
+		return nil
+	}
+
+	current := resource[key]
+
+	if p.Filter != nil {
+		values, _ := current.([]interface{})
+		kept := []interface{}{}
+
+		for _, element := range values {
+			object, ok := element.(map[string]interface{})
+			if !ok || !p.Filter.Match(object) {
+				kept = append(kept, element)
+				continue
+			}
+
+			if p.SubAttribute != "" {
+				subKey, _ := attributeKey(object, p.SubAttribute)
+				delete(object, subKey)
+				kept = append(kept, object)
+			}
+		}
+
+		resource[key] = kept
+
+		return nil
+	}
+
+	if p.SubAttribute != "" {
+		if object, ok := current.(map[string]interface{}); ok {
+			subKey, _ := attributeKey(object, p.SubAttribute)
+			delete(object, subKey)
+		}
+
+		return nil
+	}
+
+	if values, ok := current.([]interface{}); ok && value != nil {
+		kept := []interface{}{}
+
+		for _, element := range values {
+			if !containsValue(flatten(value), element) {
+				kept = append(kept, element)
+			}
+		}
+
+		resource[key] = kept
+
+		return nil
+	}
+
+	delete(resource, key)
+
+	return nil
+}
+
+func merge(object, attributes map[string]interface{}) {
+	for name, value := range attributes {
+		key, _ := attributeKey(object, name)
+		object[key] = value
+	}
+}
+
+func appendValues(values []interface{}, value interface{}) []interface{} {
+	for _, element := range flatten(value) {
+		if !containsValue(values, element) {
+			values = append(values, element)
+		}
+	}
+
+	return values
+}
+
+// containsValue compares complex values by their "value" sub-attribute,
+// which is the ID of a group member.
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, element := range values {
+		if elementValue(element) == elementValue(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func elementValue(value interface{}) string {
+	if object, ok := value.(map[string]interface{}); ok {
+		if key, ok := attributeKey(object, "value"); ok {
+			value = object[key]
+		}
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,201 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResource(t *testing.T, document string) map[string]interface{} {
+	resource := map[string]interface{}{}
+
+	require.NoError(t, json.Unmarshal([]byte(document), &resource))
+
+	return resource
+}
+
+const testUser = `{
+	"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+	"id": "2",
+	"userName": "Homer@Simpsons.org",
+	"displayName": "Homer Simpson",
+	"name": {"formatted": "Homer Simpson"},
+	"emails": [{"value": "homer@simpsons.org", "type": "work", "primary": true}],
+	"active": true,
+	"groups": [{"value": "3", "display": "Safety Inspectors"}],
+	"meta": {"created": "2021-04-05T13:38:57Z"}
+}`
+
+func TestFilterMatch(t *testing.T) {
+	user := testResource(t, testUser)
+
+	filters := map[string]bool{
+		`userName eq "homer@simpsons.org"`:                               true,
+		`USERNAME EQ "HOMER@SIMPSONS.ORG"`:                               true,
+		`userName eq "marge@simpsons.org"`:                               false,
+		`userName ne "marge@simpsons.org"`:                               true,
+		`userName sw "homer"`:                                            true,
+		`userName ew "@simpsons.org"`:                                    true,
+		`displayName co "simp"`:                                          true,
+		`name.formatted eq "Homer Simpson"`:                              true,
+		`emails.value eq "homer@simpsons.org"`:                           true,
+		`emails co "homer"`:                                              true,
+		`emails[type eq "work" and value co "homer"]`:                    true,
+		`emails[type eq "home"]`:                                         false,
+		`groups eq "3"`:                                                  true,
+		`active eq true`:                                                 true,
+		`active eq false`:                                                false,
+		`externalId pr`:                                                  false,
+		`title pr or userName pr`:                                        true,
+		`not (active eq true)`:                                           false,
+		`(userName eq "x" or displayName sw "Homer") and active eq true`: true,
+		`meta.created gt "2021-01-01T00:00:00Z"`:                         true,
+		`meta.created lt "2021-01-01T00:00:00Z"`:                         false,
+		`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "homer"`: true,
+		`userName eq "say \"doh\""`:                                      false,
+	}
+
+	for expression, match := range filters {
+		filter, err := ParseFilter(expression)
+		require.NoError(t, err, expression)
+
+		assert.Equal(t, match, filter.Match(user), expression)
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	filters := []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName xx "homer"`,
+		`userName eq homer`,
+		`userName eq "homer`,
+		`(userName eq "homer"`,
+		`userName eq "homer" and`,
+		`userName eq "homer" active eq true`,
+		`emails[type eq "work"`,
+		`not userName eq "homer"`,
+	}
+
+	for _, expression := range filters {
+		_, err := ParseFilter(expression)
+		assert.Equal(t, ErrInvalidFilter, err, expression)
+	}
+}
+
+func TestFilterEqual(t *testing.T) {
+	filters := map[string]string{
+		`userName eq "homer@simpsons.org"`:                               "homer@simpsons.org",
+		`urn:ietf:params:scim:schemas:core:2.0:User:USERNAME EQ "homer"`: "homer",
+	}
+
+	for filter, expected := range filters {
+		f, err := ParseFilter(filter)
+		require.NoError(t, err, filter)
+
+		value, ok := f.Equal("userName")
+		assert.True(t, ok, filter)
+		assert.Equal(t, expected, value, filter)
+	}
+
+	for _, filter := range []string{
+		`userName ne "homer@simpsons.org"`,
+		`userName eq "homer" or userName eq "marge"`,
+		`displayName eq "Homer Simpson"`,
+		`userName eq null`,
+	} {
+		f, err := ParseFilter(filter)
+		require.NoError(t, err, filter)
+
+		_, ok := f.Equal("userName")
+		assert.False(t, ok, filter)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	p, err := ParsePath("name.givenName")
+	require.NoError(t, err)
+	assert.Equal(t, "name", p.Attribute)
+	assert.Equal(t, "givenName", p.SubAttribute)
+	assert.Nil(t, p.Filter)
+
+	p, err = ParsePath(`emails[type eq "work"].value`)
+	require.NoError(t, err)
+	assert.Equal(t, "emails", p.Attribute)
+	assert.Equal(t, "value", p.SubAttribute)
+	assert.NotNil(t, p.Filter)
+
+	p, err = ParsePath("urn:ietf:params:scim:schemas:core:2.0:User:active")
+	require.NoError(t, err)
+	assert.Equal(t, "active", p.Attribute)
+
+	for _, path := range []string{"", "name.", "a.b.c", `members[value eq "2"`, `members[value eq "2"]x`, "user name"} {
+		_, err := ParsePath(path)
+		assert.Equal(t, ErrInvalidPath, err, path)
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Run("replace", func(t *testing.T) {
+		user := testResource(t, testUser)
+
+		require.NoError(t, Apply(user, "Replace", "active", false))
+		require.NoError(t, Apply(user, "replace", "name.givenName", "Max"))
+		require.NoError(t, Apply(user, "replace", `emails[type eq "work"].value`, "max@powers.org"))
+		require.NoError(t, Apply(user, "replace", "", map[string]interface{}{
+			"displayName": "Max Power",
+			"name":        map[string]interface{}{"familyName": "Power"},
+		}))
+
+		assert.Equal(t, false, user["active"])
+		assert.Equal(t, "Max Power", user["displayName"])
+		assert.Equal(t, map[string]interface{}{
+			"formatted":  "Homer Simpson",
+			"givenName":  "Max",
+			"familyName": "Power",
+		}, user["name"])
+		assert.Equal(t, "max@powers.org", lookup(user, "emails.value")[0])
+
+		assert.Equal(t, ErrNoTarget, Apply(user, "replace", `emails[type eq "home"].value`, "x"))
+	})
+
+	t.Run("add", func(t *testing.T) {
+		group := testResource(t, `{"displayName": "Safety Inspectors", "members": [{"value": "2"}]}`)
+
+		require.NoError(t, Apply(group, "add", "members", []interface{}{
+			map[string]interface{}{"value": "2"},
+			map[string]interface{}{"value": "4"},
+		}))
+		require.NoError(t, Apply(group, "add", "", map[string]interface{}{
+			"members": []interface{}{map[string]interface{}{"value": "5"}},
+		}))
+
+		assert.Equal(t, []interface{}{"2", "4", "5"}, lookup(group, "members.value"))
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		group := testResource(t, `{"displayName": "Safety Inspectors", "members": [{"value": "2"}, {"value": "4"}, {"value": "5"}]}`)
+
+		require.NoError(t, Apply(group, "remove", `members[value eq "2"]`, nil))
+		require.NoError(t, Apply(group, "remove", "members", []interface{}{map[string]interface{}{"value": "4"}}))
+		assert.Equal(t, []interface{}{"5"}, lookup(group, "members.value"))
+
+		require.NoError(t, Apply(group, "remove", "members", nil))
+		assert.Empty(t, lookup(group, "members"))
+
+		require.NoError(t, Apply(group, "remove", "externalId", nil))
+		assert.Equal(t, ErrNoTarget, Apply(group, "remove", "", nil))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		user := testResource(t, testUser)
+
+		assert.Equal(t, ErrInvalidOperation, Apply(user, "move", "active", false))
+		assert.Equal(t, ErrInvalidValue, Apply(user, "add", "", "value"))
+		assert.Equal(t, ErrInvalidPath, Apply(user, "add", "user name", "value"))
+		assert.Equal(t, ErrInvalidPath, Apply(user, "add", "userName.first", "value"))
+	})
+}
@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890",
+// encoded in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes, these are their last 6 digits.
+	vectors := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, vector := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(vector.time, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, vector.code, code, vector.time)
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	code, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	_, err = Code("not base32!", 1)
+	assert.Error(t, err)
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	previous, err := Code(rfcSecret, current-1)
+	require.NoError(t, err)
+
+	step, ok := Validate(rfcSecret, previous, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, current-1, step)
+
+	next, err := Code(rfcSecret, current+1)
+	require.NoError(t, err)
+
+	step, ok = Validate(rfcSecret, next, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, current+1, step)
+
+	// Outside the window, or without any window, drifted codes fail.
+	_, ok = Validate(rfcSecret, previous, now, 0)
+	assert.False(t, ok)
+
+	old, err := Code(rfcSecret, current-2)
+	require.NoError(t, err)
+
+	_, ok = Validate(rfcSecret, old, now, 1)
+	assert.False(t, ok)
+}
+
+func TestValidateMalformedCode(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	_, ok := Validate(rfcSecret, "287082", now, 0)
+	assert.True(t, ok)
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		_, ok := Validate(rfcSecret, code, now, 1)
+		assert.False(t, ok, code)
+	}
+}
@@ -0,0 +1,217 @@
+package validation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/cyruzin/puppet_master/pkg/breach"
+	"github.com/rs/zerolog/log"
+)
+
+// Violation is a password policy rule a password does not follow.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy holds the rules every new password must follow.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// DenyList holds lowercased passwords that are never accepted.
+	DenyList map[string]struct{}
+	// CheckUserInfo rejects passwords containing the user's name or email.
+	CheckUserInfo bool
+	// History is how many previous passwords can not be reused. It is
+	// enforced by the callers, which have access to the stored hashes.
+	History int
+	// Breached is a corpus of breached passwords. Passwords found in it
+	// are rejected, or only logged when WarnBreached is set.
+	Breached     breach.Corpus
+	WarnBreached bool
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   = PasswordPolicy{MinLength: 8}
+)
+
+// SetPasswordPolicy replaces the password policy.
+func SetPasswordPolicy(p PasswordPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	policy = p
+}
+
+// CurrentPasswordPolicy returns the password policy.
+func CurrentPasswordPolicy() PasswordPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+
+	return policy
+}
+
+// LoadDenyList reads a deny-list file with one password per line.
+// Empty lines and lines starting with # are skipped.
+func LoadDenyList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	denyList := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		denyList[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return denyList, nil
+}
+
+// IsAValidPassword checks the given password against the password
+// policy. The user info (name, email) is used by the CheckUserInfo rule.
+// Every broken rule is listed in the returned error.
+func IsAValidPassword(ctx context.Context, password string, userInfo ...string) error {
+	p := CurrentPasswordPolicy()
+
+	if password == "" {
+		return PasswordPolicyError(Violation{Rule: "required", Message: "is required"})
+	}
+
+	violations := []Violation{}
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("minimum length is %d", p.MinLength),
+		})
+	}
+
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if p.RequireLower && !lower {
+		violations = append(violations, Violation{Rule: "lower", Message: "must contain a lowercase letter"})
+	}
+
+	if p.RequireUpper && !upper {
+		violations = append(violations, Violation{Rule: "upper", Message: "must contain an uppercase letter"})
+	}
+
+	if p.RequireDigit && !digit {
+		violations = append(violations, Violation{Rule: "digit", Message: "must contain a digit"})
+	}
+
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, Violation{Rule: "symbol", Message: "must contain a symbol"})
+	}
+
+	if _, denied := p.DenyList[strings.ToLower(password)]; denied {
+		violations = append(violations, Violation{Rule: "deny_list", Message: "is too common"})
+	}
+
+	if p.CheckUserInfo && containsUserInfo(password, userInfo) {
+		violations = append(violations, Violation{Rule: "user_info", Message: "must not contain your name or email"})
+	}
+
+	if p.Breached != nil && isBreached(p, password) {
+		violations = append(violations, Violation{Rule: "breached", Message: "was found in a data breach"})
+	}
+
+	if len(violations) > 0 {
+		return PasswordPolicyError(violations...)
+	}
+
+	return nil
+}
+
+// PasswordPolicyError builds the error returned for the given violations.
+func PasswordPolicyError(violations ...Violation) error {
+	return &APIMessage{
+		Message:    "the password field " + violations[0].Message,
+		Violations: violations,
+	}
+}
+
+// isBreached reports whether the password must be rejected because it
+// was found in the breach corpus. The password is accepted when the
+// corpus can not be read, so a broken file does not block every user.
+func isBreached(p PasswordPolicy, password string) bool {
+	found, err := p.Breached.Contains(password)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg(err.Error())
+		return false
+	}
+
+	if found && p.WarnBreached {
+		log.Warn().
+			Str("event", "breached_password").
+			Msg("a password found in a data breach was accepted")
+
+		return false
+	}
+
+	return found
+}
+
+// containsUserInfo reports whether the password contains the email, its
+// local part or a word of the name. Parts shorter than 3 characters are
+// ignored so short names do not reject too many passwords.
+func containsUserInfo(password string, userInfo []string) bool {
+	password = strings.ToLower(password)
+
+	parts := []string{}
+
+	for _, info := range userInfo {
+		info = strings.ToLower(info)
+
+		if local := strings.Split(info, "@")[0]; strings.Contains(info, "@") {
+			parts = append(parts, info, local)
+			continue
+		}
+
+		parts = append(parts, strings.Fields(info)...)
+	}
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
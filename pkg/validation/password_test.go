@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCorpus is a breach corpus holding the given passwords.
+type testCorpus map[string]bool
+
+func (c testCorpus) Contains(password string) (bool, error) {
+	if c == nil {
+		return false, errors.New("corpus unavailable")
+	}
+
+	return c[password], nil
+}
+
+func setTestPolicy(t *testing.T, p PasswordPolicy) {
+	previous := CurrentPasswordPolicy()
+
+	SetPasswordPolicy(p)
+	t.Cleanup(func() { SetPasswordPolicy(previous) })
+}
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	message, ok := err.(*APIMessage)
+	require.True(t, ok, err)
+
+	rules := []string{}
+
+	for _, violation := range message.Violations {
+		rules = append(rules, violation.Rule)
+	}
+
+	return rules
+}
+
+func TestIsAValidPassword(t *testing.T) {
+	setTestPolicy(t, PasswordPolicy{
+		MinLength:     10,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		DenyList:      map[string]struct{}{"password123!a": {}},
+		CheckUserInfo: true,
+	})
+
+	tests := []struct {
+		password string
+		rules    []string
+	}{
+		{"", []string{"required"}},
+		{"Sh0rt!", []string{"min_length"}},
+		{"alllowercase", []string{"upper", "digit", "symbol"}},
+		{"ALLUPPERCASE1!", []string{"lower"}},
+		{"NoDigitsHere!", []string{"digit"}},
+		{"NoSymbols123", []string{"symbol"}},
+		{"Password123!A", []string{"deny_list"}},
+		{"Simpson-Rules-1", []string{"user_info"}},
+		{"Homer@simpsons.org1", []string{"user_info"}},
+		{"Tr0ub4dor&3xyz", nil},
+		{"Ünïcödé-Pässwörd-1", nil},
+	}
+
+	for _, tt := range tests {
+		err := IsAValidPassword(context.Background(), tt.password, "Homer Simpson", "homer@simpsons.org")
+		assert.Equal(t, tt.rules, violatedRules(t, err), tt.password)
+	}
+}
+
+func TestIsAValidPasswordMessage(t *testing.T) {
+	setTestPolicy(t, PasswordPolicy{MinLength: 8, RequireDigit: true})
+
+	err := IsAValidPassword(context.Background(), "short")
+	require.Error(t, err)
+	assert.Equal(t, "the password field minimum length is 8", err.Error())
+	assert.Equal(t, []string{"min_length", "digit"}, violatedRules(t, err))
+}
+
+func TestMinLengthCountsCharacters(t *testing.T) {
+	setTestPolicy(t, PasswordPolicy{MinLength: 8})
+
+	// 8 characters, 16 bytes.
+	assert.NoError(t, IsAValidPassword(context.Background(), "ääääääää"))
+	assert.Error(t, IsAValidPassword(context.Background(), "äääääää"))
+}
+
+func TestContainsUserInfo(t *testing.T) {
+	info := []string{"Ned Flanders", "ned.flanders@springfield.org"}
+
+	assert.True(t, containsUserInfo("iloveflanders", info))
+	assert.True(t, containsUserInfo("NED.FLANDERS!", info))
+	assert.True(t, containsUserInfo("x-ned.flanders@springfield.org-x", info))
+
+	// Parts shorter than 3 characters are ignored.
+	assert.False(t, containsUserInfo("wed-hill", []string{"Al Ed"}))
+	assert.False(t, containsUserInfo("correct horse", info))
+	assert.False(t, containsUserInfo("anything", nil))
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	corpus := testCorpus{"hunter22": true}
+
+	setTestPolicy(t, PasswordPolicy{MinLength: 8, Breached: corpus})
+	assert.Equal(t, []string{"breached"}, violatedRules(t, IsAValidPassword(context.Background(), "hunter22")))
+	assert.NoError(t, IsAValidPassword(context.Background(), "hunter23"))
+
+	// In warn mode breached passwords are only logged.
+	setTestPolicy(t, PasswordPolicy{MinLength: 8, Breached: corpus, WarnBreached: true})
+	assert.NoError(t, IsAValidPassword(context.Background(), "hunter22"))
+
+	// A corpus that can not be read does not block anybody.
+	setTestPolicy(t, PasswordPolicy{MinLength: 8, Breached: testCorpus(nil)})
+	assert.NoError(t, IsAValidPassword(context.Background(), "hunter22"))
+}
+
+func TestLoadDenyList(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "deny-list.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# common passwords\n\nPassword\n  qwerty  \n"), 0600))
+
+	denyList, err := LoadDenyList(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"password": {}, "qwerty": {}}, denyList)
+
+	_, err = LoadDenyList(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
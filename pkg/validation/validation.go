@@ -9,14 +9,25 @@ import (
 
 // APIMessage is a struct for generic JSON response.
 type APIMessage struct {
-	Message string `json:"message,omitempty"`
-	Status  int    `json:"status,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
 }
 
 func (a *APIMessage) Error() string {
 	return a.Message
 }
 
+// Extensions exposes the violations in the "extensions" field of
+// GraphQL errors.
+func (a *APIMessage) Extensions() map[string]interface{} {
+	if len(a.Violations) == 0 {
+		return nil
+	}
+
+	return map[string]interface{}{"violations": a.Violations}
+}
+
 func validationMap(err validator.FieldError, field string) *APIMessage {
 	errMap := map[string]string{
 		"required": "is required",
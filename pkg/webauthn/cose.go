@@ -0,0 +1,163 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers supported for credentials.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 8152).
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a parsed COSE_Key.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+func parsePublicKey(data []byte) (*publicKey, error) {
+	var params map[int]interface{}
+
+	if err := cbor.Unmarshal(data, &params); err != nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := coseInt(params[coseKty])
+	alg, _ := coseInt(params[coseAlg])
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := coseInt(params[coseCrv])
+		x, _ := params[coseX].([]byte)
+		y, _ := params[coseY].([]byte)
+
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &publicKey{alg: alg, key: key}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := coseInt(params[coseCrv])
+		x, _ := params[coseX].([]byte)
+
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := params[coseN].([]byte)
+		e, _ := params[coseE].([]byte)
+
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &publicKey{
+			alg: alg,
+			key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			},
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+func (p *publicKey) verify(message, signature []byte) bool {
+	return verifySignature(p.alg, p.key, message, signature)
+}
+
+func verifySignature(alg int, key crypto.PublicKey, message, signature []byte) bool {
+	switch alg {
+	case AlgES256:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+
+		digest := sha256.Sum256(message)
+
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case AlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+
+		return ed25519.Verify(k, message, signature)
+	case AlgRS256:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+
+		digest := sha256.Sum256(message)
+
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	return false
+}
+
+func verifyCertificateSignature(alg int, der, message, signature []byte) bool {
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return false
+	}
+
+	return verifySignature(alg, certificate.PublicKey, message, signature)
+}
+
+// coseInt reads a CBOR integer, which decodes as uint64 or int64.
+func coseInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return int(v), true
+	case int64:
+		return int(v), true
+	}
+
+	return 0, false
+}
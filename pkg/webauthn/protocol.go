@@ -0,0 +1,287 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+// URLEncodedBase64 is a byte slice encoded as base64url in JSON, the
+// way browsers serialize WebAuthn binary fields.
+type URLEncodedBase64 []byte
+
+// MarshalJSON encodes the bytes as unpadded base64url.
+func (u URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(u))
+}
+
+// UnmarshalJSON decodes padded or unpadded base64url.
+func (u *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var encoded string
+
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+
+	*u = decoded
+
+	return nil
+}
+
+// CredentialCreationResponse is the PublicKeyCredential returned by
+// navigator.credentials.create().
+type CredentialCreationResponse struct {
+	ID       string           `json:"id"`
+	RawID    URLEncodedBase64 `json:"rawId"`
+	Type     string           `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+		AttestationObject URLEncodedBase64 `json:"attestationObject"`
+		Transports        []string         `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// CredentialAssertionResponse is the PublicKeyCredential returned by
+// navigator.credentials.get().
+type CredentialAssertionResponse struct {
+	ID       string           `json:"id"`
+	RawID    URLEncodedBase64 `json:"rawId"`
+	Type     string           `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedBase64 `json:"authenticatorData"`
+		Signature         URLEncodedBase64 `json:"signature"`
+		UserHandle        URLEncodedBase64 `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// ParseCredentialCreation parses the JSON serialized registration response.
+func ParseCredentialCreation(data []byte) (*CredentialCreationResponse, error) {
+	response := &CredentialCreationResponse{}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	if response.Type != "public-key" || len(response.RawID) == 0 ||
+		len(response.Response.ClientDataJSON) == 0 || len(response.Response.AttestationObject) == 0 {
+		return nil, ErrInvalidResponse
+	}
+
+	return response, nil
+}
+
+// ParseCredentialAssertion parses the JSON serialized login response.
+func ParseCredentialAssertion(data []byte) (*CredentialAssertionResponse, error) {
+	response := &CredentialAssertionResponse{}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	if response.Type != "public-key" || len(response.RawID) == 0 ||
+		len(response.Response.ClientDataJSON) == 0 || len(response.Response.AuthenticatorData) == 0 ||
+		len(response.Response.Signature) == 0 {
+		return nil, ErrInvalidResponse
+	}
+
+	return response, nil
+}
+
+// Challenge returns the challenge the browser signed, so the caller can
+// look up the ceremony it belongs to.
+func (r *CredentialCreationResponse) Challenge() ([]byte, error) {
+	clientData, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientData.Challenge, nil
+}
+
+// Challenge returns the challenge the browser signed, so the caller can
+// look up the ceremony it belongs to.
+func (r *CredentialAssertionResponse) Challenge() ([]byte, error) {
+	clientData, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientData.Challenge, nil
+}
+
+// UserVerified reports whether the authenticator verified the user, with
+// a PIN or biometrics, and not only their presence. It is only meaningful
+// once the assertion was checked by VerifyAssertion.
+func (r *CredentialAssertionResponse) UserVerified() bool {
+	authData, err := parseAuthenticatorData(r.Response.AuthenticatorData)
+	if err != nil {
+		return false
+	}
+
+	return authData.Flags&flagUserVerified != 0
+}
+
+type clientData struct {
+	Type        string           `json:"type"`
+	Challenge   URLEncodedBase64 `json:"challenge"`
+	Origin      string           `json:"origin"`
+	CrossOrigin bool             `json:"crossOrigin,omitempty"`
+}
+
+func parseClientData(data []byte) (*clientData, error) {
+	c := &clientData{}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	return c, nil
+}
+
+func (c *clientData) verify(ceremony string, challenge []byte, origins []string) error {
+	if c.Type != ceremony {
+		return ErrInvalidResponse
+	}
+
+	if subtle.ConstantTimeCompare(c.Challenge, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	for _, origin := range origins {
+		if c.Origin == origin {
+			return nil
+		}
+	}
+
+	return ErrOriginMismatch
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+
+	a := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rest := data[37:]
+
+	if a.Flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidAuthenticatorData
+		}
+
+		a.AAGUID = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+
+		if len(rest) < length {
+			return nil, ErrInvalidAuthenticatorData
+		}
+
+		a.CredentialID = rest[:length]
+		rest = rest[length:]
+
+		// The public key is a CBOR map that may be followed by the
+		// extensions, so it has to be decoded to know where it ends.
+		var key cbor.RawMessage
+
+		decoder := cbor.NewDecoder(bytes.NewReader(rest))
+		if err := decoder.Decode(&key); err != nil {
+			return nil, ErrInvalidAuthenticatorData
+		}
+
+		a.PublicKey = rest[:decoder.NumBytesRead()]
+		rest = rest[decoder.NumBytesRead():]
+	}
+
+	if a.Flags&flagExtensionData != 0 {
+		var extensions cbor.RawMessage
+
+		if err := cbor.Unmarshal(rest, &extensions); err != nil {
+			return nil, ErrInvalidAuthenticatorData
+		}
+
+		rest = nil
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+
+	return a, nil
+}
+
+func (a *authenticatorData) verify(rpID string, userVerification string) error {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	if subtle.ConstantTimeCompare(a.RPIDHash, rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+
+	if a.Flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+
+	if userVerification == UserVerificationRequired && a.Flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+
+	return nil
+}
+
+type attestationObject struct {
+	Format    string                     `cbor:"fmt"`
+	Statement map[string]cbor.RawMessage `cbor:"attStmt"`
+	AuthData  []byte                     `cbor:"authData"`
+}
+
+type packedStatement struct {
+	Alg int      `cbor:"alg"`
+	Sig []byte   `cbor:"sig"`
+	X5C [][]byte `cbor:"x5c"`
+}
+
+// signedData is the message signed by the authenticator in both
+// ceremonies.
+func signedData(authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	message := make([]byte, 0, len(authData)+len(clientDataHash))
+	message = append(message, authData...)
+	message = append(message, clientDataHash[:]...)
+
+	return message
+}
@@ -0,0 +1,361 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// User verification requirements.
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+var (
+	// ErrInvalidResponse will throw if the credential response is malformed
+	ErrInvalidResponse = errors.New("webauthn: invalid credential response")
+	// ErrInvalidAuthenticatorData will throw if the authenticator data is malformed
+	ErrInvalidAuthenticatorData = errors.New("webauthn: invalid authenticator data")
+	// ErrChallengeMismatch will throw if the signed challenge is not the expected one
+	ErrChallengeMismatch = errors.New("webauthn: challenge mismatch")
+	// ErrOriginMismatch will throw if the ceremony happened on an unknown origin
+	ErrOriginMismatch = errors.New("webauthn: origin mismatch")
+	// ErrRPIDMismatch will throw if the credential is scoped to another relying party
+	ErrRPIDMismatch = errors.New("webauthn: relying party mismatch")
+	// ErrUserNotPresent will throw if the authenticator did not test for user presence
+	ErrUserNotPresent = errors.New("webauthn: user not present")
+	// ErrUserNotVerified will throw if user verification is required but was not performed
+	ErrUserNotVerified = errors.New("webauthn: user not verified")
+	// ErrUnsupportedKey will throw if the credential public key type is not supported
+	ErrUnsupportedKey = errors.New("webauthn: unsupported credential public key")
+	// ErrUnsupportedAttestation will throw if the attestation format is not supported
+	ErrUnsupportedAttestation = errors.New("webauthn: unsupported attestation format")
+	// ErrInvalidAttestation will throw if the attestation statement does not verify
+	ErrInvalidAttestation = errors.New("webauthn: invalid attestation statement")
+	// ErrInvalidSignature will throw if the assertion signature does not verify
+	ErrInvalidSignature = errors.New("webauthn: invalid signature")
+	// ErrCredentialMismatch will throw if the assertion is not for the given credential
+	ErrCredentialMismatch = errors.New("webauthn: credential mismatch")
+	// ErrSignCount will throw if the signature counter went backwards,
+	// which may mean the authenticator was cloned
+	ErrSignCount = errors.New("webauthn: signature counter did not increase")
+)
+
+// Config holds the relying party settings.
+type Config struct {
+	// RPID is the domain the credentials are scoped to, e.g. "example.com".
+	RPID string
+	// RPName is the name shown by the authenticator.
+	RPName string
+	// Origins are the web origins allowed to run the ceremonies,
+	// e.g. "https://example.com".
+	Origins []string
+	// Timeout is the time the user has to complete a ceremony.
+	Timeout time.Duration
+	// UserVerification is "required", "preferred" or "discouraged".
+	UserVerification string
+}
+
+// WebAuthn runs the relying party side of the registration and
+// authentication ceremonies (https://www.w3.org/TR/webauthn-2/).
+type WebAuthn struct {
+	config Config
+}
+
+// User is the account a credential is registered for.
+type User struct {
+	// ID is an opaque user handle of at most 64 bytes.
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a verified public key credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// New returns a relying party for the given config.
+func New(config Config) (*WebAuthn, error) {
+	if config.RPID == "" || len(config.Origins) == 0 {
+		return nil, errors.New("webauthn: the relying party id and origins are required")
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Minute
+	}
+
+	switch config.UserVerification {
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	case "":
+		config.UserVerification = UserVerificationPreferred
+	default:
+		return nil, errors.New("webauthn: invalid user verification requirement")
+	}
+
+	return &WebAuthn{config: config}, nil
+}
+
+// Timeout returns the time the user has to complete a ceremony.
+func (w *WebAuthn) Timeout() time.Duration {
+	return w.config.Timeout
+}
+
+// NewChallenge creates a random ceremony challenge.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// CredentialDescriptor identifies a credential in the ceremony options.
+type CredentialDescriptor struct {
+	Type string           `json:"type"`
+	ID   URLEncodedBase64 `json:"id"`
+}
+
+// CredentialCreationOptions is the argument of navigator.credentials.create().
+type CredentialCreationOptions struct {
+	PublicKey struct {
+		RP struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"rp"`
+		User struct {
+			ID          URLEncodedBase64 `json:"id"`
+			Name        string           `json:"name"`
+			DisplayName string           `json:"displayName"`
+		} `json:"user"`
+		Challenge        URLEncodedBase64 `json:"challenge"`
+		PubKeyCredParams []struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		} `json:"pubKeyCredParams"`
+		Timeout                int64                  `json:"timeout"`
+		ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection struct {
+			ResidentKey        string `json:"residentKey"`
+			RequireResidentKey bool   `json:"requireResidentKey"`
+			UserVerification   string `json:"userVerification"`
+		} `json:"authenticatorSelection"`
+		Attestation string `json:"attestation"`
+	} `json:"publicKey"`
+}
+
+// CredentialRequestOptions is the argument of navigator.credentials.get().
+type CredentialRequestOptions struct {
+	PublicKey struct {
+		Challenge        URLEncodedBase64       `json:"challenge"`
+		Timeout          int64                  `json:"timeout"`
+		RPID             string                 `json:"rpId"`
+		AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+		UserVerification string                 `json:"userVerification"`
+	} `json:"publicKey"`
+}
+
+// CreationOptions builds the registration options. Discoverable
+// credentials (passkeys) are preferred, so they can be used without
+// entering the email first. Existing credentials of the user are
+// excluded so the same authenticator is not registered twice.
+func (w *WebAuthn) CreationOptions(user User, challenge []byte, exclude [][]byte) *CredentialCreationOptions {
+	options := &CredentialCreationOptions{}
+
+	options.PublicKey.RP.ID = w.config.RPID
+	options.PublicKey.RP.Name = w.config.RPName
+	options.PublicKey.User.ID = user.ID
+	options.PublicKey.User.Name = user.Name
+	options.PublicKey.User.DisplayName = user.DisplayName
+	options.PublicKey.Challenge = challenge
+	options.PublicKey.Timeout = w.config.Timeout.Milliseconds()
+	options.PublicKey.ExcludeCredentials = descriptors(exclude)
+	options.PublicKey.AuthenticatorSelection.ResidentKey = "preferred"
+	options.PublicKey.AuthenticatorSelection.UserVerification = w.config.UserVerification
+	options.PublicKey.Attestation = "none"
+
+	for _, alg := range []int{AlgES256, AlgEdDSA, AlgRS256} {
+		options.PublicKey.PubKeyCredParams = append(options.PublicKey.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{"public-key", alg})
+	}
+
+	return options
+}
+
+// RequestOptions builds the authentication options. An empty allow list
+// lets the user pick any discoverable credential for the relying party.
+func (w *WebAuthn) RequestOptions(challenge []byte, allow [][]byte) *CredentialRequestOptions {
+	options := &CredentialRequestOptions{}
+
+	options.PublicKey.Challenge = challenge
+	options.PublicKey.Timeout = w.config.Timeout.Milliseconds()
+	options.PublicKey.RPID = w.config.RPID
+	options.PublicKey.AllowCredentials = descriptors(allow)
+	options.PublicKey.UserVerification = w.config.UserVerification
+
+	return options
+}
+
+// VerifyRegistration checks a registration response against the
+// challenge it was created for and returns the new credential.
+// Attestation is not required: "none" is accepted, and "packed"
+// statements are checked for a valid signature only.
+func (w *WebAuthn) VerifyRegistration(response *CredentialCreationResponse, challenge []byte) (*Credential, error) {
+	clientData, err := parseClientData(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clientData.verify("webauthn.create", challenge, w.config.Origins); err != nil {
+		return nil, err
+	}
+
+	attestation := &attestationObject{}
+
+	if err := cbor.Unmarshal(response.Response.AttestationObject, attestation); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, err := parseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authData.verify(w.config.RPID, w.config.UserVerification); err != nil {
+		return nil, err
+	}
+
+	if authData.Flags&flagAttestedCredentialData == 0 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+
+	if string(authData.CredentialID) != string(response.RawID) {
+		return nil, ErrCredentialMismatch
+	}
+
+	key, err := parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	message := signedData(attestation.AuthData, response.Response.ClientDataJSON)
+
+	if err := verifyAttestation(attestation, key, message); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.CredentialID,
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+		AAGUID:    authData.AAGUID,
+	}, nil
+}
+
+// VerifyAssertion checks an authentication response for the given
+// credential and returns its new signature counter.
+func (w *WebAuthn) VerifyAssertion(
+	response *CredentialAssertionResponse,
+	challenge []byte,
+	credential *Credential,
+) (uint32, error) {
+	if string(response.RawID) != string(credential.ID) {
+		return 0, ErrCredentialMismatch
+	}
+
+	clientData, err := parseClientData(response.Response.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := clientData.verify("webauthn.get", challenge, w.config.Origins); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := authData.verify(w.config.RPID, w.config.UserVerification); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	message := signedData(response.Response.AuthenticatorData, response.Response.ClientDataJSON)
+
+	if !key.verify(message, response.Response.Signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// Authenticators that do not implement the counter always send 0.
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.SignCount, nil
+}
+
+func verifyAttestation(attestation *attestationObject, key *publicKey, message []byte) error {
+	switch attestation.Format {
+	case "none":
+		if len(attestation.Statement) != 0 {
+			return ErrInvalidAttestation
+		}
+
+		return nil
+	case "packed":
+		raw, err := cbor.Marshal(attestation.Statement)
+		if err != nil {
+			return ErrInvalidAttestation
+		}
+
+		statement := &packedStatement{}
+
+		if err := cbor.Unmarshal(raw, statement); err != nil {
+			return ErrInvalidAttestation
+		}
+
+		if len(statement.X5C) > 0 {
+			if !verifyCertificateSignature(statement.Alg, statement.X5C[0], message, statement.Sig) {
+				return ErrInvalidAttestation
+			}
+
+			return nil
+		}
+
+		// Self attestation is signed by the credential key itself.
+		if statement.Alg != key.alg || !key.verify(message, statement.Sig) {
+			return ErrInvalidAttestation
+		}
+
+		return nil
+	}
+
+	return ErrUnsupportedAttestation
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+
+	return list
+}
@@ -0,0 +1,347 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// authenticator is a software authenticator holding a single credential.
+type authenticator struct {
+	rpID         string
+	credentialID []byte
+	ecdsaKey     *ecdsa.PrivateKey
+	ed25519Key   ed25519.PrivateKey
+	signCount    uint32
+	flags        byte
+}
+
+func newAuthenticator(t *testing.T, alg int) *authenticator {
+	a := &authenticator{
+		rpID:         testRPID,
+		credentialID: make([]byte, 16),
+		flags:        flagUserPresent | flagUserVerified,
+	}
+
+	_, err := rand.Read(a.credentialID)
+	require.NoError(t, err)
+
+	switch alg {
+	case AlgES256:
+		a.ecdsaKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, a.ed25519Key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+
+	return a
+}
+
+func (a *authenticator) publicKey(t *testing.T) []byte {
+	var key map[int]interface{}
+
+	if a.ecdsaKey != nil {
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		a.ecdsaKey.X.FillBytes(x)
+		a.ecdsaKey.Y.FillBytes(y)
+
+		key = map[int]interface{}{
+			coseKty: ktyEC2,
+			coseAlg: AlgES256,
+			coseCrv: crvP256,
+			coseX:   x,
+			coseY:   y,
+		}
+	} else {
+		key = map[int]interface{}{
+			coseKty: ktyOKP,
+			coseAlg: AlgEdDSA,
+			coseCrv: crvEd25519,
+			coseX:   []byte(a.ed25519Key.Public().(ed25519.PublicKey)),
+		}
+	}
+
+	encoded, err := cbor.Marshal(key)
+	require.NoError(t, err)
+
+	return encoded
+}
+
+func (a *authenticator) authData(t *testing.T, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.publicKey(t)...)
+	}
+
+	return data
+}
+
+func (a *authenticator) sign(t *testing.T, message []byte) []byte {
+	if a.ecdsaKey != nil {
+		digest := sha256.Sum256(message)
+
+		signature, err := ecdsa.SignASN1(rand.Reader, a.ecdsaKey, digest[:])
+		require.NoError(t, err)
+
+		return signature
+	}
+
+	return ed25519.Sign(a.ed25519Key, message)
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge []byte, origin string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": URLEncodedBase64(challenge),
+		"origin":    origin,
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+// create mimics navigator.credentials.create() and returns the JSON
+// serialized response.
+func (a *authenticator) create(t *testing.T, challenge []byte, origin string) []byte {
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, true),
+	})
+	require.NoError(t, err)
+
+	response := &CredentialCreationResponse{
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientDataJSON(t, "webauthn.create", challenge, origin)
+	response.Response.AttestationObject = attestation
+
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+
+	return data
+}
+
+// get mimics navigator.credentials.get() and returns the JSON
+// serialized response.
+func (a *authenticator) get(t *testing.T, challenge []byte, origin string) []byte {
+	a.signCount++
+
+	authData := a.authData(t, false)
+	clientData := clientDataJSON(t, "webauthn.get", challenge, origin)
+
+	response := &CredentialAssertionResponse{
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientData
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = a.sign(t, signedData(authData, clientData))
+
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+
+	return data
+}
+
+func newRelyingParty(t *testing.T, userVerification string) *WebAuthn {
+	w, err := New(Config{
+		RPID:             testRPID,
+		RPName:           "Puppet Master",
+		Origins:          []string{testOrigin},
+		Timeout:          time.Minute,
+		UserVerification: userVerification,
+	})
+	require.NoError(t, err)
+
+	return w
+}
+
+func register(t *testing.T, w *WebAuthn, a *authenticator) *Credential {
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+
+	response, err := ParseCredentialCreation(a.create(t, challenge, testOrigin))
+	require.NoError(t, err)
+
+	signed, err := response.Challenge()
+	require.NoError(t, err)
+	assert.Equal(t, challenge, signed)
+
+	credential, err := w.VerifyRegistration(response, challenge)
+	require.NoError(t, err)
+
+	return credential
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	for name, alg := range map[string]int{"ES256": AlgES256, "EdDSA": AlgEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			w := newRelyingParty(t, UserVerificationPreferred)
+			a := newAuthenticator(t, alg)
+
+			credential := register(t, w, a)
+			assert.Equal(t, a.credentialID, credential.ID)
+
+			for i := 0; i < 2; i++ {
+				challenge, err := NewChallenge()
+				require.NoError(t, err)
+
+				response, err := ParseCredentialAssertion(a.get(t, challenge, testOrigin))
+				require.NoError(t, err)
+
+				signCount, err := w.VerifyAssertion(response, challenge, credential)
+				require.NoError(t, err)
+				assert.Equal(t, a.signCount, signCount)
+				assert.True(t, response.UserVerified())
+
+				credential.SignCount = signCount
+			}
+		})
+	}
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	w := newRelyingParty(t, UserVerificationRequired)
+
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+
+	other, err := NewChallenge()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		response func(a *authenticator) []byte
+		err      error
+	}{
+		{
+			name:     "wrong challenge",
+			response: func(a *authenticator) []byte { return a.create(t, other, testOrigin) },
+			err:      ErrChallengeMismatch,
+		},
+		{
+			name:     "wrong origin",
+			response: func(a *authenticator) []byte { return a.create(t, challenge, "https://evil.example") },
+			err:      ErrOriginMismatch,
+		},
+		{
+			name: "wrong relying party",
+			response: func(a *authenticator) []byte {
+				a.rpID = "evil.example"
+				return a.create(t, challenge, testOrigin)
+			},
+			err: ErrRPIDMismatch,
+		},
+		{
+			name: "user not verified",
+			response: func(a *authenticator) []byte {
+				a.flags = flagUserPresent
+				return a.create(t, challenge, testOrigin)
+			},
+			err: ErrUserNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ParseCredentialCreation(tt.response(newAuthenticator(t, AlgES256)))
+			require.NoError(t, err)
+
+			_, err = w.VerifyRegistration(response, challenge)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestAssertionErrors(t *testing.T) {
+	w := newRelyingParty(t, UserVerificationPreferred)
+	a := newAuthenticator(t, AlgES256)
+	credential := register(t, w, a)
+
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+
+	t.Run("bad signature", func(t *testing.T) {
+		response, err := ParseCredentialAssertion(a.get(t, challenge, testOrigin))
+		require.NoError(t, err)
+
+		response.Response.Signature[len(response.Response.Signature)-1] ^= 0xff
+
+		_, err = w.VerifyAssertion(response, challenge, credential)
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("other credential", func(t *testing.T) {
+		response, err := ParseCredentialAssertion(newAuthenticator(t, AlgES256).get(t, challenge, testOrigin))
+		require.NoError(t, err)
+
+		_, err = w.VerifyAssertion(response, challenge, credential)
+		assert.Equal(t, ErrCredentialMismatch, err)
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		response, err := ParseCredentialAssertion(a.get(t, challenge, testOrigin))
+		require.NoError(t, err)
+
+		stored := *credential
+		stored.SignCount = a.signCount
+
+		_, err = w.VerifyAssertion(response, challenge, &stored)
+		assert.Equal(t, ErrSignCount, err)
+	})
+}
+
+func TestAssertionWithoutUserVerification(t *testing.T) {
+	a := newAuthenticator(t, AlgES256)
+	a.flags = flagUserPresent
+
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+
+	// "preferred" accepts it, but the caller can see the user was not
+	// verified.
+	w := newRelyingParty(t, UserVerificationPreferred)
+	credential := register(t, w, a)
+
+	response, err := ParseCredentialAssertion(a.get(t, challenge, testOrigin))
+	require.NoError(t, err)
+
+	_, err = w.VerifyAssertion(response, challenge, credential)
+	require.NoError(t, err)
+	assert.False(t, response.UserVerified())
+
+	_, err = newRelyingParty(t, UserVerificationRequired).VerifyAssertion(response, challenge, credential)
+	assert.Equal(t, ErrUserNotVerified, err)
+}